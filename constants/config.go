@@ -62,7 +62,7 @@ func (f *FliterMode) UnmarshalYAML(value *yaml.Node) error {
 	case "blacklist":
 		*f = BLACKLIST
 	default:
-		return fmt.Errorf("unknown FliterMode: %s", s)
+		return yamlValueError(value, "unknown FliterMode: %s", s)
 	}
 	return nil
 }
@@ -83,3 +83,162 @@ func (f *FliterMode) UnmarshalText(text []byte) error {
 	}
 	return nil
 }
+
+type FilterAction uint8 // 客户端过滤规则动作
+
+const (
+	FilterUnset FilterAction = iota // 未设置（零值，配置校验时报错）
+	FilterAllow                     // 放行
+	FilterDeny                      // 拦截
+)
+
+func (f FilterAction) String() string {
+	switch f {
+	case FilterAllow:
+		return "allow"
+	case FilterDeny:
+		return "deny"
+	default:
+		return "unknown"
+	}
+}
+
+func (f *FilterAction) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	switch strings.ToLower(s) {
+	case "allow":
+		*f = FilterAllow
+	case "deny":
+		*f = FilterDeny
+	default:
+		return yamlValueError(value, "unknown FilterAction: %s", s)
+	}
+	return nil
+}
+
+type RateLimitKey uint8 // 限流维度
+
+const (
+	RateLimitByIP     RateLimitKey = iota // 客户端 IP
+	RateLimitByDevice                     // 设备 ID，无法识别时使用客户端 IP
+	RateLimitByUser                       // 媒体服务器用户，无法识别时依次使用访问令牌、设备 ID
+)
+
+func (r RateLimitKey) String() string {
+	switch r {
+	case RateLimitByIP:
+		return "ip"
+	case RateLimitByDevice:
+		return "device"
+	case RateLimitByUser:
+		return "user"
+	default:
+		return "unknown"
+	}
+}
+
+func (r *RateLimitKey) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	switch strings.ToLower(s) {
+	case "", "ip":
+		*r = RateLimitByIP
+	case "device":
+		*r = RateLimitByDevice
+	case "user":
+		*r = RateLimitByUser
+	default:
+		return yamlValueError(value, "unknown RateLimitKey: %s", s)
+	}
+	return nil
+}
+
+type CacheBackend uint8 // 缓存后端
+
+const (
+	MemoryCache CacheBackend = iota // 内存缓存
+	DiskCache                       // 磁盘缓存，重启后保留
+	TieredCache                     // 内存 + 磁盘两级缓存
+)
+
+func (c CacheBackend) String() string {
+	switch c {
+	case MemoryCache:
+		return "memory"
+	case DiskCache:
+		return "disk"
+	case TieredCache:
+		return "tiered"
+	default:
+		return "unknown"
+	}
+}
+
+func (c *CacheBackend) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	switch strings.ToLower(s) {
+	case "", "memory":
+		*c = MemoryCache
+	case "disk":
+		*c = DiskCache
+	case "tiered":
+		*c = TieredCache
+	default:
+		return yamlValueError(value, "unknown CacheBackend: %s", s)
+	}
+	return nil
+}
+
+type AlistStrategy uint8 // Alist 节点选择策略
+
+const (
+	PrimaryStrategy    AlistStrategy = iota // 优先使用第一个可用节点，其余节点作为备用
+	RoundRobinStrategy                      // 依次轮流使用各个节点
+	WeightedStrategy                        // 按照权重随机选择节点
+)
+
+func (a AlistStrategy) String() string {
+	switch a {
+	case PrimaryStrategy:
+		return "primary"
+	case RoundRobinStrategy:
+		return "round_robin"
+	case WeightedStrategy:
+		return "weighted"
+	default:
+		return "unknown"
+	}
+}
+
+func (a *AlistStrategy) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	switch strings.ToLower(s) {
+	case "", "primary":
+		*a = PrimaryStrategy
+	case "round_robin":
+		*a = RoundRobinStrategy
+	case "weighted":
+		*a = WeightedStrategy
+	default:
+		return yamlValueError(value, "unknown AlistStrategy: %s", s)
+	}
+	return nil
+}
+
+// 带有行号的 YAML 取值错误
+//
+// 返回 *yaml.TypeError 使解析器继续解析其余字段，从而一次报告所有问题
+func yamlValueError(value *yaml.Node, format string, args ...any) error {
+	return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: ", value.Line) + fmt.Sprintf(format, args...)}}
+}
@@ -54,7 +54,7 @@ func (m *MediaServerType) UnmarshalYAML(value *yaml.Node) error {
 	case "Plex":
 		*m = PLEX
 	default:
-		return fmt.Errorf("invalid MediaServerType: %s", s)
+		return yamlValueError(value, "invalid MediaServerType: %s", s)
 	}
 	return nil
 }
@@ -19,6 +19,7 @@ type RouterRegexps struct {
 	ModifyIndex          *regexp.Regexp // Web 首页
 	ModifyPlaybackInfo   *regexp.Regexp // 播放信息处理接口
 	ModifySubtitles      *regexp.Regexp // 字幕处理接口
+	PlayingSession       *regexp.Regexp // 播放进度上报接口
 }
 
 type OthersRegexps struct {
@@ -32,6 +33,7 @@ var EmbyRegexp = &EmbyRegexps{
 		ModifyIndex:          regexp.MustCompile(`^/web/index.html$`),
 		ModifyPlaybackInfo:   regexp.MustCompile(`(?i)^(/emby)?/Items/\d+/PlaybackInfo$`),
 		ModifySubtitles:      regexp.MustCompile(`(?i)^(/emby)?/Videos/\d+/\w+/subtitles$`),
+		PlayingSession:       regexp.MustCompile(`(?i)^(/emby)?/Sessions/Playing(/Progress|/Stopped|/Ping)?$`),
 	},
 	Others: OthersRegexps{
 		VideoRedirectReg: regexp.MustCompile(`(?i)^(/emby)?/videos/(.*)/stream/(.*)`),
@@ -50,6 +52,7 @@ type JellyfinRouterRegexps struct {
 	ModifyIndex        *regexp.Regexp // Web 首页
 	ModifyPlaybackInfo *regexp.Regexp // 播放信息处理接口
 	ModifySubtitles    *regexp.Regexp // 字幕处理接口
+	PlayingSession     *regexp.Regexp // 播放进度上报接口
 }
 type JellyfinRegexps struct {
 	Router JellyfinRouterRegexps
@@ -61,7 +64,8 @@ var JellyfinRegexp = &JellyfinRegexps{
 		VideosHandler:      regexp.MustCompile(`/Videos/[\w-]+/(stream|original)(\.\w+)?$`), // /Videos/813a630bcf9c3f693a2ec8c498f868d2/stream /Videos/205953b114bb8c9dc2c7ba7e44b8024c/stream.mp4
 		ModifyIndex:        regexp.MustCompile(`^/web/$`),
 		ModifyPlaybackInfo: regexp.MustCompile(`^/Items/\w+/PlaybackInfo$`),
-		ModifySubtitles:    regexp.MustCompile(`/Videos/\d+/\w+/subtitles$`),
+		ModifySubtitles:    regexp.MustCompile(`(?i)^/Videos/[\w-]+/[\w-]+/Subtitles/\d+(/\d+)?/Stream\.\w+$`), // /Videos/6c252d46-952c-5b0d-5f0e-f6e3036c0a39/6c252d46952c5b0d5f0ef6e3036c0a39/Subtitles/2/0/Stream.srt
+		PlayingSession:     regexp.MustCompile(`(?i)^/Sessions/Playing(/Progress|/Stopped|/Ping)?$`),
 	},
 	Cache: CacheRegexps{
 		// /Items/19ba9e43f0db12e2eea4294609ec1a0c/Images/Primary
@@ -73,3 +77,41 @@ var JellyfinRegexp = &JellyfinRegexps{
 		Subtitle: regexp.MustCompile(`(?i)/Videos/(.*)/Subtitles/(.*)/Stream\.(ass|ssa|srt|)?$`),
 	},
 }
+
+type PlexRouterRegexps struct {
+	VideosHandler    *regexp.Regexp // 媒体文件直接播放接口匹配
+	TranscodeHandler *regexp.Regexp // 转码播放接口匹配
+	ModifyMetadata   *regexp.Regexp // 条目元数据接口（用于记录媒体文件信息）
+}
+
+type PlexOthersRegexps struct {
+	PartID    *regexp.Regexp // 从媒体文件播放接口中提取 Part ID
+	RatingKey *regexp.Regexp // 从转码请求的 path 参数中提取 ratingKey
+}
+
+type PlexRegexps struct {
+	Router PlexRouterRegexps
+	Others PlexOthersRegexps
+	Cache  CacheRegexps
+}
+
+var PlexRegexp = &PlexRegexps{
+	Router: PlexRouterRegexps{
+		VideosHandler:    regexp.MustCompile(`^/library/parts/\d+(/\d+)?/file(\.\w+)?$`),     // /library/parts/1234/1690000000/file.mkv
+		TranscodeHandler: regexp.MustCompile(`^/video/:/transcode/universal/start(\.\w+)?$`), // /video/:/transcode/universal/start.m3u8
+		ModifyMetadata:   regexp.MustCompile(`^/library/metadata/\d+$`),
+	},
+	Others: PlexOthersRegexps{
+		PartID:    regexp.MustCompile(`^/library/parts/(\d+)`),
+		RatingKey: regexp.MustCompile(`/library/metadata/(\d+)`),
+	},
+	Cache: CacheRegexps{
+		// /library/metadata/1234/thumb/1690000000
+		// /library/metadata/1234/art/1690000000
+		// /photo/:/transcode?width=300&height=450&url=...
+		Image: regexp.MustCompile(`^(/library/metadata/\d+/(thumb|art|banner|clearLogo|theme)(/\d+)?|/photo/:/transcode)$`),
+
+		// /library/streams/5678
+		Subtitle: regexp.MustCompile(`^/library/streams/\d+$`),
+	},
+}
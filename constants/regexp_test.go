@@ -1,5 +1,66 @@
 package constants_test
 
+import (
+	"MediaWarp/constants"
+	"testing"
+)
+
+func TestJellyfinSubtitleRoute(t *testing.T) {
+	type RouteTestCase struct {
+		URI   string
+		Match bool
+	}
+	testCases := map[string]RouteTestCase{
+		"Jellyfin 字幕": {
+			"/Videos/6c252d46-952c-5b0d-5f0e-f6e3036c0a39/6c252d46952c5b0d5f0ef6e3036c0a39/Subtitles/2/0/Stream.srt",
+			true,
+		},
+		"Jellyfin 字幕（无起始时间）": {
+			"/Videos/6c252d46-952c-5b0d-5f0e-f6e3036c0a39/6c252d46952c5b0d5f0ef6e3036c0a39/Subtitles/2/Stream.ass",
+			true,
+		},
+		"Jellyfin 视频": {
+			"/Videos/813a630bcf9c3f693a2ec8c498f868d2/stream.mp4",
+			false,
+		},
+	}
+	for caseName, testCase := range testCases {
+		t.Run(caseName, func(t *testing.T) {
+			if constants.JellyfinRegexp.Router.ModifySubtitles.MatchString(testCase.URI) != testCase.Match {
+				t.Errorf("%s 路由错误。期望匹配: %t", caseName, testCase.Match)
+			}
+		})
+	}
+}
+
+func TestPlayingSessionRoute(t *testing.T) {
+	type RouteTestCase struct {
+		URI    string
+		Regexp string
+		Match  bool
+	}
+	testCases := map[string]RouteTestCase{
+		"Emby 开始播放":      {"/emby/Sessions/Playing", "Emby", true},
+		"Emby 播放进度":      {"/emby/Sessions/Playing/Progress", "Emby", true},
+		"Emby 停止播放":      {"/Sessions/Playing/Stopped", "Emby", true},
+		"Emby 会话列表":      {"/emby/Sessions", "Emby", false},
+		"Jellyfin 播放进度":  {"/Sessions/Playing/Progress", "Jellyfin", true},
+		"Jellyfin Ping":  {"/Sessions/Playing/Ping", "Jellyfin", true},
+		"Jellyfin 带前缀路径": {"/emby/Sessions/Playing", "Jellyfin", false},
+	}
+	for caseName, testCase := range testCases {
+		t.Run(caseName, func(t *testing.T) {
+			reg := constants.EmbyRegexp.Router.PlayingSession
+			if testCase.Regexp == "Jellyfin" {
+				reg = constants.JellyfinRegexp.Router.PlayingSession
+			}
+			if reg.MatchString(testCase.URI) != testCase.Match {
+				t.Errorf("%s 路由错误。期望匹配: %t", caseName, testCase.Match)
+			}
+		})
+	}
+}
+
 // func TestEmbyRoute(t *testing.T) {
 // 	type RouteTestCase struct {
 // 		URI    string
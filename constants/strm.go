@@ -1,5 +1,11 @@
 package constants
 
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
 type StrmFileType uint8 // Strm 文件类型
 
 const (
@@ -18,3 +24,37 @@ func (s StrmFileType) String() string {
 		return "UnknownStrm"
 	}
 }
+
+type StreamMode uint8 // Strm 媒体流响应模式
+
+const (
+	RedirectMode StreamMode = iota // 302 重定向至媒体链接
+	ProxyMode                      // 由 MediaWarp 代理媒体流
+)
+
+func (s StreamMode) String() string {
+	switch s {
+	case RedirectMode:
+		return "redirect"
+	case ProxyMode:
+		return "proxy"
+	default:
+		return "unknown"
+	}
+}
+
+func (s *StreamMode) UnmarshalYAML(value *yaml.Node) error {
+	var mode string
+	if err := value.Decode(&mode); err != nil {
+		return err
+	}
+	switch strings.ToLower(mode) {
+	case "", "redirect":
+		*s = RedirectMode
+	case "proxy":
+		*s = ProxyMode
+	default:
+		return yamlValueError(value, "invalid StreamMode: %s", mode)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"MediaWarp/constants"
+	"MediaWarp/internal/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+var (
+	ErrNotFound = errors.New("缓存不存在")
+	ErrClosed   = errors.New("缓存已关闭")
+)
+
+// 缓存后端
+type Backend interface {
+	Get(key string) ([]byte, error)     // 获取缓存，不存在或已过期时返回 ErrNotFound
+	Set(key string, value []byte) error // 写入缓存
+	Delete(key string) error            // 删除缓存，不存在时不返回错误
+	Keys() []string                     // 所有缓存键
+	Reset() error                       // 清空缓存
+	Stats() metrics.CacheStats          // 统计信息
+	Close() error                       // 关闭缓存后端，磁盘缓存会保存索引
+}
+
+// 缓存后端配置
+type BackendOptions struct {
+	Type    constants.CacheBackend
+	TTL     time.Duration
+	Dir     string // 磁盘缓存目录，每个缓存池使用其中以名称命名的子目录
+	MaxSize int64  // 磁盘缓存最大占用空间（字节）
+}
+
+type backendEntry struct {
+	backend Backend
+	options BackendOptions
+}
+
+var (
+	backendsMutex sync.Mutex
+	backends      = make(map[string]*backendEntry) // 缓存池名称 -> 缓存后端
+)
+
+// 获取缓存后端
+//
+// 相同名称和配置的缓存后端会被复用（重新加载配置时保留已缓存的数据），
+// 配置改变时会关闭原缓存后端并创建新的缓存后端
+func GetBackend(name string, options BackendOptions) (Backend, error) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+
+	old, ok := backends[name]
+	if ok && old.options == options {
+		return old.backend, nil
+	}
+	if ok { // 磁盘缓存需要先保存索引，新的缓存后端才能读取到
+		unregister(name, old.backend)
+		old.backend.Close()
+		delete(backends, name)
+	}
+
+	backend, err := newBackend(name, options)
+	if err != nil {
+		return nil, fmt.Errorf("创建 %s 缓存池失败: %w", name, err)
+	}
+	backends[name] = &backendEntry{backend: backend, options: options}
+	register(name, backend, backend, options.Type.String())
+	return backend, nil
+}
+
+func newBackend(name string, options BackendOptions) (Backend, error) {
+	switch options.Type {
+	case constants.MemoryCache:
+		return newMemoryBackend(options.TTL)
+	case constants.DiskCache:
+		return newDiskBackend(filepath.Join(options.Dir, name), options.TTL, options.MaxSize)
+	case constants.TieredCache:
+		disk, err := newDiskBackend(filepath.Join(options.Dir, name), options.TTL, options.MaxSize)
+		if err != nil {
+			return nil, err
+		}
+		memory, err := newMemoryBackend(options.TTL)
+		if err != nil {
+			disk.Close()
+			return nil, err
+		}
+		return &tieredBackend{memory: memory, disk: disk}, nil
+	default:
+		return nil, fmt.Errorf("未知的缓存后端: %s", options.Type)
+	}
+}
+
+// 内存缓存后端
+type memoryBackend struct {
+	cache *bigcache.BigCache
+}
+
+func newMemoryBackend(ttl time.Duration) (*memoryBackend, error) {
+	cache, err := bigcache.New(context.Background(), bigcache.DefaultConfig(ttl))
+	if err != nil {
+		return nil, err
+	}
+	return &memoryBackend{cache: cache}, nil
+}
+
+func (m *memoryBackend) Get(key string) ([]byte, error) {
+	data, err := m.cache.Get(key)
+	if errors.Is(err, bigcache.ErrEntryNotFound) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (m *memoryBackend) Set(key string, value []byte) error {
+	return m.cache.Set(key, value)
+}
+
+func (m *memoryBackend) Delete(key string) error {
+	if err := m.cache.Delete(key); err != nil && !errors.Is(err, bigcache.ErrEntryNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (m *memoryBackend) Keys() []string {
+	keys := make([]string, 0, m.cache.Len())
+	iterator := m.cache.Iterator()
+	for iterator.SetNext() {
+		if entry, err := iterator.Value(); err == nil {
+			keys = append(keys, entry.Key())
+		}
+	}
+	return keys
+}
+
+func (m *memoryBackend) Reset() error {
+	return m.cache.Reset()
+}
+
+func (m *memoryBackend) Stats() metrics.CacheStats {
+	stats := m.cache.Stats()
+	return metrics.CacheStats{
+		Hits:    stats.Hits,
+		Misses:  stats.Misses,
+		Entries: int64(m.cache.Len()),
+		Bytes:   int64(m.cache.Capacity()),
+	}
+}
+
+func (m *memoryBackend) Close() error {
+	return m.cache.Close()
+}
+
+// 内存 + 磁盘两级缓存后端
+//
+// 优先读取内存缓存，未命中时读取磁盘缓存并写回内存缓存；写入时同时写入两级缓存
+type tieredBackend struct {
+	memory *memoryBackend
+	disk   *diskBackend
+}
+
+func (t *tieredBackend) Get(key string) ([]byte, error) {
+	if data, err := t.memory.Get(key); err == nil {
+		return data, nil
+	}
+	data, err := t.disk.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	t.memory.Set(key, data)
+	return data, nil
+}
+
+func (t *tieredBackend) Set(key string, value []byte) error {
+	t.memory.Set(key, value) // 内存缓存写入失败（如超过单个条目大小限制）时仍然写入磁盘缓存
+	return t.disk.Set(key, value)
+}
+
+func (t *tieredBackend) Delete(key string) error {
+	return errors.Join(t.memory.Delete(key), t.disk.Delete(key))
+}
+
+// 两级缓存的缓存键
+//
+// 内存缓存中的条目可能已经被磁盘缓存淘汰，因此合并两级缓存的缓存键
+func (t *tieredBackend) Keys() []string {
+	keys := append(t.memory.Keys(), t.disk.Keys()...)
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+func (t *tieredBackend) Reset() error {
+	return errors.Join(t.memory.Reset(), t.disk.Reset())
+}
+
+// 两级缓存的统计信息
+//
+// 命中次数为两级缓存命中次数之和，未命中次数、条目数量和占用空间以磁盘缓存为准
+func (t *tieredBackend) Stats() metrics.CacheStats {
+	memory, disk := t.memory.Stats(), t.disk.Stats()
+	disk.Hits += memory.Hits
+	return disk
+}
+
+func (t *tieredBackend) Close() error {
+	return errors.Join(t.memory.Close(), t.disk.Close())
+}
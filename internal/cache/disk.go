@@ -0,0 +1,363 @@
+package cache
+
+import (
+	"MediaWarp/internal/logging"
+	"MediaWarp/internal/metrics"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	diskIndexFile     = "index.json" // 索引文件名
+	diskObjectsDir    = "objects"    // 缓存内容目录
+	diskFlushInterval = time.Minute  // 定期保存索引的间隔
+)
+
+// 磁盘缓存条目
+type diskEntry struct {
+	Key     string    `json:"key"`
+	Hash    string    `json:"hash"` // 缓存内容的 SHA-256
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+	Access  time.Time `json:"access"` // 最后访问时间，用于 LRU 淘汰
+
+	element *list.Element
+}
+
+// 磁盘缓存后端
+//
+// 缓存内容按照 SHA-256 存放在 objects 目录中，内容相同的条目共用同一个文件；
+// 条目信息保存在索引文件中，重启后继续使用；
+// 占用空间超过 maxSize 时淘汰最久未访问的条目
+type diskBackend struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+
+	mutex   sync.Mutex
+	entries map[string]*diskEntry // 缓存键 -> 条目
+	lru     *list.List            // 按最后访问时间排序，最近访问的在前
+	objects map[string]int        // 缓存内容的 SHA-256 -> 引用次数
+	size    int64                 // 缓存内容占用的空间
+	dirty   bool                  // 索引是否需要保存
+	closed  bool
+
+	hits   atomic.Int64
+	misses atomic.Int64
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func newDiskBackend(dir string, ttl time.Duration, maxSize int64) (*diskBackend, error) {
+	if err := os.MkdirAll(filepath.Join(dir, diskObjectsDir), os.ModePerm); err != nil {
+		return nil, err
+	}
+	d := diskBackend{
+		dir:     dir,
+		ttl:     ttl,
+		maxSize: maxSize,
+		entries: make(map[string]*diskEntry),
+		lru:     list.New(),
+		objects: make(map[string]int),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	go d.flushLoop()
+	return &d, nil
+}
+
+// 读取索引并清理索引中不存在的缓存文件
+func (d *diskBackend) load() error {
+	var entries []*diskEntry
+	data, err := os.ReadFile(filepath.Join(d.dir, diskIndexFile))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &entries); err != nil {
+			logging.Warningf("磁盘缓存 %s 索引文件损坏，已忽略: %v", d.dir, err)
+			entries = nil
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	now := time.Now()
+	for _, entry := range entries { // 索引按照最后访问时间从新到旧保存
+		if entry.Key == "" || d.expired(entry, now) {
+			continue
+		}
+		if _, ok := d.objects[entry.Hash]; !ok {
+			info, err := os.Stat(d.objectPath(entry.Hash))
+			if err != nil {
+				continue
+			}
+			d.size += info.Size()
+		}
+		d.objects[entry.Hash]++
+		entry.element = d.lru.PushBack(entry)
+		d.entries[entry.Key] = entry
+	}
+
+	// 清理未被索引引用的缓存文件（如未保存索引时异常退出）
+	err = filepath.WalkDir(filepath.Join(d.dir, diskObjectsDir), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if _, ok := d.objects[entry.Name()]; !ok {
+			os.Remove(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d.evict()
+	d.dirty = len(d.entries) != len(entries)
+	logging.Debugf("加载磁盘缓存 %s，共 %d 个条目，占用 %d 字节", d.dir, len(d.entries), d.size)
+	return nil
+}
+
+// 缓存内容的文件路径
+func (d *diskBackend) objectPath(hash string) string {
+	return filepath.Join(d.dir, diskObjectsDir, hash[:2], hash)
+}
+
+func (d *diskBackend) expired(entry *diskEntry, now time.Time) bool {
+	return d.ttl > 0 && now.Sub(entry.Created) >= d.ttl
+}
+
+func (d *diskBackend) Get(key string) ([]byte, error) {
+	now := time.Now()
+	d.mutex.Lock()
+	entry, ok := d.entries[key]
+	if ok && (d.closed || d.expired(entry, now)) {
+		if !d.closed {
+			d.remove(entry)
+		}
+		ok = false
+	}
+	if !ok {
+		d.mutex.Unlock()
+		d.misses.Add(1)
+		return nil, ErrNotFound
+	}
+	entry.Access = now
+	d.lru.MoveToFront(entry.element)
+	d.dirty = true
+	path := d.objectPath(entry.Hash)
+	d.mutex.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil { // 缓存文件被删除或被同时淘汰
+		d.mutex.Lock()
+		if current, ok := d.entries[key]; ok && current == entry {
+			d.remove(entry)
+		}
+		d.mutex.Unlock()
+		d.misses.Add(1)
+		return nil, ErrNotFound
+	}
+	d.hits.Add(1)
+	return data, nil
+}
+
+func (d *diskBackend) Set(key string, value []byte) error {
+	sum := sha256.Sum256(value)
+	hash := hex.EncodeToString(sum[:])
+	now := time.Now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	if entry, ok := d.entries[key]; ok {
+		if entry.Hash == hash { // 内容未改变，只更新时间
+			entry.Created, entry.Access = now, now
+			d.lru.MoveToFront(entry.element)
+			d.dirty = true
+			return nil
+		}
+		d.remove(entry)
+	}
+
+	if d.objects[hash] == 0 {
+		if err := d.writeObject(hash, value); err != nil {
+			return err
+		}
+		d.size += int64(len(value))
+	}
+	d.objects[hash]++
+	entry := &diskEntry{Key: key, Hash: hash, Size: int64(len(value)), Created: now, Access: now}
+	entry.element = d.lru.PushFront(entry)
+	d.entries[key] = entry
+	d.dirty = true
+	d.evict()
+	return nil
+}
+
+// 写入缓存内容，先写入临时文件再重命名，避免读取到不完整的内容
+func (d *diskBackend) writeObject(hash string, value []byte) error {
+	path := d.objectPath(hash)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(value)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (d *diskBackend) Delete(key string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if entry, ok := d.entries[key]; ok && !d.closed {
+		d.remove(entry)
+	}
+	return nil
+}
+
+func (d *diskBackend) Keys() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	keys := make([]string, 0, len(d.entries))
+	for key := range d.entries {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (d *diskBackend) Reset() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	for _, entry := range d.entries {
+		d.remove(entry)
+	}
+	return d.flush()
+}
+
+// 删除条目，缓存内容不再被引用时删除文件
+func (d *diskBackend) remove(entry *diskEntry) {
+	delete(d.entries, entry.Key)
+	d.lru.Remove(entry.element)
+	d.dirty = true
+	if d.objects[entry.Hash]--; d.objects[entry.Hash] <= 0 {
+		delete(d.objects, entry.Hash)
+		d.size -= entry.Size
+		if err := os.Remove(d.objectPath(entry.Hash)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logging.Warningf("删除磁盘缓存文件失败: %v", err)
+		}
+	}
+}
+
+// 淘汰最久未访问的条目，直到占用空间不超过 maxSize
+func (d *diskBackend) evict() {
+	for d.maxSize > 0 && d.size > d.maxSize && d.lru.Len() > 0 {
+		d.remove(d.lru.Back().Value.(*diskEntry))
+	}
+}
+
+func (d *diskBackend) Stats() metrics.CacheStats {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return metrics.CacheStats{
+		Hits:    d.hits.Load(),
+		Misses:  d.misses.Load(),
+		Entries: int64(len(d.entries)),
+		Bytes:   d.size,
+	}
+}
+
+// 定期清理过期条目并保存索引
+func (d *diskBackend) flushLoop() {
+	defer close(d.done)
+	ticker := time.NewTicker(diskFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case now := <-ticker.C:
+			d.mutex.Lock()
+			for element := d.lru.Back(); element != nil; {
+				entry := element.Value.(*diskEntry)
+				element = element.Prev()
+				if d.expired(entry, now) {
+					d.remove(entry)
+				}
+			}
+			if err := d.flush(); err != nil {
+				logging.Warningf("保存磁盘缓存 %s 索引失败: %v", d.dir, err)
+			}
+			d.mutex.Unlock()
+		}
+	}
+}
+
+// 保存索引，需要持有锁
+func (d *diskBackend) flush() error {
+	if !d.dirty {
+		return nil
+	}
+	entries := make([]*diskEntry, 0, len(d.entries))
+	for element := d.lru.Front(); element != nil; element = element.Next() {
+		entries = append(entries, element.Value.(*diskEntry))
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(d.dir, diskIndexFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	d.dirty = false
+	return nil
+}
+
+func (d *diskBackend) Close() error {
+	d.mutex.Lock()
+	if d.closed {
+		d.mutex.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.mutex.Unlock()
+
+	close(d.stop)
+	<-d.done
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.flush()
+}
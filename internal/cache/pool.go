@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"MediaWarp/internal/logging"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+// 缓存池
+type pool struct {
+	cache *bigcache.BigCache
+	ttl   time.Duration
+}
+
+var (
+	poolsMutex sync.Mutex
+	pools      = make(map[string]*pool) // 缓存池名称 -> 缓存池
+)
+
+// 获取缓存池
+//
+// 相同名称和 TTL 的缓存池会被复用（重新加载配置时保留已缓存的数据），
+// TTL 改变时会创建新的缓存池并关闭原缓存池
+func GetPool(name string, ttl time.Duration) (*bigcache.BigCache, error) {
+	poolsMutex.Lock()
+	defer poolsMutex.Unlock()
+
+	old, ok := pools[name]
+	if ok && old.ttl == ttl {
+		return old.cache, nil
+	}
+
+	cache, err := bigcache.New(context.Background(), bigcache.DefaultConfig(ttl))
+	if err != nil {
+		return nil, fmt.Errorf("创建 %s 缓存池失败: %w", name, err)
+	}
+	if ok {
+		Unregister(name, old.cache)
+		old.cache.Close()
+	}
+	pools[name] = &pool{cache: cache, ttl: ttl}
+	Register(name, cache)
+	return cache, nil
+}
+
+// 关闭所有缓存池和缓存后端
+//
+// 退出时调用，磁盘缓存会在关闭时保存索引
+func CloseAll() {
+	poolsMutex.Lock()
+	defer poolsMutex.Unlock()
+
+	for name, p := range pools {
+		Unregister(name, p.cache)
+		p.cache.Close()
+		delete(pools, name)
+	}
+
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	for name, entry := range backends {
+		unregister(name, entry.backend)
+		if err := entry.backend.Close(); err != nil {
+			logging.Warningf("关闭 %s 缓存池失败: %v", name, err)
+		}
+		delete(backends, name)
+	}
+}
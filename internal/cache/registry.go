@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"MediaWarp/internal/metrics"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+var ErrPoolNotFound = errors.New("缓存池不存在")
+
+// 缓存池信息
+type PoolInfo struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`    // 存储方式
+	Entries int64  `json:"entries"` // 条目数量
+	Hits    int64  `json:"hits"`    // 命中次数
+	Misses  int64  `json:"misses"`  // 未命中次数
+	Bytes   int64  `json:"bytes"`   // 占用空间（字节）
+}
+
+type registeredBackend struct {
+	key     any // 用于取消注册
+	backend Backend
+	typ     string
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = make(map[string][]registeredBackend) // 缓存池名称 -> 缓存后端（同名缓存池可能有多个，如多个 Alist 客户端）
+)
+
+// 注册缓存后端，用于导出指标和缓存管理
+func register(name string, key any, backend Backend, typ string) {
+	registryMutex.Lock()
+	registry[name] = append(registry[name], registeredBackend{key: key, backend: backend, typ: typ})
+	registryMutex.Unlock()
+	metrics.RegisterCacheStats(name, key, backend.Stats)
+}
+
+func unregister(name string, key any) {
+	metrics.UnregisterCache(name, key)
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	entries := registry[name]
+	for i, entry := range entries {
+		if entry.key == key {
+			registry[name] = append(entries[:i:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(registry[name]) == 0 {
+		delete(registry, name)
+	}
+}
+
+// 注册由其他组件创建的内存缓存（如 Alist API 缓存）
+//
+// 注册后可以通过管理 API 查看和清除，并导出缓存指标
+func Register(name string, cache *bigcache.BigCache) {
+	register(name, cache, &memoryBackend{cache: cache}, "memory")
+}
+
+// 取消注册内存缓存
+func Unregister(name string, cache *bigcache.BigCache) {
+	unregister(name, cache)
+}
+
+// 获取指定名称的所有缓存后端
+func lookup(name string) ([]Backend, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	entries, ok := registry[name]
+	if !ok {
+		return nil, ErrPoolNotFound
+	}
+	result := make([]Backend, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry.backend)
+	}
+	return result, nil
+}
+
+// 列出所有缓存池，按名称排序
+//
+// 同名缓存池的统计信息会合并
+func List() []PoolInfo {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	result := make([]PoolInfo, 0, len(registry))
+	for _, name := range slices.Sorted(maps.Keys(registry)) {
+		info := PoolInfo{Name: name}
+		for _, entry := range registry[name] {
+			stats := entry.backend.Stats()
+			info.Type = entry.typ
+			info.Entries += stats.Entries
+			info.Hits += stats.Hits
+			info.Misses += stats.Misses
+			info.Bytes += stats.Bytes
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// 列出缓存池中满足 match 的缓存键，按字典序排序
+//
+// match 为 nil 时列出所有缓存键
+func Keys(name string, match func(key string) bool) ([]string, error) {
+	backends, err := lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, backend := range backends {
+		for _, key := range backend.Keys() {
+			if match == nil || match(key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys), nil
+}
+
+// 清除缓存池中满足 match 的缓存，返回清除的条目数量
+//
+// match 为 nil 时清空整个缓存池
+func Purge(name string, match func(key string) bool) (int, error) {
+	backends, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		count int
+		errs  []error
+	)
+	for _, backend := range backends {
+		keys := backend.Keys()
+		if match == nil {
+			count += len(keys)
+			errs = append(errs, backend.Reset())
+			continue
+		}
+		for _, key := range keys {
+			if !match(key) {
+				continue
+			}
+			if err := backend.Delete(key); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			count++
+		}
+	}
+	return count, errors.Join(errs...)
+}
@@ -5,9 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"time"
-
-	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -20,17 +20,25 @@ var (
 		Arch:       runtime.GOARCH,
 	}
 
-	Port         uint16              // MediaWarp开放端口
-	MediaServer  MediaServerSetting  // 上游媒体服务器设置
-	Logger       LoggerSetting       // 日志设置
-	Cache        CacheSetting        // 缓存设置
-	Web          WebSetting          // Web服务器设置
-	ClientFilter ClientFilterSetting // 客户端过滤设置
-	HTTPStrm     HTTPStrmSetting     // HTTPSTRM设置
-	AlistStrm    AlistStrmSetting    // AlistStrm设置
-	Subtitle     SubtitleSetting     // 字幕设置
+	current atomic.Pointer[Setting] // 当前生效的配置
 )
 
+// 获取当前配置
+//
+// 返回的配置为只读快照，配置重新加载后不会改变；
+// 需要读取多个配置项时应当只调用一次 Get，保证读取到的配置一致
+func Get() *Setting {
+	if setting := current.Load(); setting != nil {
+		return setting
+	}
+	return &Setting{}
+}
+
+// 替换当前配置，返回原配置
+func Swap(setting *Setting) *Setting {
+	return current.Swap(setting)
+}
+
 // 获取版本信息
 func Version() *VersionInfo {
 	return &version
@@ -79,50 +87,174 @@ func CostomDir() string {
 	return "custom"
 }
 
+// 磁盘缓存目录
+//
+// 默认为 ./cache
+func (s *CacheSetting) DiskDir() string {
+	if s.Disk.Dir != "" {
+		return s.Disk.Dir
+	}
+	return "cache"
+}
+
+// 磁盘缓存池最大占用空间（字节）
+//
+// 未设置时默认为 1024MB
+func (s *CacheSetting) DiskMaxSize() int64 {
+	if s.Disk.MaxSize > 0 {
+		return s.Disk.MaxSize << 20
+	}
+	return 1024 << 20
+}
+
+// 字体库目录
+//
+// 用于 ASS 字幕字体子集化，默认为 ./fonts
+func (s *SubtitleSetting) FontLibraryDir() string {
+	if s.FontDir != "" {
+		return s.FontDir
+	}
+	return "fonts"
+}
+
 // MediaWarp监听地址
 //
 // 监听所有网卡
 func ListenAddr() string {
-	return fmt.Sprintf(":%d", Port)
+	return fmt.Sprintf(":%d", Get().Port)
+}
+
+// 监听地址列表
+//
+// 未设置 listen 时监听所有网卡的 port 端口
+func ListenList() []ListenSetting {
+	if listenList := Get().ListenList; len(listenList) > 0 {
+		return listenList
+	}
+	return []ListenSetting{{Addr: ListenAddr()}}
+}
+
+// 退出时等待活动请求完成的最长时间
+//
+// 未设置时默认为 30 秒
+func ShutdownTimeout() time.Duration {
+	if timeout := Get().ShutdownTimeout; timeout > 0 {
+		return timeout
+	}
+	return 30 * time.Second
+}
+
+// 播放会话的过期时间
+//
+// 未设置时默认为 5 分钟
+func SessionIdleTimeout() time.Duration {
+	if timeout := Get().Session.IdleTimeout; timeout > 0 {
+		return timeout
+	}
+	return 5 * time.Minute
+}
+
+// Alist 节点健康检查间隔
+//
+// 未设置时默认为 30 秒
+func (s *AlistHealthCheckSetting) CheckInterval() time.Duration {
+	if s.Interval > 0 {
+		return s.Interval
+	}
+	return 30 * time.Second
+}
+
+// 请求 Alist API 的超时时间
+//
+// 未设置时默认为 10 秒，超时后切换到其他节点
+func (s *AlistHealthCheckSetting) RequestTimeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return 10 * time.Second
+}
+
+// Strm 定时同步间隔
+//
+// 未设置时默认为 6 小时
+func StrmSyncInterval() time.Duration {
+	if interval := Get().StrmSync.Interval; interval > 0 {
+		return interval
+	}
+	return 6 * time.Hour
+}
+
+// Strm 同步时同时请求 Alist 的数量
+//
+// 未设置时默认为 4
+func StrmSyncConcurrency() int {
+	if concurrency := Get().StrmSync.Concurrency; concurrency > 0 {
+		return concurrency
+	}
+	return 4
+}
+
+// 生成 Strm 文件的视频扩展名（小写，不含 .）
+func StrmSyncVideoExts() []string {
+	return normalizeExtList(Get().StrmSync.VideoExtList, []string{"mkv", "mp4", "m4v", "avi", "mov", "wmv", "flv", "webm", "ts", "m2ts", "mts", "mpg", "mpeg", "rmvb", "iso"})
+}
+
+// 复制到本地的附属文件扩展名（小写，不含 .）
+func StrmSyncSidecarExts() []string {
+	return normalizeExtList(Get().StrmSync.SidecarExtList, []string{"nfo", "srt", "ass", "ssa", "vtt", "sub", "idx", "sup", "jpg", "jpeg", "png", "webp"})
+}
+
+// 统一扩展名格式，extList 为空时返回 defaultList
+func normalizeExtList(extList []string, defaultList []string) []string {
+	if len(extList) == 0 {
+		return defaultList
+	}
+	result := make([]string, 0, len(extList))
+	for _, ext := range extList {
+		result = append(result, strings.ToLower(strings.TrimPrefix(ext, ".")))
+	}
+	return result
 }
 
 // 初始化configManager
 func Init(path string) error {
-	if err := loadConfig(path); err != nil {
-		return err
-	}
-	if err := createDir(); err != nil {
+	setting, err := Load(path)
+	if err != nil {
 		return err
 	}
+	current.Store(setting)
 	return nil
 }
 
 // 读取并解析配置文件
-func loadConfig(path string) error {
-	var s Setting
+//
+// 不会修改当前配置，用于启动和重新加载配置
+func Load(path string) (*Setting, error) {
+	setting, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := createDir(setting); err != nil {
+		return nil, err
+	}
+	return setting, nil
+}
+
+// 读取并解析配置文件
+func loadConfig(path string) (*Setting, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("读取配置文件失败: %v", err)
+		return nil, fmt.Errorf("读取配置文件失败: %v", err)
 	}
-	err = yaml.Unmarshal(data, &s)
+	setting, err := parseConfig(data)
 	if err != nil {
-		return fmt.Errorf("解析配置文件失败: %v", err)
-	}
-
-	Port = s.Port
-	MediaServer = s.MediaServer
-	Logger = s.Logger
-	Cache = s.Cache
-	Web = s.Web
-	ClientFilter = s.ClientFilter
-	HTTPStrm = s.HTTPStrm
-	AlistStrm = s.AlistStrm
-	Subtitle = s.Subtitle
-	return nil
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+	return setting, nil
 }
 
 // 创建文件夹
-func createDir() error {
+func createDir(setting *Setting) error {
 	if err := os.MkdirAll(ConfigDir(), os.ModePerm); err != nil {
 		return fmt.Errorf("创建配置文件夹失败: %v", err)
 	}
@@ -132,5 +264,10 @@ func createDir() error {
 	if err := os.MkdirAll(CostomDir(), os.ModePerm); err != nil {
 		return fmt.Errorf("创建自定义静态资源文件夹失败: %v", err)
 	}
+	if setting.Subtitle.Enable && setting.Subtitle.SubSet {
+		if err := os.MkdirAll(setting.Subtitle.FontLibraryDir(), os.ModePerm); err != nil {
+			return fmt.Errorf("创建字体文件夹失败: %v", err)
+		}
+	}
 	return nil
 }
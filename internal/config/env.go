@@ -0,0 +1,333 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 环境变量覆盖配置项时使用的前缀
+//
+// 环境变量名为 MEDIAWARP_ 加上配置项路径（YAML 键名转为大写，以 _ 连接，列表使用下标，字典使用原样的键名），例如：
+//
+//	MEDIAWARP_SERVER_AUTH                -> server.auth
+//	MEDIAWARP_ALIST_STRM_LIST_0_PASSWORD -> alist_strm.list[0].password
+//	MEDIAWARP_HTTP_STRM_PREFIX_LIST      -> http_strm.prefix_list（列表、对象使用 YAML 格式，如 [/a, /b]）
+//	MEDIAWARP_SESSION_USER_LIMITS_a1b2c3 -> session.user_limits.a1b2c3
+const EnvPrefix = "MEDIAWARP_"
+
+// 配置值中的环境变量引用：${NAME}、${NAME:-默认值}，$${NAME} 表示不进行替换
+var envRefPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// 配置值中的文件引用前缀，如 file:/run/secrets/emby_api_key
+const fileRefPrefix = "file:"
+
+var (
+	settingType     = reflect.TypeOf(Setting{})
+	unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+)
+
+// 使用环境变量覆盖配置项
+//
+// environ 为 os.Environ() 格式的环境变量列表，未匹配任何配置项的环境变量会被忽略
+func (v *validator) applyEnvOverrides(environ []string) {
+	for _, env := range environ {
+		name, value, ok := strings.Cut(env, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		path, fieldType, ok := envPath(settingType, strings.TrimPrefix(name, EnvPrefix))
+		if !ok {
+			continue
+		}
+
+		node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+		switch {
+		case isScalarType(fieldType):
+			if derefType(fieldType).Kind() == reflect.String {
+				node.Tag = "!!str"
+			}
+		default: // 列表、对象使用 YAML 格式
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+				v.problems = append(v.problems, Problem{Message: fmt.Sprintf("环境变量 %s 格式错误: %v", name, err)})
+				continue
+			}
+			if len(doc.Content) == 0 {
+				continue
+			}
+			node = doc.Content[0]
+			clearLine(node)
+		}
+		if !hasReference(value) { // 提前检查取值，便于在错误信息中指出环境变量名
+			if err := node.Decode(reflect.New(fieldType).Interface()); err != nil {
+				v.problems = append(v.problems, Problem{Message: fmt.Sprintf("环境变量 %s 的值无效: %s", name, parseYAMLError(typeErrorMessage(err)).Message)})
+				continue
+			}
+		}
+		setNode(v.root, path, node)
+	}
+}
+
+// 根据环境变量名（去除前缀）查找对应的配置项路径和类型
+func envPath(t reflect.Type, name string) ([]any, reflect.Type, bool) {
+	t = derefType(t)
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := range t.NumField() {
+			field := t.Field(i)
+			key := yamlKey(field)
+			if key == "" {
+				continue
+			}
+			upper := strings.ToUpper(key)
+			if name == upper {
+				return []any{key}, field.Type, true
+			}
+			if rest, ok := strings.CutPrefix(name, upper+"_"); ok {
+				if path, fieldType, ok := envPath(field.Type, rest); ok {
+					return append([]any{key}, path...), fieldType, true
+				}
+			}
+		}
+	case reflect.Slice:
+		indexStr, rest, hasRest := strings.Cut(name, "_")
+		index, err := strconv.Atoi(indexStr)
+		if err != nil || index < 0 {
+			return nil, nil, false
+		}
+		if !hasRest {
+			return []any{index}, t.Elem(), true
+		}
+		if path, elemType, ok := envPath(t.Elem(), rest); ok {
+			return append([]any{index}, path...), elemType, true
+		}
+	case reflect.Map: // 键名可能包含 _，剩余部分整体作为键名
+		if name != "" {
+			return []any{name}, t.Elem(), true
+		}
+	}
+	return nil, nil, false
+}
+
+// 在 YAML 节点树中设置配置项，路径不存在时自动创建
+func setNode(root *yaml.Node, path []any, value *yaml.Node) {
+	if root.Kind != yaml.DocumentNode {
+		return
+	}
+	if len(root.Content) == 0 {
+		root.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	parent := root.Content[0]
+	for i, elem := range path {
+		last := i == len(path)-1
+		var child *yaml.Node
+		switch key := elem.(type) {
+		case string:
+			ensureKind(parent, yaml.MappingNode)
+			for j := 0; j+1 < len(parent.Content); j += 2 {
+				if parent.Content[j].Value == key {
+					child = parent.Content[j+1]
+					if last {
+						parent.Content[j+1] = value
+					}
+					break
+				}
+			}
+			if child == nil {
+				child = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+				if last {
+					child = value
+				}
+				parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+			}
+		case int:
+			ensureKind(parent, yaml.SequenceNode)
+			for len(parent.Content) <= key {
+				parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"})
+			}
+			if last {
+				parent.Content[key] = value
+			}
+			child = parent.Content[key]
+		}
+		parent = child
+	}
+}
+
+// 将空值节点转换为指定类型的节点
+func ensureKind(node *yaml.Node, kind yaml.Kind) {
+	if node.Kind == kind {
+		return
+	}
+	node.Kind, node.Value, node.Content = kind, "", nil
+	switch kind {
+	case yaml.MappingNode:
+		node.Tag = "!!map"
+	case yaml.SequenceNode:
+		node.Tag = "!!seq"
+	}
+}
+
+// 清除节点行号（来自环境变量的节点没有对应的行号）
+func clearLine(node *yaml.Node) {
+	node.Line, node.Column = 0, 0
+	for _, child := range node.Content {
+		clearLine(child)
+	}
+}
+
+// 按照配置结构遍历 YAML 节点树
+//
+// 检查未知的配置项，并替换配置值中的环境变量引用和文件引用；
+// 带有 expand:"false" 标签的配置项（如自定义 HTML、正则表达式等内容类配置项）不进行替换
+func (v *validator) resolve(node *yaml.Node, t reflect.Type, path []any, expand bool) {
+	if node.Kind == yaml.DocumentNode {
+		for _, child := range node.Content {
+			v.resolve(child, t, path, expand)
+		}
+		return
+	}
+	if isScalarType(t) {
+		if expand && node.Kind == yaml.ScalarNode {
+			v.expandScalar(node, derefType(t), path)
+		}
+		return
+	}
+
+	t = derefType(t)
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			field, ok := findField(t, key)
+			if !ok {
+				v.problems = append(v.problems, Problem{
+					Line:    node.Content[i].Line,
+					Message: fmt.Sprintf("%s: 未知的配置项", formatPath(subPath(path, key))),
+				})
+				continue
+			}
+			v.resolve(node.Content[i+1], field.Type, subPath(path, key), expand && field.Tag.Get("expand") != "false")
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for index, child := range node.Content {
+			v.resolve(child, t.Elem(), subPath(path, index), expand)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.resolve(node.Content[i+1], t.Elem(), subPath(path, node.Content[i].Value), expand)
+		}
+	}
+}
+
+// 替换标量配置值中的环境变量引用和文件引用
+func (v *validator) expandScalar(node *yaml.Node, t reflect.Type, path []any) {
+	value := node.Value
+	if filePath, ok := strings.CutPrefix(value, fileRefPrefix); ok {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			v.add(path, "读取文件 %s 失败: %v", filePath, err)
+			return
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	} else {
+		value = envRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+			if strings.HasPrefix(ref, "$$") { // 转义
+				return ref[1:]
+			}
+			matches := envRefPattern.FindStringSubmatch(ref)
+			if env, ok := os.LookupEnv(matches[1]); ok {
+				return env
+			}
+			if strings.Contains(ref, ":-") {
+				return matches[2]
+			}
+			v.add(path, "环境变量 %s 未设置", matches[1])
+			return ref
+		})
+	}
+	if value == node.Value {
+		return
+	}
+
+	node.Value = value
+	if t.Kind() == reflect.String {
+		node.Tag, node.Style = "!!str", 0
+	} else {
+		node.Tag, node.Style = "", 0 // 重新推断类型
+	}
+}
+
+// 配置值中是否包含环境变量引用或文件引用
+func hasReference(value string) bool {
+	return strings.HasPrefix(value, fileRefPrefix) || envRefPattern.MatchString(value)
+}
+
+// 获取 yaml 解析错误中的第一条错误信息
+func typeErrorMessage(err error) string {
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		return typeErr.Errors[0]
+	}
+	return err.Error()
+}
+
+// 根据 YAML 键名查找结构体字段
+func findField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		if field := t.Field(i); yamlKey(field) == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// 结构体字段对应的 YAML 键名，忽略的字段返回空字符串
+func yamlKey(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// 是否为标量配置项（包括自定义 YAML 解析的类型）
+func isScalarType(t reflect.Type) bool {
+	if reflect.PointerTo(derefType(t)).Implements(unmarshalerType) {
+		return true
+	}
+	switch derefType(t).Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map, reflect.Interface:
+		return false
+	}
+	return true
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
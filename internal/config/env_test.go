@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandReferences(t *testing.T) {
+	t.Setenv("MEDIAWARP_TEST_AUTH", "secret")
+	t.Setenv("MEDIAWARP_TEST_LIMIT", "3")
+	secretFile := filepath.Join(t.TempDir(), "auth")
+	if err := os.WriteFile(secretFile, []byte("file-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	const base = "port: 9000\nserver:\n  addr: http://127.0.0.1:8096\n"
+	cases := map[string]struct {
+		config  string
+		check   func(s *Setting) bool
+		wantErr string
+	}{
+		"环境变量引用": {
+			config: base + "  auth: ${MEDIAWARP_TEST_AUTH}\n",
+			check:  func(s *Setting) bool { return s.MediaServer.AUTH == "secret" },
+		},
+		"文件引用": {
+			config: base + "  auth: file:" + secretFile + "\n",
+			check:  func(s *Setting) bool { return s.MediaServer.AUTH == "file-secret" },
+		},
+		"自定义 HTML 不进行替换": {
+			config: base + "web:\n  head: '<script>console.log(`${name}`)</script>'\n  robots: 'file:robots'\n",
+			check: func(s *Setting) bool {
+				return s.Web.Head == "<script>console.log(`${name}`)</script>" && s.Web.Robots == "file:robots"
+			},
+		},
+		"正则表达式不进行替换": {
+			config: base + "http_strm:\n  rewrite:\n    - regexp: '^(?P<path>.*)$'\n      replace: '${path}'\n      ua_list: ['${UA}']\n",
+			check: func(s *Setting) bool {
+				rule := s.HTTPStrm.RewriteList[0]
+				return rule.Replace == "${path}" && rule.UAList[0] == "${UA}"
+			},
+		},
+		"字典的值": {
+			config: base + "session:\n  user_limits:\n    a1b2_c3: ${MEDIAWARP_TEST_LIMIT}\n",
+			check:  func(s *Setting) bool { return s.Session.UserLimits["a1b2_c3"] == 3 },
+		},
+		"字典的值引用未设置的环境变量": {
+			config:  base + "session:\n  user_limits:\n    a1b2c3: ${MEDIAWARP_TEST_UNSET}\n",
+			wantErr: "session.user_limits.a1b2c3: 环境变量 MEDIAWARP_TEST_UNSET 未设置",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			s, err := parseConfig([]byte(c.config))
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Errorf("错误信息错误，期望包含：%s，实际：%v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("解析配置失败：%s", err)
+			}
+			if !c.check(s) {
+				t.Errorf("配置值错误：%+v", s)
+			}
+		})
+	}
+}
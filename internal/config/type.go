@@ -15,6 +15,20 @@ type VersionInfo struct {
 	Arch       string `json:"arch"`        //  架构
 }
 
+// 监听设置
+type ListenSetting struct {
+	Addr          string `yaml:"addr"`           // 监听地址，如 :9000、127.0.0.1:9000；unix:/run/mediawarp.sock 表示 unix socket
+	CertFile      string `yaml:"cert_file"`      // TLS 证书文件，与 key_file 同时设置时启用 HTTPS（文件修改后自动重新加载）
+	KeyFile       string `yaml:"key_file"`       // TLS 私钥文件
+	H2C           bool   `yaml:"h2c"`            // 允许 HTTP/2 明文连接（h2c），未启用 TLS 时生效
+	ProxyProtocol bool   `yaml:"proxy_protocol"` // 解析 PROXY protocol（v1、v2）头部获取真实客户端地址
+}
+
+// 是否启用 TLS
+func (l *ListenSetting) TLS() bool {
+	return l.CertFile != "" && l.KeyFile != ""
+}
+
 // 上游媒体服务器相关设置
 type MediaServerSetting struct {
 	Type constants.MediaServerType `yaml:"type"` // 媒体服务器类型
@@ -41,71 +55,230 @@ type CacheSetting struct {
 	AlistAPITTL time.Duration `yaml:"alist_api_ttl"`
 	ImageTTL    time.Duration `yaml:"image_ttl"`
 	SubtitleTTL time.Duration `yaml:"subtitle_ttl"`
+
+	Backend constants.CacheBackend `yaml:"backend"` // 图片、字幕缓存的存储方式
+	Disk    DiskCacheSetting       `yaml:"disk"`    // 磁盘缓存设置（backend 为 disk 或 tiered 时生效）
+}
+
+// 磁盘缓存设置
+type DiskCacheSetting struct {
+	Dir     string `yaml:"dir"`      // 缓存目录，每个缓存池使用其中的一个子目录
+	MaxSize int64  `yaml:"max_size"` // 每个缓存池最大占用空间（MB），超出时淘汰最久未使用的缓存
 }
 
 // Web前端自定义设置
 type WebSetting struct {
-	Enable            bool   `yaml:"enable"`              // 启用自定义前端设置
-	Custom            bool   `yaml:"custom"`              // 启用用户自定义静态资源
-	Index             bool   `yaml:"index"`               // 是否从 custom 目录读取 index.html 文件作为首页
-	Head              string `yaml:"head"`                // 添加到 index.html 的 HEAD 中
-	Robots            string `yaml:"robots"`              // 自定义 robots.txt，若为空表示不修改
-	ExternalPlayerUrl bool   `yaml:"external_player_url"` // 是否开启外置播放器
-	Crx               bool   `yaml:"crx"`                 // crx 美化
-	ActorPlus         bool   `yaml:"actor_plus"`          // 过滤没有头像的演员和制作人员
-	FanartShow        bool   `yaml:"fanart_show"`         // 显示同人图（fanart图）
-	Danmaku           bool   `yaml:"danmaku"`             // Web 弹幕
-	VideoTogether     bool   `yaml:"video_together"`      // VideoTogether
+	Enable            bool   `yaml:"enable"`                // 启用自定义前端设置
+	Custom            bool   `yaml:"custom"`                // 启用用户自定义静态资源
+	Index             bool   `yaml:"index"`                 // 是否从 custom 目录读取 index.html 文件作为首页
+	Head              string `yaml:"head" expand:"false"`   // 添加到 index.html 的 HEAD 中
+	Robots            string `yaml:"robots" expand:"false"` // 自定义 robots.txt，若为空表示不修改
+	ExternalPlayerUrl bool   `yaml:"external_player_url"`   // 是否开启外置播放器
+	Crx               bool   `yaml:"crx"`                   // crx 美化
+	ActorPlus         bool   `yaml:"actor_plus"`            // 过滤没有头像的演员和制作人员
+	FanartShow        bool   `yaml:"fanart_show"`           // 显示同人图（fanart图）
+	Danmaku           bool   `yaml:"danmaku"`               // Web 弹幕
+	VideoTogether     bool   `yaml:"video_together"`        // VideoTogether
 }
 
 // 客户端User-Agent过滤设置
 type ClientFilterSetting struct {
 	Enable     bool                 `yaml:"enable"`
-	Mode       constants.FliterMode `yaml:"mode"`
-	ClientList []string             `yaml:"list"`
+	DryRun     bool                 `yaml:"dry_run"` // 试运行：只记录日志，不拦截请求
+	Rules      []ClientFilterRule   `yaml:"rules"`   // 访问控制规则，按顺序匹配，第一条匹配的规则决定放行或拦截
+	Mode       constants.FliterMode `yaml:"mode"`    // 未匹配任何规则时使用 User-Agent 黑白名单
+	ClientList []string             `yaml:"list" expand:"false"`
+}
+
+// 客户端访问控制规则
+//
+// 规则中设置的所有条件都满足时匹配，未设置的条件不限制
+type ClientFilterRule struct {
+	Name         string                 `yaml:"name"`                       // 规则名称，用于日志
+	Action       constants.FilterAction `yaml:"action"`                     // allow->放行 deny->拦截
+	SourceList   []string               `yaml:"source_list"`                // 连接来源 IP（直接连接 MediaWarp 的地址）网段，以 ! 开头表示排除
+	ClientIPList []string               `yaml:"client_ip_list"`             // 客户端 IP（经过可信代理时为代理转发的地址）网段，以 ! 开头表示排除
+	UA           string                 `yaml:"ua" expand:"false"`          // User-Agent 正则表达式
+	Client       string                 `yaml:"client" expand:"false"`      // 客户端名称（X-Emby-Client）正则表达式
+	DeviceName   string                 `yaml:"device_name" expand:"false"` // 设备名称（X-Emby-Device-Name）正则表达式
+	Path         string                 `yaml:"path" expand:"false"`        // 请求路径正则表达式
 }
 
 // HTTPStrm播放设置
 type HTTPStrmSetting struct {
-	Enable     bool     `yaml:"enable"`
-	TransCode  bool     `yaml:"transcode"` // false->强制关闭转码 true->保持原有转码设置
-	FinalURL   bool     `yaml:"final_url"` // 对 URL 进行重定向判断，找到非重定向地址再重定向给客户端，减少客户端重定向次数
-	PrefixList []string `yaml:"prefix_list"`
+	Enable      bool                 `yaml:"enable"`
+	TransCode   bool                 `yaml:"transcode"` // false->强制关闭转码 true->保持原有转码设置
+	FinalURL    bool                 `yaml:"final_url"` // 对 URL 进行重定向判断，找到非重定向地址再重定向给客户端，减少客户端重定向次数
+	PrefixList  []string             `yaml:"prefix_list"`
+	RewriteList []RewriteSetting     `yaml:"rewrite"`                 // Strm 内容重写规则（按顺序依次应用）
+	Mode        constants.StreamMode `yaml:"mode"`                    // redirect->302 重定向 proxy->代理媒体流
+	ProxyUAList []string             `yaml:"proxy_ua" expand:"false"` // User-Agent 匹配其中任意一个正则表达式的客户端使用代理模式
 }
 
 // AlistStrm具体设置
 type AlistSetting struct {
-	ADDR       string   `yaml:"addr"`
-	Username   string   `yaml:"username"`
-	Password   string   `yaml:"password"`
-	Token      *string  `yaml:"token"`
-	PrefixList []string `yaml:"prefix_list"`
+	ADDR               string                  `yaml:"addr"`
+	Username           string                  `yaml:"username"`
+	Password           string                  `yaml:"password"`
+	Token              *string                 `yaml:"token"`
+	OTPSecret          string                  `yaml:"otp_secret"` // 二步验证的 TOTP 密钥（Base32 编码），账户开启二步验证时用于登录
+	PrefixList         []string                `yaml:"prefix_list"`
+	PathMapList        []PathMapSetting        `yaml:"path_map"`        // 媒体服务器本地路径与 Alist 路径的映射（用于挂载到本地的网盘文件）
+	RewriteList        []RewriteSetting        `yaml:"rewrite"`         // Strm 内容重写规则（按顺序依次应用）
+	Weight             int                     `yaml:"weight"`          // 节点权重（strategy 为 weighted 时生效），默认为 1
+	Strategy           constants.AlistStrategy `yaml:"strategy"`        // 节点选择策略：primary、round_robin、weighted
+	Nodes              []AlistNodeSetting      `yaml:"nodes"`           // 内容相同的镜像节点，与 addr 组成节点组
+	FolderPasswordList []FolderPasswordSetting `yaml:"folder_password"` // 加密目录的访问密码（Alist 元信息中设置的密码）
+}
+
+// Alist 加密目录设置
+type FolderPasswordSetting struct {
+	Path     string `yaml:"path"`     // Alist 目录路径，对其中所有文件生效
+	Password string `yaml:"password"` // 目录密码
+}
+
+// Alist 镜像节点设置
+//
+// 未设置 username 和 token 时使用所属节点组的账户
+type AlistNodeSetting struct {
+	ADDR      string  `yaml:"addr"`
+	Username  string  `yaml:"username"`
+	Password  string  `yaml:"password"`
+	Token     *string `yaml:"token"`
+	OTPSecret string  `yaml:"otp_secret"`
+	Weight    int     `yaml:"weight"`
+}
+
+// Alist 节点健康检查设置
+type AlistHealthCheckSetting struct {
+	Interval time.Duration `yaml:"interval"` // 检查间隔，默认为 30 秒
+	Timeout  time.Duration `yaml:"timeout"`  // 请求 Alist API 的超时时间，默认为 10 秒
+}
+
+// Strm 内容重写规则
+type RewriteSetting struct {
+	Regexp   string   `yaml:"regexp" expand:"false"`  // 匹配 Strm 内容的正则表达式
+	Replace  string   `yaml:"replace" expand:"false"` // 替换内容，支持 $1、${name} 引用分组（不进行环境变量替换）
+	UAList   []string `yaml:"ua_list" expand:"false"` // 仅对 User-Agent 包含其中任意一项的客户端生效，为空表示不限制
+	CIDRList []string `yaml:"cidr_list"`              // 仅对来源 IP 属于其中任意一个网段的客户端生效，为空表示不限制；以 ! 开头表示排除该网段
+}
+
+// 本地路径映射设置
+type PathMapSetting struct {
+	Local string `yaml:"local"` // 媒体服务器中的路径前缀
+	Alist string `yaml:"alist"` // 对应的 Alist 路径前缀
 }
 
 // AlistStrm播放设置
 type AlistStrmSetting struct {
-	Enable    bool           `yaml:"enable"`
-	TransCode bool           `yaml:"transcode"` // false->强制关闭转码 true->保持原有转码设置
-	RawURL    bool           `yaml:"raw_url"`   // 是否使用原始 URL
-	List      []AlistSetting `yaml:"list"`
+	Enable      bool                    `yaml:"enable"`
+	TransCode   bool                    `yaml:"transcode"`               // false->强制关闭转码 true->保持原有转码设置
+	RawURL      bool                    `yaml:"raw_url"`                 // 是否使用原始 URL
+	Mode        constants.StreamMode    `yaml:"mode"`                    // redirect->302 重定向 proxy->代理媒体流
+	ProxyUAList []string                `yaml:"proxy_ua" expand:"false"` // User-Agent 匹配其中任意一个正则表达式的客户端使用代理模式
+	List        []AlistSetting          `yaml:"list"`
+	HealthCheck AlistHealthCheckSetting `yaml:"health_check"` // 节点健康检查
+}
+
+// Strm 同步设置
+//
+// 遍历 Alist 目录，在本地生成内容为 Alist 路径的 Strm 文件，并复制字幕、NFO、海报等附属文件
+type StrmSyncSetting struct {
+	Enable         bool                  `yaml:"enable"`      // 启用定时同步（mediawarp strm sync 命令不受影响）
+	Interval       time.Duration         `yaml:"interval"`    // 定时同步间隔，默认为 6 小时
+	Concurrency    int                   `yaml:"concurrency"` // 同时请求 Alist 的数量，默认为 4
+	VideoExtList   []string              `yaml:"video_ext"`   // 生成 Strm 文件的视频扩展名，为空时使用默认列表
+	SidecarExtList []string              `yaml:"sidecar_ext"` // 复制到本地的附属文件扩展名，为空时使用默认列表
+	Delete         bool                  `yaml:"delete"`      // 删除 Alist 中已不存在的 Strm 文件和附属文件（只删除同步生成的文件）
+	Tasks          []StrmSyncTaskSetting `yaml:"tasks"`
+}
+
+// Strm 同步任务
+type StrmSyncTaskSetting struct {
+	Name   string `yaml:"name"`   // 任务名称，用于日志和命令行指定任务，默认为 source
+	Alist  string `yaml:"alist"`  // Alist 地址，需要与 alist_strm.list 中的 addr 一致
+	Source string `yaml:"source"` // Alist 目录
+	Target string `yaml:"target"` // 本地目录，媒体服务器中对应的路径应当在 Alist 的 prefix_list 中
+}
+
+// 任务名称
+func (t *StrmSyncTaskSetting) TaskName() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Source
+}
+
+// 代理媒体流设置
+type ProxyStreamSetting struct {
+	Connections int   `yaml:"connections"` // 并发连接数，小于等于 1 时不启用多连接分块下载
+	ChunkSize   int64 `yaml:"chunk_size"`  // 分块大小（MB）
+	BufferSize  int64 `yaml:"buffer_size"` // 预读缓冲区大小（MB），至少可以容纳 connections 个分块
+	Retry       int   `yaml:"retry"`       // 分块下载失败重试次数
+}
+
+// 限流设置
+type RateLimitSetting struct {
+	Enable   bool          `yaml:"enable"`
+	Playback RateLimitRule `yaml:"playback"` // 播放请求（PlaybackInfo、视频流）
+	Image    RateLimitRule `yaml:"image"`    // 图片请求
+	API      RateLimitRule `yaml:"api"`      // 其他转发至媒体服务器的请求（不包括 Web 静态资源）
+}
+
+// 令牌桶限流规则
+type RateLimitRule struct {
+	Rate  float64                `yaml:"rate"`  // 平均每秒允许的请求数，小于等于 0 表示不限制
+	Burst int                    `yaml:"burst"` // 允许的突发请求数，小于 1 时取 rate
+	Key   constants.RateLimitKey `yaml:"key"`   // 限流维度：ip、device、user
+}
+
+// 播放会话设置
+type SessionSetting struct {
+	Enable       bool           `yaml:"enable"`
+	MaxPerUser   int            `yaml:"max_per_user"`   // 每个用户同时播放 Strm 的数量上限，0 表示不限制
+	MaxPerDevice int            `yaml:"max_per_device"` // 每个设备同时播放 Strm 的数量上限，0 表示不限制
+	UserLimits   map[string]int `yaml:"user_limits"`    // 单独设置部分用户的数量上限（用户 ID -> 数量上限）
+	IdleTimeout  time.Duration  `yaml:"idle_timeout"`   // 未收到播放进度时会话的过期时间
+}
+
+// 管理 API 设置
+type APISetting struct {
+	Enable bool   `yaml:"enable"`
+	Key    string `yaml:"key"` // 访问密钥
+}
+
+// Prometheus 指标设置
+type MetricsSetting struct {
+	Enable bool   `yaml:"enable"`
+	Key    string `yaml:"key"` // 访问密钥，为空时不需要认证（与管理 API 的密钥相互独立）
 }
 
 // 字幕设置
 type SubtitleSetting struct {
 	Enable   bool     `yaml:"enable"`
 	SRT2ASS  bool     `yaml:"srt2ass"` // SRT 字幕转 ASS 字幕
-	ASSStyle []string `yaml:"ass_style"`
-	SubSet   bool     `yaml:"subset"` // ASS 字幕字体子集化
+	ASSStyle []string `yaml:"ass_style" expand:"false"`
+	SubSet   bool     `yaml:"subset"`   // ASS 字幕字体子集化
+	FontDir  string   `yaml:"font_dir"` // 字体子集化使用的本地字体库目录
 }
 
 type Setting struct {
-	Port         uint16              `yaml:"port"`
-	MediaServer  MediaServerSetting  `yaml:"server"`
-	Logger       LoggerSetting       `yaml:"log"`
-	Cache        CacheSetting        `yaml:"cache"`
-	Web          WebSetting          `yaml:"web"`
-	ClientFilter ClientFilterSetting `yaml:"client"`
-	HTTPStrm     HTTPStrmSetting     `yaml:"http_strm"`
-	AlistStrm    AlistStrmSetting    `yaml:"alist_strm"`
-	Subtitle     SubtitleSetting     `yaml:"subtitle"`
+	Port            uint16              `yaml:"port"`
+	ListenList      []ListenSetting     `yaml:"listen"`           // 监听地址列表，为空时监听所有网卡的 port 端口
+	TrustedProxies  []string            `yaml:"trusted_proxies"`  // 可信代理网段，只有来自这些地址的 X-Forwarded-For、X-Real-IP 才会被用于获取客户端 IP，未设置时信任所有代理，设置为空列表时不信任任何代理
+	ShutdownTimeout time.Duration       `yaml:"shutdown_timeout"` // 退出时等待活动请求完成的最长时间
+	MediaServer     MediaServerSetting  `yaml:"server"`
+	Logger          LoggerSetting       `yaml:"log"`
+	Cache           CacheSetting        `yaml:"cache"`
+	Web             WebSetting          `yaml:"web"`
+	ClientFilter    ClientFilterSetting `yaml:"client"`
+	HTTPStrm        HTTPStrmSetting     `yaml:"http_strm"`
+	AlistStrm       AlistStrmSetting    `yaml:"alist_strm"`
+	Subtitle        SubtitleSetting     `yaml:"subtitle"`
+	StrmSync        StrmSyncSetting     `yaml:"strm_sync"`
+	ProxyStream     ProxyStreamSetting  `yaml:"proxy_stream"`
+	RateLimit       RateLimitSetting    `yaml:"rate_limit"`
+	Session         SessionSetting      `yaml:"session"`
+	API             APISetting          `yaml:"api"`
+	Metrics         MetricsSetting      `yaml:"metrics"`
 }
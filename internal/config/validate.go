@@ -0,0 +1,537 @@
+package config
+
+import (
+	"MediaWarp/constants"
+	"MediaWarp/utils"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// 配置文件中的问题
+type Problem struct {
+	Line    int    // YAML 行号，为 0 表示无法确定
+	Message string // 问题描述
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("第 %d 行: %s", p.Line, p.Message)
+	}
+	return p.Message
+}
+
+// 配置校验错误
+//
+// 包含配置文件中发现的所有问题
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems)+1)
+	lines = append(lines, fmt.Sprintf("配置文件存在 %d 个问题:", len(e.Problems)))
+	for _, problem := range e.Problems {
+		lines = append(lines, "  "+problem.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 检查配置文件
+//
+// 严格解析配置文件（拒绝未知的配置项）并校验配置内容，不会修改当前配置，也不会创建任何目录
+func Check(path string) error {
+	_, err := loadConfig(path)
+	return err
+}
+
+// 严格解析并校验配置文件内容
+//
+// 依次应用环境变量覆盖、检查未知的配置项、替换环境变量和文件引用，最后解析并校验配置
+func parseConfig(data []byte) (*Setting, error) {
+	var (
+		s    Setting
+		root yaml.Node
+	)
+	if err := yaml.Unmarshal(data, &root); err != nil { // YAML 语法错误
+		return nil, &ValidationError{Problems: []Problem{parseYAMLError(err.Error())}}
+	}
+	if root.Kind != yaml.DocumentNode { // 空配置文件
+		root = yaml.Node{Kind: yaml.DocumentNode}
+	}
+
+	v := validator{root: &root}
+	v.applyEnvOverrides(os.Environ())
+	v.resolve(&root, settingType, nil, true)
+	if err := root.Decode(&s); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, &ValidationError{Problems: []Problem{parseYAMLError(err.Error())}}
+		}
+		for _, msg := range typeErr.Errors {
+			v.problems = append(v.problems, parseYAMLError(msg))
+		}
+	}
+
+	v.validate(&s)
+	if len(v.problems) > 0 {
+		return nil, &ValidationError{Problems: v.problems}
+	}
+	return &s, nil
+}
+
+// 将 yaml 解析错误转换为带有行号的问题
+func parseYAMLError(msg string) Problem {
+	if matches := yamlLinePattern.FindStringSubmatch(msg); matches != nil {
+		line, _ := strconv.Atoi(matches[1])
+		return Problem{Line: line, Message: matches[2]}
+	}
+	return Problem{Message: strings.TrimPrefix(msg, "yaml: ")}
+}
+
+// 配置内容校验器
+type validator struct {
+	root     *yaml.Node
+	problems []Problem
+}
+
+// 记录问题
+//
+// path 为配置项在 YAML 中的路径，元素为映射的键（string）或者序列的下标（int）
+func (v *validator) add(path []any, format string, args ...any) {
+	v.problems = append(v.problems, Problem{
+		Line:    v.line(path),
+		Message: fmt.Sprintf("%s: %s", formatPath(path), fmt.Sprintf(format, args...)),
+	})
+}
+
+// 查找配置项所在的行号
+//
+// 配置项不存在时返回最近的上级配置项所在的行号
+func (v *validator) line(path []any) int {
+	node := v.root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := 0
+	for _, elem := range path {
+		var next *yaml.Node
+		switch key := elem.(type) {
+		case string:
+			if node.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(node.Content); i += 2 {
+					if node.Content[i].Value == key {
+						next = node.Content[i+1]
+						break
+					}
+				}
+			}
+		case int:
+			if node.Kind == yaml.SequenceNode && key < len(node.Content) {
+				next = node.Content[key]
+			}
+		}
+		if next == nil {
+			break
+		}
+		node, line = next, next.Line
+	}
+	return line
+}
+
+// 格式化配置项路径，如 alist_strm.list[0].addr
+func formatPath(path []any) string {
+	var builder strings.Builder
+	for _, elem := range path {
+		switch key := elem.(type) {
+		case string:
+			if builder.Len() > 0 {
+				builder.WriteByte('.')
+			}
+			builder.WriteString(key)
+		case int:
+			fmt.Fprintf(&builder, "[%d]", key)
+		}
+	}
+	return builder.String()
+}
+
+// 在路径后追加元素，返回新的路径
+func subPath(path []any, elems ...any) []any {
+	return append(append(make([]any, 0, len(path)+len(elems)), path...), elems...)
+}
+
+// 校验配置内容
+func (v *validator) validate(s *Setting) {
+	if s.Port == 0 && len(s.ListenList) == 0 {
+		v.add([]any{"port"}, "监听端口不能为空")
+	}
+	v.validateListenList([]any{"listen"}, s.ListenList)
+	if s.ShutdownTimeout < 0 {
+		v.add([]any{"shutdown_timeout"}, "等待时间不能为负数")
+	}
+	v.validateURL([]any{"server", "addr"}, s.MediaServer.ADDR)
+	for index, cidr := range s.TrustedProxies {
+		if _, err := utils.ParsePrefix(cidr); err != nil {
+			v.add([]any{"trusted_proxies", index}, "网段 %s 错误: %v", cidr, err)
+		}
+	}
+	if s.ClientFilter.Enable {
+		for index, rule := range s.ClientFilter.Rules {
+			rulePath := []any{"client", "rules", index}
+			if rule.Action == constants.FilterUnset {
+				v.add(subPath(rulePath, "action"), "未设置规则动作（allow 或 deny）")
+			}
+			v.validateCIDRList(subPath(rulePath, "source_list"), rule.SourceList)
+			v.validateCIDRList(subPath(rulePath, "client_ip_list"), rule.ClientIPList)
+			for _, field := range []struct{ key, expr string }{{"ua", rule.UA}, {"client", rule.Client}, {"device_name", rule.DeviceName}, {"path", rule.Path}} {
+				if _, err := regexp.Compile(field.expr); err != nil {
+					v.add(subPath(rulePath, field.key), "正则表达式 %s 错误: %v", field.expr, err)
+				}
+			}
+		}
+	}
+
+	if s.HTTPStrm.Enable {
+		path := []any{"http_strm"}
+		v.validatePrefixList(subPath(path, "prefix_list"), s.HTTPStrm.PrefixList)
+		v.validateRewriteList(subPath(path, "rewrite"), s.HTTPStrm.RewriteList)
+		v.validateRegexpList(subPath(path, "proxy_ua"), s.HTTPStrm.ProxyUAList)
+	}
+	if s.AlistStrm.Enable {
+		path := []any{"alist_strm"}
+		v.validateRegexpList(subPath(path, "proxy_ua"), s.AlistStrm.ProxyUAList)
+		for index, alistSetting := range s.AlistStrm.List {
+			itemPath := subPath(path, "list", index)
+			v.validateURL(subPath(itemPath, "addr"), alistSetting.ADDR)
+			v.validatePrefixList(subPath(itemPath, "prefix_list"), alistSetting.PrefixList)
+			v.validateAlistNode(itemPath, alistSetting.OTPSecret, alistSetting.Weight)
+			endpoints := map[string]struct{}{utils.GetEndpoint(alistSetting.ADDR): {}}
+			for nodeIndex, node := range alistSetting.Nodes {
+				nodePath := subPath(itemPath, "nodes", nodeIndex)
+				v.validateURL(subPath(nodePath, "addr"), node.ADDR)
+				v.validateAlistNode(nodePath, node.OTPSecret, node.Weight)
+				if _, ok := endpoints[utils.GetEndpoint(node.ADDR)]; ok && node.ADDR != "" {
+					v.add(subPath(nodePath, "addr"), "节点地址 %s 重复", node.ADDR)
+				}
+				endpoints[utils.GetEndpoint(node.ADDR)] = struct{}{}
+			}
+			for mapIndex, pathMap := range alistSetting.PathMapList {
+				if pathMap.Local == "" {
+					v.add(subPath(itemPath, "path_map", mapIndex, "local"), "本地路径前缀不能为空")
+				}
+				if pathMap.Alist == "" {
+					v.add(subPath(itemPath, "path_map", mapIndex, "alist"), "Alist 路径前缀不能为空")
+				}
+			}
+			for passwordIndex, folderPassword := range alistSetting.FolderPasswordList {
+				if !strings.HasPrefix(folderPassword.Path, "/") {
+					v.add(subPath(itemPath, "folder_password", passwordIndex, "path"), "目录路径 %q 必须以 / 开头", folderPassword.Path)
+				}
+				if folderPassword.Password == "" {
+					v.add(subPath(itemPath, "folder_password", passwordIndex, "password"), "目录密码不能为空")
+				}
+			}
+			v.validateRewriteList(subPath(itemPath, "rewrite"), alistSetting.RewriteList)
+		}
+		if s.AlistStrm.HealthCheck.Interval < 0 {
+			v.add(subPath(path, "health_check", "interval"), "检查间隔不能为负数")
+		}
+		if s.AlistStrm.HealthCheck.Timeout < 0 {
+			v.add(subPath(path, "health_check", "timeout"), "超时时间不能为负数")
+		}
+	}
+	v.validatePrefixOverlap(s)
+	v.validateStrmSync([]any{"strm_sync"}, s)
+
+	if s.ProxyStream.ChunkSize < 0 {
+		v.add([]any{"proxy_stream", "chunk_size"}, "分块大小不能为负数")
+	}
+	if s.ProxyStream.BufferSize < 0 {
+		v.add([]any{"proxy_stream", "buffer_size"}, "预读缓冲区大小不能为负数")
+	}
+	if s.ProxyStream.Retry < 0 {
+		v.add([]any{"proxy_stream", "retry"}, "重试次数不能为负数")
+	}
+	for _, rule := range []struct {
+		name string
+		rule RateLimitRule
+	}{
+		{"playback", s.RateLimit.Playback},
+		{"image", s.RateLimit.Image},
+		{"api", s.RateLimit.API},
+	} {
+		if rule.rule.Rate < 0 {
+			v.add([]any{"rate_limit", rule.name, "rate"}, "请求速率不能为负数")
+		}
+		if rule.rule.Burst < 0 {
+			v.add([]any{"rate_limit", rule.name, "burst"}, "突发请求数不能为负数")
+		}
+	}
+	if s.Cache.Disk.MaxSize < 0 {
+		v.add([]any{"cache", "disk", "max_size"}, "最大占用空间不能为负数")
+	}
+	if s.Session.MaxPerUser < 0 {
+		v.add([]any{"session", "max_per_user"}, "数量上限不能为负数")
+	}
+	if s.Session.MaxPerDevice < 0 {
+		v.add([]any{"session", "max_per_device"}, "数量上限不能为负数")
+	}
+	for _, userID := range slices.Sorted(maps.Keys(s.Session.UserLimits)) {
+		if s.Session.UserLimits[userID] < 0 {
+			v.add([]any{"session", "user_limits", userID}, "数量上限不能为负数")
+		}
+	}
+	if s.Session.IdleTimeout < 0 {
+		v.add([]any{"session", "idle_timeout"}, "过期时间不能为负数")
+	}
+	if s.API.Enable && s.API.Key == "" {
+		v.add([]any{"api", "key"}, "启用管理 API 时必须设置访问密钥")
+	}
+
+	if s.Subtitle.Enable && s.Subtitle.SRT2ASS {
+		v.validateASSStyle([]any{"subtitle", "ass_style"}, s.Subtitle.ASSStyle)
+	}
+}
+
+// 校验 Strm 同步设置
+//
+// 生成的 Strm 文件需要通过 AlistStrm 播放，任务使用的 Alist 必须在 alist_strm.list 中
+func (v *validator) validateStrmSync(path []any, s *Setting) {
+	if s.StrmSync.Interval < 0 {
+		v.add(subPath(path, "interval"), "同步间隔不能为负数")
+	}
+	if s.StrmSync.Concurrency < 0 {
+		v.add(subPath(path, "concurrency"), "并发数量不能为负数")
+	}
+	if s.StrmSync.Enable && len(s.StrmSync.Tasks) == 0 {
+		v.add(subPath(path, "tasks"), "启用定时同步时至少需要一个同步任务")
+	}
+	for _, field := range []struct {
+		key     string
+		extList []string
+	}{
+		{"video_ext", s.StrmSync.VideoExtList},
+		{"sidecar_ext", s.StrmSync.SidecarExtList},
+	} {
+		for index, ext := range field.extList {
+			if ext = strings.TrimPrefix(ext, "."); ext == "" || strings.ContainsAny(ext, `/\.`) {
+				v.add(subPath(path, field.key, index), "扩展名 %q 格式错误", field.extList[index])
+			} else if strings.EqualFold(ext, "strm") {
+				v.add(subPath(path, field.key, index), "不能使用 strm 扩展名")
+			}
+		}
+	}
+
+	endpoints := make(map[string]struct{})
+	if s.AlistStrm.Enable {
+		for _, alistSetting := range s.AlistStrm.List {
+			endpoints[utils.GetEndpoint(alistSetting.ADDR)] = struct{}{}
+		}
+	}
+	names := make(map[string]int)
+	for index, task := range s.StrmSync.Tasks {
+		taskPath := subPath(path, "tasks", index)
+		if _, ok := endpoints[utils.GetEndpoint(task.Alist)]; !ok {
+			v.add(subPath(taskPath, "alist"), "Alist %q 未在已启用的 alist_strm.list 中配置", task.Alist)
+		}
+		if !strings.HasPrefix(task.Source, "/") {
+			v.add(subPath(taskPath, "source"), "Alist 目录 %q 必须以 / 开头", task.Source)
+		}
+		if task.Target == "" {
+			v.add(subPath(taskPath, "target"), "本地目录不能为空")
+		}
+		if first, ok := names[task.TaskName()]; ok {
+			v.add(subPath(taskPath, "name"), "任务名称 %s 与 tasks[%d] 重复", task.TaskName(), first)
+		} else {
+			names[task.TaskName()] = index
+		}
+	}
+}
+
+// 校验监听地址列表
+func (v *validator) validateListenList(path []any, listenList []ListenSetting) {
+	addrs := make(map[string]int)
+	for index, listen := range listenList {
+		itemPath := subPath(path, index)
+		if listen.Addr == "" {
+			v.add(subPath(itemPath, "addr"), "监听地址不能为空")
+		} else if !strings.HasPrefix(listen.Addr, "unix:") {
+			if _, _, err := net.SplitHostPort(listen.Addr); err != nil {
+				v.add(subPath(itemPath, "addr"), "监听地址 %s 格式错误: %v", listen.Addr, err)
+			}
+		}
+		if first, ok := addrs[listen.Addr]; ok {
+			v.add(subPath(itemPath, "addr"), "监听地址 %s 与 listen[%d] 重复", listen.Addr, first)
+		} else {
+			addrs[listen.Addr] = index
+		}
+
+		if (listen.CertFile == "") != (listen.KeyFile == "") {
+			v.add(itemPath, "cert_file 和 key_file 需要同时设置")
+		} else if listen.TLS() {
+			if _, err := tls.LoadX509KeyPair(listen.CertFile, listen.KeyFile); err != nil {
+				v.add(subPath(itemPath, "cert_file"), "加载 TLS 证书失败: %v", err)
+			}
+		}
+	}
+}
+
+// 校验 Alist 节点的 TOTP 密钥和权重
+func (v *validator) validateAlistNode(path []any, otpSecret string, weight int) {
+	if otpSecret != "" {
+		if _, err := utils.ParseTOTPSecret(otpSecret); err != nil {
+			v.add(subPath(path, "otp_secret"), "%v", err)
+		}
+	}
+	if weight < 0 {
+		v.add(subPath(path, "weight"), "权重不能为负数")
+	}
+}
+
+// 校验 HTTP(S) 地址
+func (v *validator) validateURL(path []any, rawURL string) {
+	if rawURL == "" {
+		v.add(path, "地址不能为空")
+		return
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		v.add(path, "地址 %s 格式错误: %v", rawURL, err)
+		return
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		v.add(path, "地址 %s 必须以 http:// 或 https:// 开头", rawURL)
+		return
+	}
+	if u.Host == "" {
+		v.add(path, "地址 %s 缺少主机名", rawURL)
+	}
+}
+
+// 校验 Strm 前缀列表
+func (v *validator) validatePrefixList(path []any, prefixList []string) {
+	for index, prefix := range prefixList {
+		if prefix == "" {
+			v.add(subPath(path, index), "前缀不能为空（会匹配所有文件）")
+		}
+	}
+}
+
+// 校验正则表达式列表
+func (v *validator) validateRegexpList(path []any, regexpList []string) {
+	for index, expr := range regexpList {
+		if _, err := regexp.Compile(expr); err != nil {
+			v.add(subPath(path, index), "正则表达式 %s 错误: %v", expr, err)
+		}
+	}
+}
+
+// 校验 Strm 内容重写规则
+func (v *validator) validateRewriteList(path []any, rewriteList []RewriteSetting) {
+	for index, rewrite := range rewriteList {
+		rulePath := subPath(path, index)
+		if _, err := regexp.Compile(rewrite.Regexp); err != nil {
+			v.add(subPath(rulePath, "regexp"), "正则表达式 %s 错误: %v", rewrite.Regexp, err)
+		}
+		v.validateCIDRList(subPath(rulePath, "cidr_list"), rewrite.CIDRList)
+	}
+}
+
+// 校验网段列表
+func (v *validator) validateCIDRList(path []any, cidrList []string) {
+	for index, cidr := range cidrList {
+		if _, err := utils.ParsePrefix(strings.TrimPrefix(cidr, "!")); err != nil {
+			v.add(subPath(path, index), "网段 %s 错误: %v", cidr, err)
+		}
+	}
+}
+
+// 校验 HTTPStrm 与 AlistStrm（以及不同 Alist 服务器之间）的前缀是否重叠
+//
+// 前缀重叠时文件只会匹配到第一个符合的规则，通常是配置错误
+func (v *validator) validatePrefixOverlap(s *Setting) {
+	type prefixItem struct {
+		owner  string // 前缀所属的规则
+		group  int    // 同一个规则中的前缀不检查重叠
+		prefix string
+		path   []any
+	}
+	var items []prefixItem
+	if s.HTTPStrm.Enable {
+		for index, prefix := range s.HTTPStrm.PrefixList {
+			items = append(items, prefixItem{"http_strm", -1, prefix, []any{"http_strm", "prefix_list", index}})
+		}
+	}
+	if s.AlistStrm.Enable {
+		for listIndex, alistSetting := range s.AlistStrm.List {
+			owner := fmt.Sprintf("alist_strm（%s）", alistSetting.ADDR)
+			for index, prefix := range alistSetting.PrefixList {
+				items = append(items, prefixItem{owner, listIndex, prefix, []any{"alist_strm", "list", listIndex, "prefix_list", index}})
+			}
+		}
+	}
+
+	for i := range items {
+		for j := range i {
+			a, b := items[j], items[i]
+			if a.group == b.group || a.prefix == "" || b.prefix == "" {
+				continue
+			}
+			if strings.HasPrefix(a.prefix, b.prefix) || strings.HasPrefix(b.prefix, a.prefix) {
+				v.add(b.path, "前缀 %s 与 %s 的前缀 %s 重叠（第 %d 行）", b.prefix, a.owner, a.prefix, v.line(a.path))
+			}
+		}
+	}
+}
+
+// 校验 ASS 样式
+//
+// 第一行必须为 Format 行，其余为 Style 行，并且 Style 行的字段数量与 Format 行一致
+func (v *validator) validateASSStyle(path []any, styleList []string) {
+	if len(styleList) == 0 {
+		v.add(path, "SRT 字幕转 ASS 字幕需要设置样式")
+		return
+	}
+	fieldCount := 0
+	for index, line := range styleList {
+		key, value, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		switch {
+		case !ok:
+			v.add(subPath(path, index), "样式行 %q 格式错误，应当为 Format: ... 或 Style: ...", line)
+		case index == 0:
+			if key != "Format" {
+				v.add(subPath(path, index), "第一行必须为 Format 行")
+				continue
+			}
+			fields := strings.Split(value, ",")
+			fieldCount = len(fields)
+			hasName := false
+			for _, field := range fields {
+				if strings.TrimSpace(field) == "Name" {
+					hasName = true
+				}
+			}
+			if !hasName {
+				v.add(subPath(path, index), "Format 行缺少 Name 字段")
+			}
+		case key != "Style":
+			v.add(subPath(path, index), "样式行 %q 格式错误，应当为 Style: ...", line)
+		case fieldCount > 0 && len(strings.Split(value, ",")) != fieldCount:
+			v.add(subPath(path, index), "Style 行有 %d 个字段，与 Format 行的 %d 个字段不一致", len(strings.Split(value, ",")), fieldCount)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"time"
+)
+
+// 监听配置文件变化
+//
+// 定期检查配置文件，文件修改时间或大小变化并且内容改变时调用 onChange
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	var (
+		modTime time.Time
+		size    int64
+		digest  []byte
+	)
+	if info, err := os.Stat(path); err == nil {
+		modTime, size = info.ModTime(), info.Size()
+		digest = fileDigest(path)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || (info.ModTime().Equal(modTime) && info.Size() == size) {
+			continue
+		}
+		modTime, size = info.ModTime(), info.Size()
+
+		newDigest := fileDigest(path)
+		if newDigest == nil || bytes.Equal(newDigest, digest) { // 仅修改时间变化，内容未改变
+			continue
+		}
+		digest = newDigest
+		onChange()
+	}
+}
+
+// 计算文件内容摘要
+func fileDigest(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
@@ -0,0 +1,460 @@
+package fonts
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// CFF DICT 操作符（双字节操作符为 1200 + 第二个字节）
+const (
+	cffOpCharset     = 15
+	cffOpEncoding    = 16
+	cffOpCharStrings = 17
+	cffOpPrivate     = 18
+	cffOpSubrs       = 19
+	cffOpFDArray     = 1236
+	cffOpFDSelect    = 1237
+)
+
+// 空字形的 Type 2 CharString（endchar）
+var cffEmptyCharString = []byte{14}
+
+// CFF DICT 中的一项
+type cffDictEntry struct {
+	op       int
+	operands []byte // 原始操作数
+	values   []int  // 整数操作数，实数操作数为 0
+}
+
+// 解析 CFF INDEX，返回其中的数据和 INDEX 结束的位置
+func parseCFFIndex(data []byte, offset int) ([][]byte, int, error) {
+	if offset < 0 || offset+2 > len(data) {
+		return nil, 0, fmt.Errorf("%w: CFF INDEX 越界", ErrInvalidFont)
+	}
+	count := int(binary.BigEndian.Uint16(data[offset:]))
+	if count == 0 {
+		return nil, offset + 2, nil
+	}
+	if offset+3 > len(data) {
+		return nil, 0, fmt.Errorf("%w: CFF INDEX 越界", ErrInvalidFont)
+	}
+	offSize := int(data[offset+2])
+	if offSize < 1 || offSize > 4 || offset+3+(count+1)*offSize > len(data) {
+		return nil, 0, fmt.Errorf("%w: CFF INDEX 偏移量错误", ErrInvalidFont)
+	}
+	readOffset := func(i int) int {
+		var value int
+		for _, b := range data[offset+3+i*offSize : offset+3+(i+1)*offSize] {
+			value = value<<8 | int(b)
+		}
+		return value
+	}
+
+	base := offset + 3 + (count+1)*offSize - 1 // 偏移量从 1 开始
+	items := make([][]byte, count)
+	for i := range count {
+		start, end := base+readOffset(i), base+readOffset(i+1)
+		if start > end || end > len(data) {
+			return nil, 0, fmt.Errorf("%w: CFF INDEX 数据越界", ErrInvalidFont)
+		}
+		items[i] = data[start:end]
+	}
+	return items, base + readOffset(count), nil
+}
+
+// 构建 CFF INDEX
+func buildCFFIndex(items [][]byte) []byte {
+	if len(items) == 0 {
+		return []byte{0, 0}
+	}
+	size := 1
+	for _, item := range items {
+		size += len(item)
+	}
+	offSize := 1
+	for size >= 1<<(8*offSize) {
+		offSize++
+	}
+
+	out := make([]byte, 3, 3+(len(items)+1)*offSize+size)
+	binary.BigEndian.PutUint16(out, uint16(len(items)))
+	out[2] = byte(offSize)
+	offset := 1
+	for i := 0; i <= len(items); i++ {
+		for shift := 8 * (offSize - 1); shift >= 0; shift -= 8 {
+			out = append(out, byte(offset>>shift))
+		}
+		if i < len(items) {
+			offset += len(items[i])
+		}
+	}
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+// 解析 CFF DICT
+func parseCFFDict(data []byte) ([]cffDictEntry, error) {
+	var (
+		entries []cffDictEntry
+		start   int
+		values  []int
+	)
+	for i := 0; i < len(data); {
+		b0 := int(data[i])
+		switch {
+		case b0 <= 21: // 操作符
+			entry := cffDictEntry{op: b0, operands: data[start:i], values: values}
+			if b0 == 12 {
+				if i+1 >= len(data) {
+					return nil, fmt.Errorf("%w: CFF DICT 操作符不完整", ErrInvalidFont)
+				}
+				entry.op = 1200 + int(data[i+1])
+				i++
+			}
+			entries = append(entries, entry)
+			i++
+			start, values = i, nil
+			continue
+		case b0 == 28:
+			if i+3 > len(data) {
+				return nil, fmt.Errorf("%w: CFF DICT 操作数不完整", ErrInvalidFont)
+			}
+			values = append(values, int(int16(binary.BigEndian.Uint16(data[i+1:]))))
+			i += 3
+		case b0 == 29:
+			if i+5 > len(data) {
+				return nil, fmt.Errorf("%w: CFF DICT 操作数不完整", ErrInvalidFont)
+			}
+			values = append(values, int(int32(binary.BigEndian.Uint32(data[i+1:]))))
+			i += 5
+		case b0 == 30: // 实数，以半字节 0xf 结束
+			for i++; i < len(data); i++ {
+				if data[i]&0x0f == 0x0f || data[i]>>4 == 0x0f {
+					break
+				}
+			}
+			if i >= len(data) {
+				return nil, fmt.Errorf("%w: CFF DICT 实数不完整", ErrInvalidFont)
+			}
+			values = append(values, 0)
+			i++
+		case b0 >= 32 && b0 <= 246:
+			values = append(values, b0-139)
+			i++
+		case b0 >= 247 && b0 <= 254:
+			if i+2 > len(data) {
+				return nil, fmt.Errorf("%w: CFF DICT 操作数不完整", ErrInvalidFont)
+			}
+			if b0 <= 250 {
+				values = append(values, (b0-247)*256+int(data[i+1])+108)
+			} else {
+				values = append(values, -(b0-251)*256-int(data[i+1])-108)
+			}
+			i += 2
+		default:
+			return nil, fmt.Errorf("%w: CFF DICT 中的无效字节 %d", ErrInvalidFont, b0)
+		}
+	}
+	return entries, nil
+}
+
+// 获取 DICT 中操作符的整数操作数
+func cffDictValues(entries []cffDictEntry, op int) ([]int, bool) {
+	for _, entry := range entries {
+		if entry.op == op {
+			return entry.values, true
+		}
+	}
+	return nil, false
+}
+
+// 构建 CFF DICT
+//
+// replaced 中的操作符使用新的操作数，统一编码为 5 字节整数，使 DICT 长度与取值无关
+func buildCFFDict(entries []cffDictEntry, replaced map[int][]int) []byte {
+	var out []byte
+	for _, entry := range entries {
+		if values, ok := replaced[entry.op]; ok {
+			for _, value := range values {
+				out = append(out, 29)
+				out = binary.BigEndian.AppendUint32(out, uint32(int32(value)))
+			}
+		} else {
+			out = append(out, entry.operands...)
+		}
+		if entry.op >= 1200 {
+			out = append(out, 12, byte(entry.op-1200))
+		} else {
+			out = append(out, byte(entry.op))
+		}
+	}
+	return out
+}
+
+// charset 的长度
+func cffCharsetLength(data []byte, numGlyphs int) (int, error) {
+	if len(data) == 0 {
+		return 0, fmt.Errorf("%w: CFF charset 越界", ErrInvalidFont)
+	}
+	switch data[0] {
+	case 0:
+		return 1 + 2*(numGlyphs-1), nil
+	case 1, 2:
+		nLeftSize := int(data[0])
+		offset := 1
+		for covered := 1; covered < numGlyphs; {
+			if offset+2+nLeftSize > len(data) {
+				return 0, fmt.Errorf("%w: CFF charset 越界", ErrInvalidFont)
+			}
+			nLeft := int(data[offset+2])
+			if nLeftSize == 2 {
+				nLeft = int(binary.BigEndian.Uint16(data[offset+2:]))
+			}
+			covered += nLeft + 1
+			offset += 2 + nLeftSize
+		}
+		return offset, nil
+	}
+	return 0, fmt.Errorf("%w: 未知的 CFF charset 格式 %d", ErrInvalidFont, data[0])
+}
+
+// 自定义 Encoding 的长度
+func cffEncodingLength(data []byte) (int, error) {
+	if len(data) < 2 {
+		return 0, fmt.Errorf("%w: CFF Encoding 越界", ErrInvalidFont)
+	}
+	var length int
+	switch data[0] & 0x7f {
+	case 0:
+		length = 2 + int(data[1])
+	case 1:
+		length = 2 + int(data[1])*2
+	default:
+		return 0, fmt.Errorf("%w: 未知的 CFF Encoding 格式 %d", ErrInvalidFont, data[0]&0x7f)
+	}
+	if data[0]&0x80 != 0 { // 补充编码
+		if length >= len(data) {
+			return 0, fmt.Errorf("%w: CFF Encoding 越界", ErrInvalidFont)
+		}
+		length += 1 + int(data[length])*3
+	}
+	return length, nil
+}
+
+// FDSelect 的长度
+func cffFDSelectLength(data []byte, numGlyphs int) (int, error) {
+	if len(data) == 0 {
+		return 0, fmt.Errorf("%w: CFF FDSelect 越界", ErrInvalidFont)
+	}
+	switch data[0] {
+	case 0:
+		return 1 + numGlyphs, nil
+	case 3:
+		if len(data) < 3 {
+			return 0, fmt.Errorf("%w: CFF FDSelect 越界", ErrInvalidFont)
+		}
+		return 3 + int(binary.BigEndian.Uint16(data[1:]))*3 + 2, nil
+	}
+	return 0, fmt.Errorf("%w: 未知的 CFF FDSelect 格式 %d", ErrInvalidFont, data[0])
+}
+
+// 读取 Private DICT 及其局部子程序
+//
+// values 为 Private 操作符的操作数 [size, offset]；返回新的 Private DICT 和紧随其后的局部子程序 INDEX
+func cffPrivate(cff []byte, values []int) ([]byte, []byte, error) {
+	if len(values) != 2 {
+		return nil, nil, fmt.Errorf("%w: CFF Private 操作数错误", ErrInvalidFont)
+	}
+	size, offset := values[0], values[1]
+	if size < 0 || offset < 0 || offset+size > len(cff) {
+		return nil, nil, fmt.Errorf("%w: CFF Private DICT 越界", ErrInvalidFont)
+	}
+	entries, err := parseCFFDict(cff[offset : offset+size])
+	if err != nil {
+		return nil, nil, err
+	}
+	subrsValues, ok := cffDictValues(entries, cffOpSubrs)
+	if !ok || len(subrsValues) != 1 {
+		return cff[offset : offset+size], nil, nil
+	}
+	subrsOffset := offset + subrsValues[0]
+	_, subrsEnd, err := parseCFFIndex(cff, subrsOffset)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析 CFF 局部子程序失败: %w", err)
+	}
+	dictSize := len(buildCFFDict(entries, map[int][]int{cffOpSubrs: {0}}))
+	dict := buildCFFDict(entries, map[int][]int{cffOpSubrs: {dictSize}}) // 局部子程序的偏移量相对于 Private DICT
+	return dict, cff[subrsOffset:subrsEnd], nil
+}
+
+// CFF 表子集化
+//
+// 未使用的字形替换为空字形，字形数量、charset、FDSelect 保持不变，子程序原样保留。
+// 重新排列 Top DICT 之后的数据，并更新其中的偏移量
+func subsetCFF(cff []byte, keep map[int]struct{}) ([]byte, error) {
+	if len(cff) < 4 || cff[0] != 1 {
+		return nil, fmt.Errorf("%w: 不支持的 CFF 版本", ErrInvalidFont)
+	}
+	_, nameEnd, err := parseCFFIndex(cff, int(cff[2]))
+	if err != nil {
+		return nil, err
+	}
+	topDicts, topEnd, err := parseCFFIndex(cff, nameEnd)
+	if err != nil {
+		return nil, err
+	}
+	if len(topDicts) != 1 {
+		return nil, fmt.Errorf("%w: CFF 表中应当只有一个字体", ErrInvalidFont)
+	}
+	_, stringEnd, err := parseCFFIndex(cff, topEnd)
+	if err != nil {
+		return nil, err
+	}
+	_, globalSubrsEnd, err := parseCFFIndex(cff, stringEnd)
+	if err != nil {
+		return nil, err
+	}
+	topDict, err := parseCFFDict(topDicts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	charStringsValues, ok := cffDictValues(topDict, cffOpCharStrings)
+	if !ok || len(charStringsValues) != 1 {
+		return nil, fmt.Errorf("%w: CFF 表中没有 CharStrings", ErrInvalidFont)
+	}
+	charStrings, _, err := parseCFFIndex(cff, charStringsValues[0])
+	if err != nil {
+		return nil, fmt.Errorf("解析 CFF CharStrings 失败: %w", err)
+	}
+	numGlyphs := len(charStrings)
+	newCharStrings := make([][]byte, numGlyphs)
+	for gid, charString := range charStrings {
+		if _, ok := keep[gid]; ok {
+			newCharStrings[gid] = charString
+		} else {
+			newCharStrings[gid] = cffEmptyCharString
+		}
+	}
+
+	// 需要复制的数据块，按顺序排列在 Global Subr INDEX 之后
+	type section struct {
+		op    int
+		build func(offsets map[int][]int) []byte // 根据其他数据块的偏移量生成数据块
+	}
+	var sections []section
+	copySection := func(op int, length func([]byte) (int, error)) error {
+		values, ok := cffDictValues(topDict, op)
+		if !ok || len(values) != 1 {
+			return nil
+		}
+		offset := values[0]
+		if offset < 0 || offset >= len(cff) {
+			return fmt.Errorf("%w: CFF 数据偏移量越界", ErrInvalidFont)
+		}
+		n, err := length(cff[offset:])
+		if err != nil {
+			return err
+		}
+		if offset+n > len(cff) {
+			return fmt.Errorf("%w: CFF 数据越界", ErrInvalidFont)
+		}
+		data := cff[offset : offset+n]
+		sections = append(sections, section{op: op, build: func(map[int][]int) []byte { return data }})
+		return nil
+	}
+	if values, ok := cffDictValues(topDict, cffOpCharset); ok && len(values) == 1 && values[0] > 2 { // 0~2 为预定义的 charset
+		if err := copySection(cffOpCharset, func(data []byte) (int, error) { return cffCharsetLength(data, numGlyphs) }); err != nil {
+			return nil, err
+		}
+	}
+	if values, ok := cffDictValues(topDict, cffOpEncoding); ok && len(values) == 1 && values[0] > 1 { // 0、1 为预定义的 Encoding
+		if err := copySection(cffOpEncoding, cffEncodingLength); err != nil {
+			return nil, err
+		}
+	}
+	if err := copySection(cffOpFDSelect, func(data []byte) (int, error) { return cffFDSelectLength(data, numGlyphs) }); err != nil {
+		return nil, err
+	}
+	charStringsIndex := buildCFFIndex(newCharStrings)
+	sections = append(sections, section{op: cffOpCharStrings, build: func(map[int][]int) []byte { return charStringsIndex }})
+
+	var privates [][2][]byte // Private DICT 和局部子程序，CID 字体中每个 Font DICT 各有一个
+	if values, ok := cffDictValues(topDict, cffOpFDArray); ok && len(values) == 1 {
+		fontDicts, _, err := parseCFFIndex(cff, values[0])
+		if err != nil {
+			return nil, fmt.Errorf("解析 CFF FDArray 失败: %w", err)
+		}
+		entriesList := make([][]cffDictEntry, len(fontDicts))
+		for i, fontDict := range fontDicts {
+			if entriesList[i], err = parseCFFDict(fontDict); err != nil {
+				return nil, err
+			}
+			privateValues, _ := cffDictValues(entriesList[i], cffOpPrivate)
+			dict, subrs, err := cffPrivate(cff, privateValues)
+			if err != nil {
+				return nil, err
+			}
+			privates = append(privates, [2][]byte{dict, subrs})
+		}
+		sections = append(sections, section{op: cffOpFDArray, build: func(offsets map[int][]int) []byte {
+			items := make([][]byte, len(entriesList))
+			for i, entries := range entriesList {
+				items[i] = buildCFFDict(entries, map[int][]int{cffOpPrivate: offsets[-1-i]})
+			}
+			return buildCFFIndex(items)
+		}})
+	} else if values, ok := cffDictValues(topDict, cffOpPrivate); ok {
+		dict, subrs, err := cffPrivate(cff, values)
+		if err != nil {
+			return nil, err
+		}
+		privates = append(privates, [2][]byte{dict, subrs})
+	}
+	for i, private := range privates { // Private DICT 使用负数作为标识
+		data := append(append([]byte(nil), private[0]...), private[1]...)
+		sections = append(sections, section{op: -1 - i, build: func(map[int][]int) []byte { return data }})
+	}
+
+	// 先使用占位偏移量计算各数据块的长度（DICT 中的偏移量为定长编码），再使用实际偏移量生成
+	offsets := make(map[int][]int)
+	for _, s := range sections {
+		offsets[s.op] = []int{0}
+	}
+	for i := range privates {
+		offsets[-1-i] = []int{0, 0}
+	}
+	buildTopDict := func() []byte {
+		replaced := make(map[int][]int)
+		for op, values := range offsets {
+			if op >= 0 {
+				replaced[op] = values
+			}
+		}
+		if len(privates) == 1 && offsets[cffOpFDArray] == nil {
+			replaced[cffOpPrivate] = offsets[-1]
+		}
+		return buildCFFIndex([][]byte{buildCFFDict(topDict, replaced)})
+	}
+	position := nameEnd + len(buildTopDict()) + (globalSubrsEnd - topEnd)
+	for _, s := range sections {
+		data := s.build(offsets)
+		if s.op < 0 { // Private 的操作数为 [size, offset]
+			offsets[s.op] = []int{len(privates[-1-s.op][0]), position}
+		} else {
+			offsets[s.op] = []int{position}
+		}
+		position += len(data)
+	}
+
+	out := make([]byte, 0, position)
+	out = append(out, cff[:nameEnd]...)
+	out = append(out, buildTopDict()...)
+	out = append(out, cff[topEnd:globalSubrsEnd]...)
+	for _, s := range sections {
+		out = append(out, s.build(offsets)...)
+	}
+	return out, nil
+}
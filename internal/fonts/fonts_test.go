@@ -0,0 +1,477 @@
+package fonts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"unicode/utf16"
+)
+
+// 测试字体的字形
+//
+// 0: .notdef
+// 1: A（简单字形）
+// 2: B（复合字形，引用 3）
+// 3: B 的组件（简单字形）
+// 4: C（简单字形）
+var testGlyphs = [][]byte{
+	simpleGlyph(0xA0),
+	simpleGlyph(0xA1),
+	compositeGlyph(3),
+	simpleGlyph(0xA3),
+	simpleGlyph(0xA4),
+}
+
+// 简单字形（轮廓数据仅用于区分字形）
+func simpleGlyph(marker byte) []byte {
+	data := make([]byte, 12)
+	binary.BigEndian.PutUint16(data, 1) // numberOfContours
+	for i := 10; i < len(data); i++ {
+		data[i] = marker
+	}
+	return data
+}
+
+// 引用单个组件的复合字形
+func compositeGlyph(component uint16) []byte {
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint16(data, 0xFFFF) // numberOfContours = -1
+	binary.BigEndian.PutUint16(data[12:], component)
+	return data
+}
+
+// 构建测试字体
+//
+// outline 为 "glyf" 时构建 TrueType 轮廓字体，为 "CFF " 时构建 CFF 轮廓字体，为 "CID" 时构建 CID 字体（CFF 轮廓）
+func buildTestFont(t *testing.T, family string, bold bool, outline string) []byte {
+	t.Helper()
+
+	head := make([]byte, 54)
+	binary.BigEndian.PutUint32(head[12:], 0x5F0F3CF5) // magicNumber
+	if bold {
+		binary.BigEndian.PutUint16(head[44:], 1) // macStyle
+	}
+
+	maxp := make([]byte, 6)
+	binary.BigEndian.PutUint32(maxp, 0x00005000)
+	binary.BigEndian.PutUint16(maxp[4:], uint16(len(testGlyphs)))
+
+	// cmap 格式 4：A、B 映射到字形 1、2，C 映射到字形 4
+	type segment struct{ start, end, glyph uint16 }
+	segments := []segment{{'A', 'B', 1}, {'C', 'C', 4}, {0xFFFF, 0xFFFF, 0}}
+	segCountX2 := len(segments) * 2
+	subtable := make([]byte, 16+segCountX2*4)
+	binary.BigEndian.PutUint16(subtable[0:], 4)
+	binary.BigEndian.PutUint16(subtable[2:], uint16(len(subtable)))
+	binary.BigEndian.PutUint16(subtable[6:], uint16(segCountX2))
+	for i, seg := range segments {
+		binary.BigEndian.PutUint16(subtable[14+i*2:], seg.end)
+		binary.BigEndian.PutUint16(subtable[16+segCountX2+i*2:], seg.start)
+		delta := seg.glyph - seg.start
+		if seg.start == 0xFFFF {
+			delta = 1
+		}
+		binary.BigEndian.PutUint16(subtable[16+segCountX2*2+i*2:], delta)
+	}
+	cmap := make([]byte, 12, 12+len(subtable))
+	binary.BigEndian.PutUint16(cmap[2:], 1)
+	binary.BigEndian.PutUint16(cmap[4:], 3)
+	binary.BigEndian.PutUint16(cmap[6:], 1)
+	binary.BigEndian.PutUint32(cmap[8:], 12)
+	cmap = append(cmap, subtable...)
+
+	var familyName []byte
+	for _, unit := range utf16.Encode([]rune(family)) {
+		familyName = binary.BigEndian.AppendUint16(familyName, unit)
+	}
+	name := make([]byte, 18, 18+len(familyName))
+	binary.BigEndian.PutUint16(name[2:], 1)
+	binary.BigEndian.PutUint16(name[4:], 18)
+	binary.BigEndian.PutUint16(name[6:], 3)
+	binary.BigEndian.PutUint16(name[8:], 1)
+	binary.BigEndian.PutUint16(name[10:], 0x0409)
+	binary.BigEndian.PutUint16(name[12:], 1)
+	binary.BigEndian.PutUint16(name[14:], uint16(len(familyName)))
+	name = append(name, familyName...)
+
+	tables := map[string][]byte{
+		"head": head,
+		"maxp": maxp,
+		"cmap": cmap,
+		"name": name,
+		"DSIG": make([]byte, 8),
+	}
+	version := uint32(0x00010000)
+	switch outline {
+	case "glyf":
+		var glyf, loca []byte
+		for _, glyph := range testGlyphs {
+			loca = binary.BigEndian.AppendUint16(loca, uint16(len(glyf)/2))
+			glyf = append(glyf, glyph...)
+		}
+		loca = binary.BigEndian.AppendUint16(loca, uint16(len(glyf)/2))
+		tables["glyf"], tables["loca"] = glyf, loca
+	case "CFF ", "CID":
+		version = 0x4F54544F
+		tables["CFF "] = buildTestCFF(outline == "CID")
+	default:
+		t.Fatalf("未知的轮廓类型：%s", outline)
+	}
+
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	data := make([]byte, 12+16*len(tags))
+	binary.BigEndian.PutUint32(data, version)
+	binary.BigEndian.PutUint16(data[4:], uint16(len(tags)))
+	for i, tag := range tags {
+		record := data[12+i*16:]
+		copy(record, tag)
+		binary.BigEndian.PutUint32(record[8:], uint32(len(data)))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(tables[tag])))
+		data = append(data, tables[tag]...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	return data
+}
+
+// 测试 CFF 字体中字形的 CharString（内容仅用于区分字形）
+func testCharString(gid int) []byte {
+	return []byte{byte(0xA0 + gid), 14}
+}
+
+// 测试 CFF 字体的局部子程序
+var testSubrs = buildCFFIndex([][]byte{{0x8B, 11}})
+
+// 5 字节整数操作数
+func dictInt(values ...int) []byte {
+	var out []byte
+	for _, value := range values {
+		out = append(out, 29)
+		out = binary.BigEndian.AppendUint32(out, uint32(int32(value)))
+	}
+	return out
+}
+
+// 构建测试 CFF 表
+//
+// cid 为 true 时构建 CID 字体（包含 charset、FDSelect、FDArray）
+func buildTestCFF(cid bool) []byte {
+	charStrings := make([][]byte, len(testGlyphs))
+	for gid := range charStrings {
+		charStrings[gid] = testCharString(gid)
+	}
+	charStringsIndex := buildCFFIndex(charStrings)
+
+	// Private DICT：BlueScale（实数）、Subrs
+	private := []byte{30, 0x0a, 0x03, 0x9f, 12, 9}
+	private = append(append(private, dictInt(len(private)+6)...), 19)
+
+	var (
+		prefix      = append([]byte{1, 0, 4, 4}, buildCFFIndex([][]byte{[]byte("Test")})...)
+		suffix      = []byte{0, 0, 0, 0} // 空的 String INDEX、Global Subr INDEX
+		topDictSize = 6 + 11
+	)
+	if cid {
+		topDictSize = 17 + 6 + 7 + 6 + 7
+	}
+	base := len(prefix) + len(buildCFFIndex([][]byte{make([]byte, topDictSize)})) + len(suffix)
+
+	var topDict, data []byte
+	if cid {
+		charset := []byte{0}
+		for gid := 1; gid < len(testGlyphs); gid++ {
+			charset = binary.BigEndian.AppendUint16(charset, uint16(gid))
+		}
+		fdSelect := []byte{3, 0, 1, 0, 0, 0, 0, byte(len(testGlyphs))}
+		fdArrayOffset := base + len(charset) + len(fdSelect) + len(charStringsIndex)
+		fdArray := buildCFFIndex([][]byte{append(dictInt(len(private), 0), 18)})
+		fdArray = buildCFFIndex([][]byte{append(dictInt(len(private), fdArrayOffset+len(fdArray)), 18)})
+
+		topDict = append(dictInt(1, 2, 0), 12, 30)
+		topDict = append(append(topDict, dictInt(base)...), 15)
+		topDict = append(append(topDict, dictInt(base+len(charset))...), 12, 37)
+		topDict = append(append(topDict, dictInt(base+len(charset)+len(fdSelect))...), 17)
+		topDict = append(append(topDict, dictInt(fdArrayOffset)...), 12, 36)
+		data = slices.Concat(charset, fdSelect, charStringsIndex, fdArray, private, testSubrs)
+	} else {
+		topDict = append(dictInt(base), 17)
+		topDict = append(append(topDict, dictInt(len(private), base+len(charStringsIndex))...), 18)
+		data = slices.Concat(charStringsIndex, private, testSubrs)
+	}
+	return slices.Concat(prefix, buildCFFIndex([][]byte{topDict}), suffix, data)
+}
+
+// 读取 CFF 字体中的 CharStrings 和 Private DICT 之后的局部子程序
+func cffGlyphs(t *testing.T, font *sfntFont) ([][]byte, []byte) {
+	t.Helper()
+
+	cff, err := font.table("CFF ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, nameEnd, err := parseCFFIndex(cff, int(cff[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	topDicts, _, err := parseCFFIndex(cff, nameEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topDict, err := parseCFFDict(topDicts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, _ := cffDictValues(topDict, cffOpCharStrings)
+	charStrings, _, err := parseCFFIndex(cff, values[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateValues, ok := cffDictValues(topDict, cffOpPrivate)
+	if values, isCID := cffDictValues(topDict, cffOpFDArray); isCID {
+		fontDicts, _, err := parseCFFIndex(cff, values[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fontDict, err := parseCFFDict(fontDicts[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		privateValues, ok = cffDictValues(fontDict, cffOpPrivate)
+	}
+	if !ok {
+		t.Fatal("CFF 字体中没有 Private DICT")
+	}
+	private, err := parseCFFDict(cff[privateValues[1] : privateValues[1]+privateValues[0]])
+	if err != nil {
+		t.Fatal(err)
+	}
+	subrsValues, _ := cffDictValues(private, cffOpSubrs)
+	_, subrsEnd, err := parseCFFIndex(cff, privateValues[1]+subrsValues[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return charStrings, cff[privateValues[1]+subrsValues[0] : subrsEnd]
+}
+
+// 读取字体中指定字形的数据
+func glyphData(t *testing.T, font *sfntFont, gid int) []byte {
+	t.Helper()
+
+	head, err := font.table("head")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loca, err := font.table("loca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	glyf, err := font.table("glyf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var start, end int
+	if binary.BigEndian.Uint16(head[50:]) == 1 {
+		start, end = int(binary.BigEndian.Uint32(loca[gid*4:])), int(binary.BigEndian.Uint32(loca[gid*4+4:]))
+	} else {
+		start, end = int(binary.BigEndian.Uint16(loca[gid*2:]))*2, int(binary.BigEndian.Uint16(loca[gid*2+2:]))*2
+	}
+	data := glyf[start:end]
+	return bytes.TrimRight(data, "\x00") // 去除 4 字节对齐的填充
+}
+
+func TestParseFonts(t *testing.T) {
+	fonts, err := parseFonts(buildTestFont(t, "Test Sans", true, "glyf"))
+	if err != nil {
+		t.Fatalf("解析字体失败：%s", err)
+	}
+	if len(fonts) != 1 {
+		t.Fatalf("字体数量错误，期望：1，实际：%d", len(fonts))
+	}
+	font := fonts[0]
+
+	if names := font.names(); len(names) != 1 || names[0] != "Test Sans" {
+		t.Errorf("字体名称错误，期望：[Test Sans]，实际：%v", names)
+	}
+	if bold, italic := font.style(); !bold || italic {
+		t.Errorf("字体样式错误，期望：粗体，实际：bold=%t italic=%t", bold, italic)
+	}
+	if !font.isTrueType() {
+		t.Error("TrueType 轮廓字体识别错误")
+	}
+
+	lookup, err := font.cmap()
+	if err != nil {
+		t.Fatalf("解析 cmap 失败：%s", err)
+	}
+	cases := map[rune]uint16{'A': 1, 'B': 2, 'C': 4, 'D': 0, '中': 0}
+	for r, want := range cases {
+		if got := lookup(r); got != want {
+			t.Errorf("字符 %q 的字形索引错误，期望：%d，实际：%d", r, want, got)
+		}
+	}
+
+	if _, err := parseFonts([]byte("not a font file")); !errors.Is(err, ErrInvalidFont) {
+		t.Errorf("无效字体应返回 ErrInvalidFont，实际：%v", err)
+	}
+}
+
+func TestSubset(t *testing.T) {
+	cases := map[string]struct {
+		runes []rune
+		keep  []int
+	}{
+		"简单字形":      {runes: []rune("A"), keep: []int{0, 1}},
+		"复合字形及组件":   {runes: []rune("B"), keep: []int{0, 2, 3}},
+		"多个字符":      {runes: []rune("CAC"), keep: []int{0, 1, 4}},
+		"字体中不存在的字符": {runes: []rune("中"), keep: []int{0}},
+	}
+
+	fonts, err := parseFonts(buildTestFont(t, "Test Sans", false, "glyf"))
+	if err != nil {
+		t.Fatalf("解析字体失败：%s", err)
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			data, err := fonts[0].subset(c.runes)
+			if err != nil {
+				t.Fatalf("子集化失败：%s", err)
+			}
+			if sum := checksum(data); sum != 0xB1B0AFBA {
+				t.Errorf("字体校验和错误：%#x", sum)
+			}
+
+			subset, err := parseFonts(data)
+			if err != nil {
+				t.Fatalf("解析子集化字体失败：%s", err)
+			}
+			if _, err := subset[0].table("DSIG"); !errors.Is(err, ErrTableNotFound) {
+				t.Error("子集化字体不应包含 DSIG 表")
+			}
+			if names := subset[0].names(); len(names) != 1 || names[0] != "Test Sans" {
+				t.Errorf("子集化字体名称错误：%v", names)
+			}
+
+			keep := make(map[int]bool)
+			for _, gid := range c.keep {
+				keep[gid] = true
+			}
+			for gid, glyph := range testGlyphs {
+				got := glyphData(t, subset[0], gid)
+				if keep[gid] && !bytes.Equal(got, bytes.TrimRight(glyph, "\x00")) {
+					t.Errorf("字形 %d 应保留", gid)
+				}
+				if !keep[gid] && len(got) != 0 {
+					t.Errorf("字形 %d 应置空", gid)
+				}
+			}
+		})
+	}
+}
+
+func TestSubsetCFF(t *testing.T) {
+	cases := map[string]struct {
+		outline string
+		runes   []rune
+		keep    []int
+	}{
+		"CFF 字体":    {outline: "CFF ", runes: []rune("A"), keep: []int{0, 1}},
+		"CID 字体":    {outline: "CID", runes: []rune("BC"), keep: []int{0, 2, 4}},
+		"字体中不存在的字符": {outline: "CID", runes: []rune("中"), keep: []int{0}},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			fonts, err := parseFonts(buildTestFont(t, "Test Serif", false, c.outline))
+			if err != nil {
+				t.Fatalf("解析字体失败：%s", err)
+			}
+			if fonts[0].isTrueType() {
+				t.Error("CFF 轮廓字体识别错误")
+			}
+			data, err := fonts[0].subset(c.runes)
+			if err != nil {
+				t.Fatalf("子集化失败：%s", err)
+			}
+			if sum := checksum(data); sum != 0xB1B0AFBA {
+				t.Errorf("字体校验和错误：%#x", sum)
+			}
+
+			subset, err := parseFonts(data)
+			if err != nil {
+				t.Fatalf("解析子集化字体失败：%s", err)
+			}
+			if names := subset[0].names(); len(names) != 1 || names[0] != "Test Serif" {
+				t.Errorf("子集化字体名称错误：%v", names)
+			}
+			charStrings, subrs := cffGlyphs(t, subset[0])
+			if len(charStrings) != len(testGlyphs) {
+				t.Fatalf("字形数量错误，期望：%d，实际：%d", len(testGlyphs), len(charStrings))
+			}
+			keep := make(map[int]bool)
+			for _, gid := range c.keep {
+				keep[gid] = true
+			}
+			for gid, charString := range charStrings {
+				if keep[gid] && !bytes.Equal(charString, testCharString(gid)) {
+					t.Errorf("字形 %d 应保留", gid)
+				}
+				if !keep[gid] && !bytes.Equal(charString, cffEmptyCharString) {
+					t.Errorf("字形 %d 应置空", gid)
+				}
+			}
+			if !bytes.Equal(subrs, testSubrs) {
+				t.Error("局部子程序应原样保留")
+			}
+		})
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "TestSans.ttf"), buildTestFont(t, "Test Sans", false, "glyf"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "TestSerif.otf"), buildTestFont(t, "Test Serif", false, "CFF "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	library, err := NewLibrary(dir)
+	if err != nil {
+		t.Fatalf("创建字体库失败：%s", err)
+	}
+
+	cases := map[string]struct {
+		fileName string
+		cff      bool
+	}{
+		"test sans":  {fileName: "TestSans_0.ttf"},
+		"Test Serif": {fileName: "TestSerif_0.otf", cff: true},
+	}
+	for name, c := range cases {
+		face, ok := library.Match(name, false, false)
+		if !ok {
+			t.Errorf("字体库中未找到字体：%s", name)
+			continue
+		}
+		if face.CFF != c.cff {
+			t.Errorf("字体 %s 轮廓类型错误，期望 CFF：%t，实际：%t", name, c.cff, face.CFF)
+		}
+		if got := face.FileName(); got != c.fileName {
+			t.Errorf("字体 %s 文件名错误，期望：%s，实际：%s", name, c.fileName, got)
+		}
+	}
+	if _, ok := library.Match("Unknown", false, false); ok {
+		t.Error("不存在的字体不应匹配")
+	}
+}
@@ -0,0 +1,138 @@
+package fonts
+
+import (
+	"MediaWarp/internal/logging"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var fontExts = []string{".ttf", ".otf", ".ttc", ".otc"} // 支持的字体文件后缀
+
+// 字体文件中的一个字体
+type Face struct {
+	Path   string // 字体文件路径
+	Index  int    // 在字体集合中的索引
+	Bold   bool   // 是否粗体
+	Italic bool   // 是否斜体
+	CFF    bool   // 是否为 CFF 轮廓字体（嵌入时使用 .otf 后缀）
+}
+
+// 字体文件名（用于嵌入 ASS 字幕）
+func (face *Face) FileName() string {
+	name := strings.TrimSuffix(filepath.Base(face.Path), filepath.Ext(face.Path))
+	ext := ".ttf"
+	if face.CFF {
+		ext = ".otf"
+	}
+	return fmt.Sprintf("%s_%d%s", name, face.Index, ext)
+}
+
+// 本地字体库
+type Library struct {
+	dir   string
+	faces map[string][]Face // 小写字体名称 -> 字体
+}
+
+// 扫描字体目录，创建本地字体库
+func NewLibrary(dir string) (*Library, error) {
+	library := Library{
+		dir:   dir,
+		faces: make(map[string][]Face),
+	}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isFontFile(path) {
+			return nil
+		}
+		if err := library.add(path); err != nil {
+			logging.Warningf("读取字体文件 %s 失败：%s", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("扫描字体目录失败: %w", err)
+	}
+	return &library, nil
+}
+
+// 添加字体文件到字体库
+func (library *Library) add(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	fonts, err := parseFonts(data)
+	if err != nil {
+		return err
+	}
+	for index, font := range fonts {
+		bold, italic := font.style()
+		face := Face{Path: path, Index: index, Bold: bold, Italic: italic, CFF: !font.isTrueType()}
+		for _, name := range font.names() {
+			key := strings.ToLower(name)
+			library.faces[key] = append(library.faces[key], face)
+		}
+	}
+	return nil
+}
+
+// 字体库中的字体名称数量
+func (library *Library) Len() int {
+	return len(library.faces)
+}
+
+// 根据字体名称和样式查找字体
+//
+// 优先返回样式完全匹配的字体，否则返回同名的第一个字体
+func (library *Library) Match(name string, bold bool, italic bool) (*Face, bool) {
+	faces, ok := library.faces[strings.ToLower(name)]
+	if !ok || len(faces) == 0 {
+		return nil, false
+	}
+	for _, face := range faces {
+		if face.Bold == bold && face.Italic == italic {
+			return &face, true
+		}
+	}
+	for _, face := range faces {
+		if !face.Bold && !face.Italic {
+			return &face, true
+		}
+	}
+	return &faces[0], true
+}
+
+// 对字体进行子集化
+//
+// 返回仅包含 runes 中字符字形的独立字体文件
+func (library *Library) Subset(face *Face, runes []rune) ([]byte, error) {
+	data, err := os.ReadFile(face.Path)
+	if err != nil {
+		return nil, err
+	}
+	fonts, err := parseFonts(data)
+	if err != nil {
+		return nil, err
+	}
+	if face.Index >= len(fonts) {
+		return nil, fmt.Errorf("%w: %s 不包含第 %d 个字体", ErrInvalidFont, face.Path, face.Index)
+	}
+	return fonts[face.Index].subset(runes)
+}
+
+// 判断是否为支持的字体文件
+func isFontFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, fontExt := range fontExts {
+		if ext == fontExt {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,321 @@
+package fonts
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	ErrInvalidFont     = errors.New("无效的字体文件")
+	ErrTableNotFound   = errors.New("字体表不存在")
+	ErrUnsupportedCmap = errors.New("不支持的 cmap 格式")
+)
+
+// 字体表记录
+type tableRecord struct {
+	tag    string
+	offset uint32
+	length uint32
+}
+
+// SFNT 字体（TrueType / OpenType）
+//
+// 对于字体集合（TTC / OTC），data 为整个集合文件的内容
+type sfntFont struct {
+	data    []byte
+	version uint32
+	tables  []tableRecord
+}
+
+// 解析字体文件
+//
+// 支持 TTF、OTF 以及字体集合 TTC、OTC，返回文件中包含的所有字体
+func parseFonts(data []byte) ([]*sfntFont, error) {
+	if len(data) < 12 {
+		return nil, ErrInvalidFont
+	}
+	if string(data[:4]) != "ttcf" {
+		font, err := parseFont(data, 0)
+		if err != nil {
+			return nil, err
+		}
+		return []*sfntFont{font}, nil
+	}
+
+	numFonts := binary.BigEndian.Uint32(data[8:12])
+	if uint64(len(data)) < 12+uint64(numFonts)*4 {
+		return nil, ErrInvalidFont
+	}
+	fonts := make([]*sfntFont, 0, numFonts)
+	for i := range numFonts {
+		font, err := parseFont(data, binary.BigEndian.Uint32(data[12+i*4:]))
+		if err != nil {
+			return nil, fmt.Errorf("解析字体集合中第 %d 个字体失败: %w", i, err)
+		}
+		fonts = append(fonts, font)
+	}
+	return fonts, nil
+}
+
+// 解析字体文件中 offset 处的表目录
+func parseFont(data []byte, offset uint32) (*sfntFont, error) {
+	if uint64(len(data)) < uint64(offset)+12 {
+		return nil, ErrInvalidFont
+	}
+	font := &sfntFont{
+		data:    data,
+		version: binary.BigEndian.Uint32(data[offset:]),
+	}
+	switch font.version {
+	case 0x00010000, 0x74727565, 0x4F54544F: // 1.0、'true'、'OTTO'
+	default:
+		return nil, ErrInvalidFont
+	}
+
+	numTables := uint32(binary.BigEndian.Uint16(data[offset+4:]))
+	if uint64(len(data)) < uint64(offset)+12+uint64(numTables)*16 {
+		return nil, ErrInvalidFont
+	}
+	for i := range numTables {
+		record := data[offset+12+i*16:]
+		table := tableRecord{
+			tag:    string(record[:4]),
+			offset: binary.BigEndian.Uint32(record[8:]),
+			length: binary.BigEndian.Uint32(record[12:]),
+		}
+		if uint64(table.offset)+uint64(table.length) > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: %s 表越界", ErrInvalidFont, table.tag)
+		}
+		font.tables = append(font.tables, table)
+	}
+	return font, nil
+}
+
+// 获取字体表内容
+func (f *sfntFont) table(tag string) ([]byte, error) {
+	for _, t := range f.tables {
+		if t.tag == tag {
+			return f.data[t.offset : t.offset+t.length], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tag)
+}
+
+// 是否为 TrueType 轮廓字体（包含 glyf 表）
+func (f *sfntFont) isTrueType() bool {
+	_, err := f.table("glyf")
+	return err == nil
+}
+
+// 获取字体的名称
+//
+// 包含字体族名（nameID 1）、完整名称（nameID 4）、PostScript 名称（nameID 6）以及排版字体族名（nameID 16）
+func (f *sfntFont) names() []string {
+	name, err := f.table("name")
+	if err != nil || len(name) < 6 {
+		return nil
+	}
+
+	var (
+		count        = int(binary.BigEndian.Uint16(name[2:]))
+		stringOffset = int(binary.BigEndian.Uint16(name[4:]))
+		seen         = make(map[string]struct{})
+		result       []string
+	)
+	for i := range count {
+		if 6+(i+1)*12 > len(name) {
+			break
+		}
+		record := name[6+i*12:]
+		var (
+			platformID = binary.BigEndian.Uint16(record[0:])
+			encodingID = binary.BigEndian.Uint16(record[2:])
+			nameID     = binary.BigEndian.Uint16(record[6:])
+			length     = int(binary.BigEndian.Uint16(record[8:]))
+			offset     = int(binary.BigEndian.Uint16(record[10:]))
+		)
+		if nameID != 1 && nameID != 4 && nameID != 6 && nameID != 16 {
+			continue
+		}
+		start := stringOffset + offset
+		if start+length > len(name) {
+			continue
+		}
+		raw := name[start : start+length]
+
+		var value string
+		switch {
+		case platformID == 0 || platformID == 3: // Unicode / Windows：UTF-16BE
+			units := make([]uint16, len(raw)/2)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(raw[j*2:])
+			}
+			value = string(utf16.Decode(units))
+		case platformID == 1 && encodingID == 0: // Macintosh Roman，仅保留 ASCII 名称
+			value = string(raw)
+		default:
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if _, ok := seen[strings.ToLower(value)]; !ok {
+			seen[strings.ToLower(value)] = struct{}{}
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// 获取字体的粗体、斜体属性
+//
+// 优先读取 OS/2 表的 fsSelection，否则读取 head 表的 macStyle
+func (f *sfntFont) style() (bold bool, italic bool) {
+	if os2, err := f.table("OS/2"); err == nil && len(os2) >= 64 {
+		fsSelection := binary.BigEndian.Uint16(os2[62:])
+		return fsSelection&(1<<5) != 0, fsSelection&1 != 0
+	}
+	if head, err := f.table("head"); err == nil && len(head) >= 46 {
+		macStyle := binary.BigEndian.Uint16(head[44:])
+		return macStyle&1 != 0, macStyle&2 != 0
+	}
+	return false, false
+}
+
+// 获取字符到字形索引的映射函数
+//
+// 支持 cmap 格式 4（BMP）和格式 12（完整 Unicode）
+func (f *sfntFont) cmap() (func(r rune) uint16, error) {
+	cmap, err := f.table("cmap")
+	if err != nil {
+		return nil, err
+	}
+	if len(cmap) < 4 {
+		return nil, ErrInvalidFont
+	}
+
+	var (
+		numTables = int(binary.BigEndian.Uint16(cmap[2:]))
+		best      []byte
+		bestScore = -1
+	)
+	for i := range numTables {
+		if 4+(i+1)*8 > len(cmap) {
+			break
+		}
+		record := cmap[4+i*8:]
+		var (
+			platformID = binary.BigEndian.Uint16(record[0:])
+			encodingID = binary.BigEndian.Uint16(record[2:])
+			offset     = binary.BigEndian.Uint32(record[4:])
+		)
+		if uint64(offset)+4 > uint64(len(cmap)) {
+			continue
+		}
+		subtable := cmap[offset:]
+		format := binary.BigEndian.Uint16(subtable)
+
+		var score int
+		switch {
+		case format == 12 && (platformID == 3 && encodingID == 10 || platformID == 0):
+			score = 2
+		case format == 4 && (platformID == 3 && encodingID == 1 || platformID == 0):
+			score = 1
+		default:
+			continue
+		}
+		if score > bestScore {
+			best, bestScore = subtable, score
+		}
+	}
+
+	switch bestScore {
+	case 2:
+		return cmapFormat12(best)
+	case 1:
+		return cmapFormat4(best)
+	default:
+		return nil, ErrUnsupportedCmap
+	}
+}
+
+func cmapFormat4(subtable []byte) (func(r rune) uint16, error) {
+	if len(subtable) < 14 {
+		return nil, ErrInvalidFont
+	}
+	segCountX2 := int(binary.BigEndian.Uint16(subtable[6:]))
+	var (
+		endCodes       = 14
+		startCodes     = endCodes + segCountX2 + 2
+		idDeltas       = startCodes + segCountX2
+		idRangeOffsets = idDeltas + segCountX2
+	)
+	if idRangeOffsets+segCountX2 > len(subtable) {
+		return nil, ErrInvalidFont
+	}
+
+	return func(r rune) uint16 {
+		if r > 0xFFFF || r < 0 {
+			return 0
+		}
+		c := uint16(r)
+		for seg := 0; seg < segCountX2; seg += 2 {
+			if binary.BigEndian.Uint16(subtable[endCodes+seg:]) < c {
+				continue
+			}
+			start := binary.BigEndian.Uint16(subtable[startCodes+seg:])
+			if start > c {
+				return 0
+			}
+			delta := binary.BigEndian.Uint16(subtable[idDeltas+seg:])
+			rangeOffset := int(binary.BigEndian.Uint16(subtable[idRangeOffsets+seg:]))
+			if rangeOffset == 0 {
+				return c + delta
+			}
+			addr := idRangeOffsets + seg + rangeOffset + int(c-start)*2
+			if addr+2 > len(subtable) {
+				return 0
+			}
+			if glyph := binary.BigEndian.Uint16(subtable[addr:]); glyph != 0 {
+				return glyph + delta
+			}
+			return 0
+		}
+		return 0
+	}, nil
+}
+
+func cmapFormat12(subtable []byte) (func(r rune) uint16, error) {
+	if len(subtable) < 16 {
+		return nil, ErrInvalidFont
+	}
+	numGroups := int(binary.BigEndian.Uint32(subtable[12:]))
+	if 16+numGroups*12 > len(subtable) {
+		return nil, ErrInvalidFont
+	}
+
+	return func(r rune) uint16 {
+		c := uint32(r)
+		lo, hi := 0, numGroups
+		for lo < hi { // 分组按起始字符升序排列，使用二分查找
+			mid := (lo + hi) / 2
+			group := subtable[16+mid*12:]
+			start := binary.BigEndian.Uint32(group[0:])
+			end := binary.BigEndian.Uint32(group[4:])
+			switch {
+			case c < start:
+				hi = mid
+			case c > end:
+				lo = mid + 1
+			default:
+				return uint16(binary.BigEndian.Uint32(group[8:]) + c - start)
+			}
+		}
+		return 0
+	}, nil
+}
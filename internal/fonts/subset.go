@@ -0,0 +1,283 @@
+package fonts
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var ErrUnsupportedOutline = errors.New("不支持子集化的字体轮廓格式（如 CFF2）")
+
+// 复合字形标志位
+const (
+	argsAreWords    = 0x0001
+	weHaveAScale    = 0x0008
+	moreComponents  = 0x0020
+	weHaveAnXYScale = 0x0040
+	weHaveA2x2      = 0x0080
+)
+
+// 子集化时丢弃的表
+//
+// DSIG：子集化后签名失效
+var droppedTables = map[string]struct{}{
+	"DSIG": {},
+}
+
+// 字体子集化
+//
+// 仅保留 runes 中字符（以及复合字形引用）的字形轮廓，其余字形置空。
+// 字形索引保持不变，因此 cmap、hmtx、GSUB 等表无需修改。
+// 支持 TrueType（glyf）和 CFF 轮廓，其他轮廓格式（如 CFF2）返回 ErrUnsupportedOutline
+func (f *sfntFont) subset(runes []rune) ([]byte, error) {
+	if f.isTrueType() {
+		return f.subsetGlyf(runes)
+	}
+	cff, err := f.table("CFF ")
+	if err != nil {
+		return nil, ErrUnsupportedOutline
+	}
+	keep, err := f.glyphSet(runes, nil)
+	if err != nil {
+		return nil, err
+	}
+	newCFF, err := subsetCFF(cff, keep)
+	if err != nil {
+		return nil, err
+	}
+	return f.build(map[string][]byte{"CFF ": newCFF})
+}
+
+// 获取 runes 中字符对应的字形索引（包括 .notdef）
+//
+// components 不为 nil 时同时展开字形引用的组件字形
+func (f *sfntFont) glyphSet(runes []rune, components func(gid int) []int) (map[int]struct{}, error) {
+	maxp, err := f.table("maxp")
+	if err != nil {
+		return nil, err
+	}
+	if len(maxp) < 6 {
+		return nil, ErrInvalidFont
+	}
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	lookup, err := f.cmap()
+	if err != nil {
+		return nil, err
+	}
+
+	keep := map[int]struct{}{0: {}} // .notdef 必须保留
+	queue := []int{0}
+	for _, r := range runes {
+		if gid := int(lookup(r)); gid != 0 && gid < numGlyphs {
+			if _, ok := keep[gid]; !ok {
+				keep[gid] = struct{}{}
+				queue = append(queue, gid)
+			}
+		}
+	}
+	for components != nil && len(queue) > 0 { // 展开复合字形引用的组件字形
+		gid := queue[0]
+		queue = queue[1:]
+		for _, component := range components(gid) {
+			if component < numGlyphs {
+				if _, ok := keep[component]; !ok {
+					keep[component] = struct{}{}
+					queue = append(queue, component)
+				}
+			}
+		}
+	}
+	return keep, nil
+}
+
+// TrueType 轮廓字体子集化
+func (f *sfntFont) subsetGlyf(runes []rune) ([]byte, error) {
+	var (
+		head, maxp, loca, glyf []byte
+		err                    error
+	)
+	if head, err = f.table("head"); err != nil {
+		return nil, err
+	}
+	if maxp, err = f.table("maxp"); err != nil {
+		return nil, err
+	}
+	if loca, err = f.table("loca"); err != nil {
+		return nil, err
+	}
+	if glyf, err = f.table("glyf"); err != nil {
+		return nil, err
+	}
+	if len(head) < 54 || len(maxp) < 6 {
+		return nil, ErrInvalidFont
+	}
+
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	longLoca := binary.BigEndian.Uint16(head[50:]) == 1
+	offsets := make([]uint32, numGlyphs+1)
+	for i := range offsets {
+		if longLoca {
+			if (i+1)*4 > len(loca) {
+				return nil, ErrInvalidFont
+			}
+			offsets[i] = binary.BigEndian.Uint32(loca[i*4:])
+		} else {
+			if (i+1)*2 > len(loca) {
+				return nil, ErrInvalidFont
+			}
+			offsets[i] = uint32(binary.BigEndian.Uint16(loca[i*2:])) * 2
+		}
+	}
+	glyph := func(gid int) []byte {
+		start, end := offsets[gid], offsets[gid+1]
+		if start >= end || int(end) > len(glyf) {
+			return nil
+		}
+		return glyf[start:end]
+	}
+
+	keep, err := f.glyphSet(runes, func(gid int) []int { return compositeComponents(glyph(gid)) })
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		newGlyf = make([]byte, 0, len(glyf)/4)
+		newLoca = make([]byte, (numGlyphs+1)*4)
+	)
+	for gid := range numGlyphs {
+		binary.BigEndian.PutUint32(newLoca[gid*4:], uint32(len(newGlyf)))
+		if _, ok := keep[gid]; !ok {
+			continue
+		}
+		newGlyf = append(newGlyf, glyph(gid)...)
+		for len(newGlyf)%4 != 0 {
+			newGlyf = append(newGlyf, 0)
+		}
+	}
+	binary.BigEndian.PutUint32(newLoca[numGlyphs*4:], uint32(len(newGlyf)))
+
+	newHead := append([]byte(nil), head...)
+	binary.BigEndian.PutUint16(newHead[50:], 1) // 使用长格式 loca
+	return f.build(map[string][]byte{
+		"head": newHead,
+		"loca": newLoca,
+		"glyf": newGlyf,
+	})
+}
+
+// 获取复合字形引用的组件字形索引
+func compositeComponents(data []byte) []int {
+	if len(data) < 10 || int16(binary.BigEndian.Uint16(data)) >= 0 {
+		return nil
+	}
+
+	var (
+		components []int
+		offset     = 10
+	)
+	for offset+4 <= len(data) {
+		flags := binary.BigEndian.Uint16(data[offset:])
+		components = append(components, int(binary.BigEndian.Uint16(data[offset+2:])))
+		offset += 4
+		if flags&argsAreWords != 0 {
+			offset += 4
+		} else {
+			offset += 2
+		}
+		switch {
+		case flags&weHaveAScale != 0:
+			offset += 2
+		case flags&weHaveAnXYScale != 0:
+			offset += 4
+		case flags&weHaveA2x2 != 0:
+			offset += 8
+		}
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+	return components
+}
+
+// 构建独立的字体文件
+//
+// replaced 中的表会替换原有表，同时重新计算校验和
+func (f *sfntFont) build(replaced map[string][]byte) ([]byte, error) {
+	type table struct {
+		tag  string
+		data []byte
+	}
+	tables := make([]table, 0, len(f.tables))
+	for _, t := range f.tables {
+		if _, ok := droppedTables[t.tag]; ok {
+			continue
+		}
+		data := f.data[t.offset : t.offset+t.length]
+		if r, ok := replaced[t.tag]; ok {
+			data = r
+		}
+		tables = append(tables, table{tag: t.tag, data: data})
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].tag < tables[j].tag })
+
+	var (
+		numTables   = len(tables)
+		entrySelect = 0
+	)
+	for 1<<(entrySelect+1) <= numTables {
+		entrySelect++
+	}
+	searchRange := (1 << entrySelect) * 16
+
+	size := 12 + 16*numTables
+	for _, t := range tables {
+		size += (len(t.data) + 3) &^ 3
+	}
+	out := make([]byte, 12+16*numTables, size)
+	binary.BigEndian.PutUint32(out[0:], f.version)
+	binary.BigEndian.PutUint16(out[4:], uint16(numTables))
+	binary.BigEndian.PutUint16(out[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[8:], uint16(entrySelect))
+	binary.BigEndian.PutUint16(out[10:], uint16(numTables*16-searchRange))
+
+	headOffset := -1
+	for i, t := range tables {
+		data := t.data
+		if t.tag == "head" {
+			if len(data) < 12 {
+				return nil, fmt.Errorf("%w: head 表长度错误", ErrInvalidFont)
+			}
+			data = append([]byte(nil), data...)
+			binary.BigEndian.PutUint32(data[8:], 0) // 计算校验和前需要将 checkSumAdjustment 置零
+			headOffset = len(out)
+		}
+
+		record := out[12+i*16:]
+		copy(record[0:4], t.tag)
+		binary.BigEndian.PutUint32(record[4:], checksum(data))
+		binary.BigEndian.PutUint32(record[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(data)))
+
+		out = append(out, data...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(out[headOffset+8:], 0xB1B0AFBA-checksum(out))
+	}
+	return out, nil
+}
+
+// 计算表校验和
+func checksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
@@ -7,6 +7,7 @@ import (
 	"MediaWarp/internal/service"
 	"MediaWarp/internal/service/alist"
 	"MediaWarp/internal/service/emby"
+	"MediaWarp/internal/session"
 	"MediaWarp/utils"
 	"bytes"
 	"encoding/json"
@@ -31,18 +32,23 @@ type EmbyServerHandler struct {
 	routerRules       []RegexpRouteRule      // 正则路由规则
 	proxy             *httputil.ReverseProxy // 反向代理
 	httpStrmHandler   StrmHandlerFunc
-	playbackInfoMutex sync.Map // 视频流处理并发控制，确保同一个 item ID 的重定向请求串行化，避免重复获取缓存
+	clientIP          *clientIPResolver // 客户端 IP 解析器
+	strmRewriter      *strmRewriter     // Strm 内容重写器
+	strmStreamer      *strmStreamer     // Strm 媒体流响应器
+	subtitleModifier  *subtitleModifier // 字幕处理器
+	playbackInfoMutex sync.Map          // 视频流处理并发控制，确保同一个 item ID 的重定向请求串行化，避免重复获取缓存
 }
 
 // 初始化
-func NewEmbyServerHandler(addr string, apiKey string) (*EmbyServerHandler, error) {
+func NewEmbyServerHandler(cfg *config.Setting) (*EmbyServerHandler, error) {
 	var embyServerHandler = EmbyServerHandler{}
-	embyServerHandler.server = emby.New(addr, apiKey)
+	embyServerHandler.server = emby.New(cfg.MediaServer.ADDR, cfg.MediaServer.AUTH)
 	target, err := url.Parse(embyServerHandler.server.GetEndpoint())
 	if err != nil {
 		return nil, err
 	}
 	embyServerHandler.proxy = httputil.NewSingleHostReverseProxy(target)
+	embyServerHandler.proxy.ErrorHandler = proxyErrorHandler("ReverseProxy")
 
 	{ // 初始化路由规则
 		embyServerHandler.routerRules = []RegexpRouteRule{
@@ -66,8 +72,8 @@ func NewEmbyServerHandler(addr string, apiKey string) (*EmbyServerHandler, error
 			},
 		}
 
-		if config.Web.Enable {
-			if config.Web.Index || config.Web.Head != "" || config.Web.ExternalPlayerUrl || config.Web.VideoTogether {
+		if cfg.Web.Enable {
+			if cfg.Web.Index || cfg.Web.Head != "" || cfg.Web.ExternalPlayerUrl || cfg.Web.VideoTogether {
 				embyServerHandler.routerRules = append(embyServerHandler.routerRules,
 					RegexpRouteRule{
 						Regexp: constants.EmbyRegexp.Router.ModifyIndex,
@@ -79,7 +85,15 @@ func NewEmbyServerHandler(addr string, apiKey string) (*EmbyServerHandler, error
 				)
 			}
 		}
-		if config.Subtitle.Enable && config.Subtitle.SRT2ASS {
+		if cfg.Session.Enable {
+			embyServerHandler.routerRules = append(embyServerHandler.routerRules,
+				RegexpRouteRule{
+					Regexp:  constants.EmbyRegexp.Router.PlayingSession,
+					Handler: playingSessionHandler(embyServerHandler.proxy),
+				},
+			)
+		}
+		if cfg.Subtitle.Enable && (cfg.Subtitle.SRT2ASS || cfg.Subtitle.SubSet) {
 			embyServerHandler.routerRules = append(embyServerHandler.routerRules,
 				RegexpRouteRule{
 					Regexp: constants.EmbyRegexp.Router.ModifySubtitles,
@@ -91,10 +105,26 @@ func NewEmbyServerHandler(addr string, apiKey string) (*EmbyServerHandler, error
 			)
 		}
 	}
-	embyServerHandler.httpStrmHandler, err = getHTTPStrmHandler()
+	embyServerHandler.httpStrmHandler, err = getHTTPStrmHandler(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("创建 HTTPStrm 处理器失败: %w", err)
 	}
+	embyServerHandler.clientIP, err = newClientIPResolver(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("可信代理设置错误: %w", err)
+	}
+	embyServerHandler.strmRewriter, err = newStrmRewriter(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("创建 Strm 内容重写器失败: %w", err)
+	}
+	embyServerHandler.strmStreamer, err = newStrmStreamer(cfg, embyServerHandler.ResolveUser)
+	if err != nil {
+		return nil, fmt.Errorf("创建 Strm 媒体流响应器失败: %w", err)
+	}
+	embyServerHandler.subtitleModifier, err = newSubtitleModifier(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("创建字幕处理器失败: %w", err)
+	}
 	return &embyServerHandler, nil
 }
 
@@ -103,6 +133,21 @@ func (embyServerHandler *EmbyServerHandler) ReverseProxy(rw http.ResponseWriter,
 	embyServerHandler.proxy.ServeHTTP(rw, req)
 }
 
+// 根据访问令牌获取用户 ID
+//
+// Emby 没有获取当前用户的接口，使用访问令牌请求 /Users/{UserId}，
+// Emby 确认请求中携带的用户 ID 属于该访问令牌（或访问令牌属于管理员）后才使用
+func (embyServerHandler *EmbyServerHandler) ResolveUser(req *http.Request) string {
+	token := utils.GetClientToken(req)
+	return session.ResolveUser(token, func() (string, error) {
+		userID := getRequestUserID(req)
+		if userID == "" {
+			return "", nil
+		}
+		return embyServerHandler.server.UsersServiceGetUserID(token, userID)
+	})
+}
+
 // 正则路由表
 func (embyServerHandler *EmbyServerHandler) GetRegexpRouteRules() []RegexpRouteRule {
 	return embyServerHandler.routerRules
@@ -116,11 +161,16 @@ func (*EmbyServerHandler) GetSubtitleCacheRegexp() *regexp.Regexp {
 	return constants.EmbyRegexp.Cache.Subtitle
 }
 
+func (*EmbyServerHandler) GetPlaybackRegexps() []*regexp.Regexp {
+	return []*regexp.Regexp{constants.EmbyRegexp.Router.VideosHandler, constants.EmbyRegexp.Router.ModifyPlaybackInfo}
+}
+
 // 修改播放信息请求
 //
 // /Items/:itemId/PlaybackInfo
 // 强制将 HTTPStrm 设置为支持直链播放和转码、AlistStrm 设置为支持直链播放并且禁止转码
 func (embyServerHandler *EmbyServerHandler) ModifyPlaybackInfo(rw *http.Response) error {
+	cfg := config.Get()
 	// 检查 IsPlayback 参数，如果为 false 则不做修改直接返回
 	// 从响应的请求中获取参数，因为响应对象包含原始请求
 	// 使用不区分大小写的方式获取查询参数
@@ -144,6 +194,7 @@ func (embyServerHandler *EmbyServerHandler) ModifyPlaybackInfo(rw *http.Response
 		return err
 	}
 
+	hasStrm := false
 	for index, mediasource := range playbackInfoResponse.MediaSources {
 		logging.Debug("请求 ItemsServiceQueryItem：" + *mediasource.ID)
 		itemResponse, err := embyServerHandler.server.ItemsServiceQueryItem(strings.Replace(*mediasource.ID, "mediasource_", "", 1), 1, "Path,MediaSources") // 查询 item 需要去除前缀仅保留数字部分
@@ -153,9 +204,21 @@ func (embyServerHandler *EmbyServerHandler) ModifyPlaybackInfo(rw *http.Response
 		}
 		item := itemResponse.Items[0]
 		strmFileType, opt := recgonizeStrmFileType(*item.Path)
+		alistPath := *mediasource.Path
+		if !strings.HasSuffix(strings.ToLower(*item.Path), ".strm") {
+			if addr, mappedPath, ok := recgonizeAlistPathMap(*mediasource.Path); ok { // 挂载的网盘文件按 AlistStrm 处理
+				strmFileType, opt, alistPath = constants.AlistStrm, addr, mappedPath
+			}
+		}
+		if strmFileType == constants.AlistStrm {
+			alistPath = embyServerHandler.strmRewriter.Rewrite(strmFileType, opt, alistPath, rw.Request.UserAgent(), embyServerHandler.clientIP.ClientIP(rw.Request))
+		}
+		if strmFileType != constants.UnknownStrm {
+			hasStrm = true
+		}
 		switch strmFileType {
 		case constants.HTTPStrm: // HTTPStrm 设置支持直链播放并且支持转码
-			if !config.HTTPStrm.TransCode {
+			if !cfg.HTTPStrm.TransCode {
 				*playbackInfoResponse.MediaSources[index].SupportsDirectPlay = true
 				*playbackInfoResponse.MediaSources[index].SupportsDirectStream = true
 				playbackInfoResponse.MediaSources[index].TranscodingURL = nil
@@ -168,13 +231,14 @@ func (embyServerHandler *EmbyServerHandler) ModifyPlaybackInfo(rw *http.Response
 						continue
 					}
 					directStreamURL := fmt.Sprintf("/videos/%s/stream?MediaSourceId=%s&Static=true&%s", *mediasource.ItemID, *mediasource.ID, apikeypair)
+					directStreamURL = addPlaySessionID(directStreamURL, playbackInfoResponse.PlaySessionID)
 					playbackInfoResponse.MediaSources[index].DirectStreamURL = &directStreamURL
 					logging.Infof("%s 强制禁止转码，直链播放链接为：%s", *mediasource.Name, directStreamURL)
 				}
 			}
 
 		case constants.AlistStrm: // AlistStm 设置支持直链播放并且禁止转码
-			if !config.AlistStrm.TransCode {
+			if !cfg.AlistStrm.TransCode {
 				*playbackInfoResponse.MediaSources[index].SupportsDirectPlay = true
 				*playbackInfoResponse.MediaSources[index].SupportsDirectStream = true
 				*playbackInfoResponse.MediaSources[index].SupportsTranscoding = false
@@ -187,6 +251,7 @@ func (embyServerHandler *EmbyServerHandler) ModifyPlaybackInfo(rw *http.Response
 					continue
 				}
 				directStreamURL := fmt.Sprintf("/videos/%s/stream?MediaSourceId=%s&Static=true&%s", *mediasource.ItemID, *mediasource.ID, apikeypair)
+				directStreamURL = addPlaySessionID(directStreamURL, playbackInfoResponse.PlaySessionID)
 				playbackInfoResponse.MediaSources[index].DirectStreamURL = &directStreamURL
 				container := strings.TrimPrefix(path.Ext(*mediasource.Path), ".")
 				playbackInfoResponse.MediaSources[index].Container = &container
@@ -196,12 +261,12 @@ func (embyServerHandler *EmbyServerHandler) ModifyPlaybackInfo(rw *http.Response
 			}
 
 			if playbackInfoResponse.MediaSources[index].Size == nil {
-				alistClient, err := service.GetAlistClient(opt.(string))
+				alistGroup, err := service.GetAlistGroup(opt.(string))
 				if err != nil {
-					logging.Warning("获取 AlistClient 失败：", err)
+					logging.Warning("获取 Alist 节点组失败：", err)
 					continue
 				}
-				fsGetData, err := alistClient.FsGet(&alist.FsGetRequest{Path: *mediasource.Path, Page: 1})
+				fsGetData, err := alistGroup.FsGet(&alist.FsGetRequest{Path: alistPath, Page: 1})
 				if err != nil {
 					logging.Warning("请求 FsGet 失败：", err)
 					continue
@@ -212,6 +277,14 @@ func (embyServerHandler *EmbyServerHandler) ModifyPlaybackInfo(rw *http.Response
 		}
 	}
 
+	if hasStrm && session.Enabled() {
+		if err := checkPlaybackSession(rw.Request, embyServerHandler.clientIP.ClientIP(rw.Request), playbackInfoResponse.PlaySessionID, embyServerHandler.ResolveUser(rw.Request)); err != nil {
+			errorCode := emby.RateLimitExceeded // 超出同时播放数量上限
+			playbackInfoResponse.ErrorCode = &errorCode
+			playbackInfoResponse.MediaSources = nil
+		}
+	}
+
 	body, err = json.Marshal(playbackInfoResponse)
 	if err != nil {
 		logging.Warning("序列化 emby.PlaybackInfoResponse Json 错误：", err)
@@ -261,12 +334,16 @@ func (embyServerHandler *EmbyServerHandler) VideosHandler(ctx *gin.Context) {
 
 	// 并发控制：确保同一个 item ID 只有一个任务在运行
 	// 将整个处理流程放在锁内，避免重复查询和重复获取重定向 URL
-	var mu *sync.Mutex
+	var (
+		mu     *sync.Mutex
+		unlock = func() {}
+	)
 	if itemID != "" {
 		mutex, _ := embyServerHandler.playbackInfoMutex.LoadOrStore(itemID, &sync.Mutex{})
 		mu = mutex.(*sync.Mutex)
 		mu.Lock()
-		defer mu.Unlock()
+		unlock = sync.OnceFunc(mu.Unlock)
+		defer unlock()
 		logging.Debugf("开始处理 item %s 的 VideosHandler 请求", itemID)
 	}
 
@@ -281,7 +358,22 @@ func (embyServerHandler *EmbyServerHandler) VideosHandler(ctx *gin.Context) {
 	item := itemResponse.Items[0]
 
 	if !strings.HasSuffix(strings.ToLower(*item.Path), ".strm") { // 不是 Strm 文件
-		logging.Debug("播放本地视频：" + *item.Path + "，不进行处理")
+		localPath := *item.Path
+		for _, mediasource := range item.MediaSources {
+			if *mediasource.ID == mediaSourceID && mediasource.Path != nil { // 多版本视频需要使用对应版本的路径
+				localPath = *mediasource.Path
+				break
+			}
+		}
+		if alistAddr, alistPath, ok := recgonizeAlistPathMap(localPath); ok {
+			alistPath = embyServerHandler.strmRewriter.Rewrite(constants.AlistStrm, alistAddr, alistPath, ctx.Request.UserAgent(), ctx.ClientIP())
+			if redirectURL := alistStrmHandler(alistPath, alistAddr); redirectURL != "" {
+				unlock() // 已获取到媒体链接，代理模式下需要在传输媒体流之前释放锁
+				embyServerHandler.strmStreamer.Serve(ctx, constants.AlistStrm, redirectURL)
+				return
+			}
+		}
+		logging.Debug("播放本地视频：" + localPath + "，不进行处理")
 		embyServerHandler.ReverseProxy(ctx.Writer, ctx.Request)
 		return
 	}
@@ -289,18 +381,22 @@ func (embyServerHandler *EmbyServerHandler) VideosHandler(ctx *gin.Context) {
 	strmFileType, opt := recgonizeStrmFileType(*item.Path)
 	for _, mediasource := range item.MediaSources {
 		if *mediasource.ID == mediaSourceID { // EmbyServer >= 4.9 返回的ID带有前缀mediasource_
+			strmContent := embyServerHandler.strmRewriter.Rewrite(strmFileType, opt, *mediasource.Path, ctx.Request.UserAgent(), ctx.ClientIP())
 			switch strmFileType {
 			case constants.HTTPStrm:
 				if *mediasource.Protocol == emby.HTTP {
 					// httpStrmHandler 内部有缓存机制，锁确保串行化访问
-					ctx.Redirect(http.StatusFound, embyServerHandler.httpStrmHandler(*mediasource.Path, ctx.Request.UserAgent()))
+					redirectURL := embyServerHandler.httpStrmHandler(strmContent, ctx.Request.UserAgent())
+					unlock()
+					embyServerHandler.strmStreamer.Serve(ctx, strmFileType, redirectURL)
 					return
 				}
 
 			case constants.AlistStrm: // 无需判断 *mediasource.Container 是否以Strm结尾，当 AlistStrm 存储的位置有对应的文件时，*mediasource.Container 会被设置为文件后缀
-				redirectURL := alistStrmHandler(*mediasource.Path, opt.(string))
+				redirectURL := alistStrmHandler(strmContent, opt.(string))
 				if redirectURL != "" {
-					ctx.Redirect(http.StatusFound, redirectURL)
+					unlock()
+					embyServerHandler.strmStreamer.Serve(ctx, strmFileType, redirectURL)
 				}
 				return
 
@@ -314,26 +410,9 @@ func (embyServerHandler *EmbyServerHandler) VideosHandler(ctx *gin.Context) {
 
 // 修改字幕
 //
-// 将 SRT 字幕转 ASS
+// 将 SRT 字幕转 ASS，ASS 字幕字体子集化
 func (embyServerHandler *EmbyServerHandler) ModifySubtitles(rw *http.Response) error {
-	defer rw.Body.Close()
-	subtitile, err := io.ReadAll(rw.Body) // 读取字幕文件
-	if err != nil {
-		logging.Warning("读取原始字幕 Body 出错：", err)
-		return err
-	}
-
-	if utils.IsSRT(subtitile) { // 判断是否为 SRT 格式
-		logging.Info("字幕文件为 SRT 格式")
-		if config.Subtitle.SRT2ASS {
-			logging.Info("已将 SRT 字幕已转为 ASS 格式")
-			assSubtitle := utils.SRT2ASS(subtitile, config.Subtitle.ASSStyle)
-			rw.Header.Set("Content-Length", strconv.Itoa(len(assSubtitle)))
-			rw.Body = io.NopCloser(bytes.NewReader(assSubtitle))
-			return nil
-		}
-	}
-	return nil
+	return embyServerHandler.subtitleModifier.ModifyResponse(rw)
 }
 
 // 修改 basehtmlplayer.js
@@ -354,6 +433,7 @@ func (embyServerHandler *EmbyServerHandler) ModifyBaseHtmlPlayer(rw *http.Respon
 
 // 修改首页函数
 func (embyServerHandler *EmbyServerHandler) ModifyIndex(rw *http.Response) error {
+	cfg := config.Get()
 	var (
 		htmlFilePath string = path.Join(config.CostomDir(), "index.html")
 		htmlContent  []byte
@@ -361,8 +441,8 @@ func (embyServerHandler *EmbyServerHandler) ModifyIndex(rw *http.Response) error
 		err          error
 	)
 
-	defer rw.Body.Close()  // 无论哪种情况，最终都要确保原 Body 被关闭，避免内存泄漏
-	if !config.Web.Index { // 从上游获取响应体
+	defer rw.Body.Close() // 无论哪种情况，最终都要确保原 Body 被关闭，避免内存泄漏
+	if !cfg.Web.Index {   // 从上游获取响应体
 		if htmlContent, err = io.ReadAll(rw.Body); err != nil {
 			return err
 		}
@@ -373,29 +453,29 @@ func (embyServerHandler *EmbyServerHandler) ModifyIndex(rw *http.Response) error
 		}
 	}
 
-	if config.Web.Head != "" { // 用户自定义HEAD
-		addHEAD.WriteString(config.Web.Head + "\n")
+	if cfg.Web.Head != "" { // 用户自定义HEAD
+		addHEAD.WriteString(cfg.Web.Head + "\n")
 	}
-	if config.Web.ExternalPlayerUrl { // 外部播放器
+	if cfg.Web.ExternalPlayerUrl { // 外部播放器
 		addHEAD.WriteString(`<script src="/MediaWarp/static/embyExternalUrl/embyWebAddExternalUrl/embyLaunchPotplayer.js"></script>` + "\n")
 	}
-	if config.Web.Crx { // crx 美化
+	if cfg.Web.Crx { // crx 美化
 		addHEAD.WriteString(`<link rel="stylesheet" id="theme-css" href="/MediaWarp/static/emby-crx/static/css/style.css" type="text/css" media="all" />
     <script src="/MediaWarp/static/emby-crx/static/js/common-utils.js"></script>
     <script src="/MediaWarp/static/emby-crx/static/js/jquery-3.6.0.min.js"></script>
     <script src="/MediaWarp/static/emby-crx/static/js/md5.min.js"></script>
     <script src="/MediaWarp/static/emby-crx/content/main.js"></script>` + "\n")
 	}
-	if config.Web.ActorPlus { // 过滤没有头像的演员和制作人员
+	if cfg.Web.ActorPlus { // 过滤没有头像的演员和制作人员
 		addHEAD.WriteString(`<script src="/MediaWarp/static/emby-web-mod/actorPlus/actorPlus.js"></script>` + "\n")
 	}
-	if config.Web.FanartShow { // 显示同人图（fanart图）
+	if cfg.Web.FanartShow { // 显示同人图（fanart图）
 		addHEAD.WriteString(`<script src="/MediaWarp/static/emby-web-mod/fanart_show/fanart_show.js"></script>` + "\n")
 	}
-	if config.Web.Danmaku { // 弹幕
+	if cfg.Web.Danmaku { // 弹幕
 		addHEAD.WriteString(`<script src="/MediaWarp/static/dd-danmaku/ede.js" defer></script>` + "\n")
 	}
-	if config.Web.VideoTogether { // VideoTogether
+	if cfg.Web.VideoTogether { // VideoTogether
 		addHEAD.WriteString(`<script src="https://2gether.video/release/extension.website.user.js"></script>` + "\n")
 	}
 	addHEAD.WriteString(`<!-- MediaWarp Web 页面修改功能 -->` + "\n" + "</head>")
@@ -7,6 +7,7 @@ import (
 	"MediaWarp/internal/service"
 	"MediaWarp/internal/service/alist"
 	"MediaWarp/internal/service/jellyfin"
+	"MediaWarp/internal/session"
 	"MediaWarp/utils"
 	"bytes"
 	"encoding/json"
@@ -31,17 +32,22 @@ type JellyfinHandler struct {
 	routerRules       []RegexpRouteRule      // 正则路由规则
 	proxy             *httputil.ReverseProxy // 反向代理
 	httpStrmHandler   StrmHandlerFunc
-	playbackInfoMutex sync.Map // 视频流处理并发控制，确保同一个 item ID 的重定向请求串行化，避免重复获取缓存
+	clientIP          *clientIPResolver // 客户端 IP 解析器
+	strmRewriter      *strmRewriter     // Strm 内容重写器
+	strmStreamer      *strmStreamer     // Strm 媒体流响应器
+	subtitleModifier  *subtitleModifier // 字幕处理器
+	playbackInfoMutex sync.Map          // 视频流处理并发控制，确保同一个 item ID 的重定向请求串行化，避免重复获取缓存
 }
 
-func NewJellyfinHander(addr string, apiKey string) (*JellyfinHandler, error) {
+func NewJellyfinHander(cfg *config.Setting) (*JellyfinHandler, error) {
 	jellyfinHandler := JellyfinHandler{}
-	jellyfinHandler.server = jellyfin.New(addr, apiKey)
+	jellyfinHandler.server = jellyfin.New(cfg.MediaServer.ADDR, cfg.MediaServer.AUTH)
 	target, err := url.Parse(jellyfinHandler.server.GetEndpoint())
 	if err != nil {
 		return nil, err
 	}
 	jellyfinHandler.proxy = httputil.NewSingleHostReverseProxy(target)
+	jellyfinHandler.proxy.ErrorHandler = proxyErrorHandler("ReverseProxy")
 
 	{ // 初始化路由规则
 		jellyfinHandler.routerRules = []RegexpRouteRule{
@@ -57,8 +63,8 @@ func NewJellyfinHander(addr string, apiKey string) (*JellyfinHandler, error) {
 				Handler: jellyfinHandler.VideosHandler,
 			},
 		}
-		if config.Web.Enable {
-			if config.Web.Index || config.Web.Head != "" || config.Web.ExternalPlayerUrl || config.Web.VideoTogether {
+		if cfg.Web.Enable {
+			if cfg.Web.Index || cfg.Web.Head != "" || cfg.Web.ExternalPlayerUrl || cfg.Web.VideoTogether {
 				jellyfinHandler.routerRules = append(
 					jellyfinHandler.routerRules,
 					RegexpRouteRule{
@@ -71,12 +77,47 @@ func NewJellyfinHander(addr string, apiKey string) (*JellyfinHandler, error) {
 				)
 			}
 		}
+		if cfg.Session.Enable {
+			jellyfinHandler.routerRules = append(jellyfinHandler.routerRules,
+				RegexpRouteRule{
+					Regexp:  constants.JellyfinRegexp.Router.PlayingSession,
+					Handler: playingSessionHandler(jellyfinHandler.proxy),
+				},
+			)
+		}
+		if cfg.Subtitle.Enable && (cfg.Subtitle.SRT2ASS || cfg.Subtitle.SubSet) {
+			jellyfinHandler.routerRules = append(jellyfinHandler.routerRules,
+				RegexpRouteRule{
+					Regexp: constants.JellyfinRegexp.Router.ModifySubtitles,
+					Handler: responseModifyCreater(
+						&httputil.ReverseProxy{Director: jellyfinHandler.proxy.Director},
+						jellyfinHandler.ModifySubtitles,
+					),
+				},
+			)
+		}
 	}
 
-	jellyfinHandler.httpStrmHandler, err = getHTTPStrmHandler()
+	jellyfinHandler.httpStrmHandler, err = getHTTPStrmHandler(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("创建 HTTPStrm 处理器失败: %w", err)
 	}
+	jellyfinHandler.clientIP, err = newClientIPResolver(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("可信代理设置错误: %w", err)
+	}
+	jellyfinHandler.strmRewriter, err = newStrmRewriter(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("创建 Strm 内容重写器失败: %w", err)
+	}
+	jellyfinHandler.strmStreamer, err = newStrmStreamer(cfg, jellyfinHandler.ResolveUser)
+	if err != nil {
+		return nil, fmt.Errorf("创建 Strm 媒体流响应器失败: %w", err)
+	}
+	jellyfinHandler.subtitleModifier, err = newSubtitleModifier(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("创建字幕处理器失败: %w", err)
+	}
 	return &jellyfinHandler, nil
 }
 
@@ -85,6 +126,16 @@ func (jellyfinHandler *JellyfinHandler) ReverseProxy(rw http.ResponseWriter, req
 	jellyfinHandler.proxy.ServeHTTP(rw, req)
 }
 
+// 根据访问令牌获取用户 ID
+//
+// 使用访问令牌请求 /Users/Me
+func (jellyfinHandler *JellyfinHandler) ResolveUser(req *http.Request) string {
+	token := utils.GetClientToken(req)
+	return session.ResolveUser(token, func() (string, error) {
+		return jellyfinHandler.server.UserServiceGetCurrentUserID(token)
+	})
+}
+
 // 正则路由表
 func (jellyfinHandler *JellyfinHandler) GetRegexpRouteRules() []RegexpRouteRule {
 	return jellyfinHandler.routerRules
@@ -94,15 +145,20 @@ func (jellyfinHandler *JellyfinHandler) GetImageCacheRegexp() *regexp.Regexp {
 	return constants.JellyfinRegexp.Cache.Image
 }
 
-func (JellyfinHandler) GetSubtitleCacheRegexp() *regexp.Regexp {
+func (*JellyfinHandler) GetSubtitleCacheRegexp() *regexp.Regexp {
 	return constants.JellyfinRegexp.Cache.Subtitle
 }
 
+func (*JellyfinHandler) GetPlaybackRegexps() []*regexp.Regexp {
+	return []*regexp.Regexp{constants.JellyfinRegexp.Router.VideosHandler, constants.JellyfinRegexp.Router.ModifyPlaybackInfo}
+}
+
 // 修改播放信息请求
 //
 // /Items/:itemId
 // 强制将 HTTPStrm 设置为支持直链播放和转码、AlistStrm 设置为支持直链播放并且禁止转码
 func (jellyfinHandler *JellyfinHandler) ModifyPlaybackInfo(rw *http.Response) error {
+	cfg := config.Get()
 	// 检查 IsPlayback 参数，如果为 false 则不做修改直接返回
 	// 从响应的请求中获取参数，因为响应对象包含原始请求
 	// 使用不区分大小写的方式获取查询参数
@@ -126,6 +182,7 @@ func (jellyfinHandler *JellyfinHandler) ModifyPlaybackInfo(rw *http.Response) er
 		return err
 	}
 
+	hasStrm := false
 	for index, mediasource := range playbackInfoResponse.MediaSources {
 		logging.Debug("请求 ItemsServiceQueryItem：" + *mediasource.ID)
 		itemResponse, err := jellyfinHandler.server.ItemsServiceQueryItem(*mediasource.ID, 1, "Path,MediaSources") // 查询 item 需要去除前缀仅保留数字部分
@@ -135,9 +192,21 @@ func (jellyfinHandler *JellyfinHandler) ModifyPlaybackInfo(rw *http.Response) er
 		}
 		item := itemResponse.Items[0]
 		strmFileType, opt := recgonizeStrmFileType(*item.Path)
+		alistPath := *mediasource.Path
+		if !strings.HasSuffix(strings.ToLower(*item.Path), ".strm") {
+			if addr, mappedPath, ok := recgonizeAlistPathMap(*mediasource.Path); ok { // 挂载的网盘文件按 AlistStrm 处理
+				strmFileType, opt, alistPath = constants.AlistStrm, addr, mappedPath
+			}
+		}
+		if strmFileType == constants.AlistStrm {
+			alistPath = jellyfinHandler.strmRewriter.Rewrite(strmFileType, opt, alistPath, rw.Request.UserAgent(), jellyfinHandler.clientIP.ClientIP(rw.Request))
+		}
+		if strmFileType != constants.UnknownStrm {
+			hasStrm = true
+		}
 		switch strmFileType {
 		case constants.HTTPStrm: // HTTPStrm 设置支持直链播放并且支持转码
-			if !config.HTTPStrm.TransCode {
+			if !cfg.HTTPStrm.TransCode {
 				*playbackInfoResponse.MediaSources[index].SupportsDirectPlay = true
 				*playbackInfoResponse.MediaSources[index].SupportsDirectStream = true
 				playbackInfoResponse.MediaSources[index].TranscodingURL = nil
@@ -150,13 +219,14 @@ func (jellyfinHandler *JellyfinHandler) ModifyPlaybackInfo(rw *http.Response) er
 						continue
 					}
 					directStreamURL := fmt.Sprintf("/Videos/%s/stream?MediaSourceId=%s&Static=true&%s", *mediasource.ID, *mediasource.ID, apikeypair)
+					directStreamURL = addPlaySessionID(directStreamURL, playbackInfoResponse.PlaySessionID)
 					playbackInfoResponse.MediaSources[index].DirectStreamURL = &directStreamURL
 					logging.Info(*mediasource.Name, " 强制禁止转码，直链播放链接为: ", directStreamURL)
 				}
 			}
 
 		case constants.AlistStrm: // AlistStm 设置支持直链播放并且禁止转码
-			if !config.AlistStrm.TransCode {
+			if !cfg.AlistStrm.TransCode {
 				*playbackInfoResponse.MediaSources[index].SupportsDirectPlay = true
 				*playbackInfoResponse.MediaSources[index].SupportsDirectStream = true
 				*playbackInfoResponse.MediaSources[index].SupportsTranscoding = false
@@ -173,6 +243,7 @@ func (jellyfinHandler *JellyfinHandler) ModifyPlaybackInfo(rw *http.Response) er
 					}
 					directStreamURL += "&" + apikeypair
 				}
+				directStreamURL = addPlaySessionID(directStreamURL, playbackInfoResponse.PlaySessionID)
 				playbackInfoResponse.MediaSources[index].DirectStreamURL = &directStreamURL
 				container := strings.TrimPrefix(path.Ext(*mediasource.Path), ".")
 				playbackInfoResponse.MediaSources[index].Container = &container
@@ -182,12 +253,12 @@ func (jellyfinHandler *JellyfinHandler) ModifyPlaybackInfo(rw *http.Response) er
 			}
 
 			if playbackInfoResponse.MediaSources[index].Size == nil {
-				alistClient, err := service.GetAlistClient(opt.(string))
+				alistGroup, err := service.GetAlistGroup(opt.(string))
 				if err != nil {
-					logging.Warning("获取 AlistClient 失败：", err)
+					logging.Warning("获取 Alist 节点组失败：", err)
 					continue
 				}
-				fsGetData, err := alistClient.FsGet(&alist.FsGetRequest{Path: *mediasource.Path, Page: 1})
+				fsGetData, err := alistGroup.FsGet(&alist.FsGetRequest{Path: alistPath, Page: 1})
 				if err != nil {
 					logging.Warning("请求 FsGet 失败：", err)
 					continue
@@ -198,6 +269,14 @@ func (jellyfinHandler *JellyfinHandler) ModifyPlaybackInfo(rw *http.Response) er
 		}
 	}
 
+	if hasStrm && session.Enabled() {
+		if err := checkPlaybackSession(rw.Request, jellyfinHandler.clientIP.ClientIP(rw.Request), playbackInfoResponse.PlaySessionID, jellyfinHandler.ResolveUser(rw.Request)); err != nil {
+			errorCode := jellyfin.RateLimitExceeded // 超出同时播放数量上限
+			playbackInfoResponse.ErrorCode = &errorCode
+			playbackInfoResponse.MediaSources = nil
+		}
+	}
+
 	if data, err = json.Marshal(playbackInfoResponse); err != nil {
 		logging.Warning("序列化 jellyfin.PlaybackInfoResponse Json 错误：", err)
 		return err
@@ -234,12 +313,16 @@ func (jellyfinHandler *JellyfinHandler) VideosHandler(ctx *gin.Context) {
 
 	// 并发控制：确保同一个 item ID 只有一个任务在运行
 	// 将整个处理流程放在锁内，避免重复查询和重复获取重定向 URL
-	var mu *sync.Mutex
+	var (
+		mu     *sync.Mutex
+		unlock = func() {}
+	)
 	if itemID != "" {
 		mutex, _ := jellyfinHandler.playbackInfoMutex.LoadOrStore(itemID, &sync.Mutex{})
 		mu = mutex.(*sync.Mutex)
 		mu.Lock()
-		defer mu.Unlock()
+		unlock = sync.OnceFunc(mu.Unlock)
+		defer unlock()
 		logging.Debugf("开始处理 item %s 的 VideosHandler 请求", itemID)
 	}
 
@@ -255,7 +338,22 @@ func (jellyfinHandler *JellyfinHandler) VideosHandler(ctx *gin.Context) {
 	item := itemResponse.Items[0]
 
 	if !strings.HasSuffix(strings.ToLower(*item.Path), ".strm") { // 不是 Strm 文件
-		logging.Debugf("播放本地视频：%s，不进行处理", *item.Path)
+		localPath := *item.Path
+		for _, mediasource := range item.MediaSources {
+			if *mediasource.ID == mediaSourceID && mediasource.Path != nil { // 多版本视频需要使用对应版本的路径
+				localPath = *mediasource.Path
+				break
+			}
+		}
+		if alistAddr, alistPath, ok := recgonizeAlistPathMap(localPath); ok {
+			alistPath = jellyfinHandler.strmRewriter.Rewrite(constants.AlistStrm, alistAddr, alistPath, ctx.Request.UserAgent(), ctx.ClientIP())
+			if redirectURL := alistStrmHandler(alistPath, alistAddr); redirectURL != "" {
+				unlock() // 已获取到媒体链接，代理模式下需要在传输媒体流之前释放锁
+				jellyfinHandler.strmStreamer.Serve(ctx, constants.AlistStrm, redirectURL)
+				return
+			}
+		}
+		logging.Debugf("播放本地视频：%s，不进行处理", localPath)
 		jellyfinHandler.proxy.ServeHTTP(ctx.Writer, ctx.Request)
 		return
 	}
@@ -263,18 +361,22 @@ func (jellyfinHandler *JellyfinHandler) VideosHandler(ctx *gin.Context) {
 	strmFileType, opt := recgonizeStrmFileType(*item.Path)
 	for _, mediasource := range item.MediaSources {
 		if *mediasource.ID == mediaSourceID { // EmbyServer >= 4.9 返回的ID带有前缀mediasource_
+			strmContent := jellyfinHandler.strmRewriter.Rewrite(strmFileType, opt, *mediasource.Path, ctx.Request.UserAgent(), ctx.ClientIP())
 			switch strmFileType {
 			case constants.HTTPStrm:
 				if *mediasource.Protocol == jellyfin.HTTP {
 					// httpStrmHandler 内部有缓存机制，锁确保串行化访问
-					ctx.Redirect(http.StatusFound, jellyfinHandler.httpStrmHandler(*mediasource.Path, ctx.Request.UserAgent()))
+					redirectURL := jellyfinHandler.httpStrmHandler(strmContent, ctx.Request.UserAgent())
+					unlock()
+					jellyfinHandler.strmStreamer.Serve(ctx, strmFileType, redirectURL)
 					return
 				}
 
 			case constants.AlistStrm: // 无需判断 *mediasource.Container 是否以Strm结尾，当 AlistStrm 存储的位置有对应的文件时，*mediasource.Container 会被设置为文件后缀
-				redirectURL := alistStrmHandler(*mediasource.Path, opt.(string))
+				redirectURL := alistStrmHandler(strmContent, opt.(string))
 				if redirectURL != "" {
-					ctx.Redirect(http.StatusFound, redirectURL)
+					unlock()
+					jellyfinHandler.strmStreamer.Serve(ctx, strmFileType, redirectURL)
 				}
 				return
 
@@ -286,8 +388,17 @@ func (jellyfinHandler *JellyfinHandler) VideosHandler(ctx *gin.Context) {
 	}
 }
 
+// 修改字幕
+//
+// /Videos/:itemId/:mediaSourceId/Subtitles/:index/:startPositionTicks/Stream.:format
+// 将 SRT 字幕转 ASS，ASS 字幕字体子集化
+func (jellyfinHandler *JellyfinHandler) ModifySubtitles(rw *http.Response) error {
+	return jellyfinHandler.subtitleModifier.ModifyResponse(rw)
+}
+
 // 修改首页函数
 func (jellyfinHandler *JellyfinHandler) ModifyIndex(rw *http.Response) error {
+	cfg := config.Get()
 	var (
 		htmlFilePath string = path.Join(config.CostomDir(), "index.html")
 		htmlContent  []byte
@@ -296,7 +407,7 @@ func (jellyfinHandler *JellyfinHandler) ModifyIndex(rw *http.Response) error {
 	)
 
 	defer rw.Body.Close() // 无论哪种情况，最终都要确保原 Body 被关闭，避免内存泄漏
-	if config.Web.Index { // 从本地文件读取index.html
+	if cfg.Web.Index {    // 从本地文件读取index.html
 		if htmlContent, err = os.ReadFile(htmlFilePath); err != nil {
 			logging.Warning("读取文件内容出错，错误信息：", err)
 			return err
@@ -307,29 +418,29 @@ func (jellyfinHandler *JellyfinHandler) ModifyIndex(rw *http.Response) error {
 		}
 	}
 
-	if config.Web.Head != "" { // 用户自定义HEAD
-		addHEAD.WriteString(config.Web.Head + "\n")
+	if cfg.Web.Head != "" { // 用户自定义HEAD
+		addHEAD.WriteString(cfg.Web.Head + "\n")
 	}
-	if config.Web.ExternalPlayerUrl { // 外部播放器
+	if cfg.Web.ExternalPlayerUrl { // 外部播放器
 		addHEAD.WriteString(`<script src="/MediaWarp/static/embyExternalUrl/embyWebAddExternalUrl/embyLaunchPotplayer.js"></script>` + "\n")
 	}
-	if config.Web.Crx { // crx 美化
+	if cfg.Web.Crx { // crx 美化
 		addHEAD.WriteString(`<link rel="stylesheet" id="theme-css" href="/MediaWarp/static/jellyfin-crx/static/css/style.css" type="text/css" media="all" />
     <script src="/MediaWarp/static/jellyfin-crx/static/js/common-utils.js"></script>
     <script src="/MediaWarp/static/jellyfin-crx/static/js/jquery-3.6.0.min.js"></script>
     <script src="/MediaWarp/static/jellyfin-crx/static/js/md5.min.js"></script>
     <script src="/MediaWarp/static/jellyfin-crx/content/main.js"></script>` + "\n")
 	}
-	if config.Web.ActorPlus { // 过滤没有头像的演员和制作人员
+	if cfg.Web.ActorPlus { // 过滤没有头像的演员和制作人员
 		addHEAD.WriteString(`<script src="/MediaWarp/static/emby-web-mod/actorPlus/actorPlus.js"></script>` + "\n")
 	}
-	if config.Web.FanartShow { // 显示同人图（fanart图）
+	if cfg.Web.FanartShow { // 显示同人图（fanart图）
 		addHEAD.WriteString(`<script src="/MediaWarp/static/emby-web-mod/fanart_show/fanart_show.js"></script>` + "\n")
 	}
-	if config.Web.Danmaku { // 弹幕
+	if cfg.Web.Danmaku { // 弹幕
 		addHEAD.WriteString(`<script src="/MediaWarp/static/jellyfin-danmaku/ede.js" defer></script>` + "\n")
 	}
-	if config.Web.VideoTogether { // VideoTogether
+	if cfg.Web.VideoTogether { // VideoTogether
 		addHEAD.WriteString(`<script src="https://2gether.video/release/extension.website.user.js"></script>` + "\n")
 	}
 
@@ -0,0 +1,342 @@
+package handler
+
+import (
+	"MediaWarp/constants"
+	"MediaWarp/internal/cache"
+	"MediaWarp/internal/config"
+	"MediaWarp/internal/logging"
+	"MediaWarp/internal/service/plex"
+	"MediaWarp/internal/session"
+	"MediaWarp/utils"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	plexStrmContentLimit = 4 * 1024         // Strm 文件内容最大读取字节数
+	plexPartCacheTTL     = 24 * time.Hour   // 媒体文件信息的缓存时间
+	plexPartIndexMinGap  = 10 * time.Minute // 两次遍历媒体库建立媒体文件索引的最小间隔
+)
+
+// Plex 服务器处理器
+type PlexHandler struct {
+	server          *plex.Plex             // Plex 服务器
+	routerRules     []RegexpRouteRule      // 正则路由规则
+	proxy           *httputil.ReverseProxy // 反向代理
+	httpStrmHandler StrmHandlerFunc
+	strmRewriter    *strmRewriter      // Strm 内容重写器
+	strmStreamer    *strmStreamer      // Strm 媒体流响应器
+	partCache       *bigcache.BigCache // Part ID -> plex.Part（JSON），Plex 播放接口中仅包含 Part ID，需要从元数据中记录文件路径
+	partIndexMutex  sync.Mutex         // 同一时间只遍历一次媒体库
+	partIndexTime   time.Time          // 上次遍历媒体库建立索引的时间
+}
+
+func NewPlexHandler(cfg *config.Setting) (*PlexHandler, error) {
+	plexHandler := PlexHandler{}
+	plexHandler.server = plex.New(cfg.MediaServer.ADDR, cfg.MediaServer.AUTH)
+	target, err := url.Parse(plexHandler.server.GetEndpoint())
+	if err != nil {
+		return nil, err
+	}
+	plexHandler.proxy = httputil.NewSingleHostReverseProxy(target)
+	plexHandler.proxy.ErrorHandler = proxyErrorHandler("ReverseProxy")
+	plexHandler.partCache, err = cache.GetPool("plex_part", plexPartCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	{ // 初始化路由规则
+		plexHandler.routerRules = []RegexpRouteRule{
+			{
+				Regexp:  constants.PlexRegexp.Router.VideosHandler,
+				Handler: plexHandler.VideosHandler,
+			},
+			{
+				Regexp:  constants.PlexRegexp.Router.TranscodeHandler,
+				Handler: plexHandler.TranscodeHandler,
+			},
+			{
+				Regexp: constants.PlexRegexp.Router.ModifyMetadata,
+				Handler: responseModifyCreater(
+					&httputil.ReverseProxy{Director: plexHandler.proxy.Director},
+					plexHandler.ModifyMetadata,
+				),
+			},
+		}
+	}
+
+	plexHandler.httpStrmHandler, err = getHTTPStrmHandler(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("创建 HTTPStrm 处理器失败: %w", err)
+	}
+	plexHandler.strmRewriter, err = newStrmRewriter(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("创建 Strm 内容重写器失败: %w", err)
+	}
+	plexHandler.strmStreamer, err = newStrmStreamer(cfg, plexHandler.ResolveUser)
+	if err != nil {
+		return nil, fmt.Errorf("创建 Strm 媒体流响应器失败: %w", err)
+	}
+	return &plexHandler, nil
+}
+
+// 根据访问令牌获取用户 ID
+//
+// Plex 的访问令牌由 plex.tv 签发，使用访问令牌向 plex.tv 查询所属的账户 ID
+func (plexHandler *PlexHandler) ResolveUser(req *http.Request) string {
+	token := utils.GetClientToken(req)
+	return session.ResolveUser(token, func() (string, error) {
+		clientID := utils.GetClientDeviceID(req)
+		if clientID == "" {
+			clientID = "MediaWarp"
+		}
+		return plex.GetAccountID(token, clientID)
+	})
+}
+
+// 转发请求至上游服务器
+func (plexHandler *PlexHandler) ReverseProxy(rw http.ResponseWriter, req *http.Request) {
+	plexHandler.proxy.ServeHTTP(rw, req)
+}
+
+// 正则路由表
+func (plexHandler *PlexHandler) GetRegexpRouteRules() []RegexpRouteRule {
+	return plexHandler.routerRules
+}
+
+func (plexHandler *PlexHandler) GetImageCacheRegexp() *regexp.Regexp {
+	return constants.PlexRegexp.Cache.Image
+}
+
+func (*PlexHandler) GetSubtitleCacheRegexp() *regexp.Regexp {
+	return constants.PlexRegexp.Cache.Subtitle
+}
+
+func (*PlexHandler) GetPlaybackRegexps() []*regexp.Regexp {
+	return []*regexp.Regexp{constants.PlexRegexp.Router.VideosHandler, constants.PlexRegexp.Router.TranscodeHandler}
+}
+
+// 记录条目元数据
+//
+// /library/metadata/:ratingKey
+// 不修改响应，仅记录 Part ID 与文件路径的对应关系
+func (plexHandler *PlexHandler) ModifyMetadata(rw *http.Response) error {
+	defer rw.Body.Close()
+	body, err := io.ReadAll(rw.Body)
+	if err != nil {
+		logging.Warning("读取 Body 出错：", err)
+		return err
+	}
+	rw.Body = io.NopCloser(bytes.NewReader(body))
+
+	if rw.StatusCode != http.StatusOK {
+		return nil
+	}
+	container, err := plex.ParseMediaContainer(body)
+	if err != nil {
+		logging.Debug("解析 plex.MediaContainer 错误：", err)
+		return nil
+	}
+	plexHandler.storeParts(container)
+	return nil
+}
+
+// 视频流处理器
+//
+// /library/parts/:partID/:changestamp/file.mkv
+// 支持播放本地视频、重定向 HttpStrm、AlistStrm
+func (plexHandler *PlexHandler) VideosHandler(ctx *gin.Context) {
+	if ctx.Request.Method == http.MethodHead { // 不额外处理 HEAD 请求
+		plexHandler.ReverseProxy(ctx.Writer, ctx.Request)
+		logging.Debug("VideosHandler 不处理 HEAD 请求，转发至上游服务器")
+		return
+	}
+
+	var part *plex.Part
+	if matches := constants.PlexRegexp.Others.PartID.FindStringSubmatch(ctx.Request.URL.Path); len(matches) == 2 {
+		part = plexHandler.loadPart(matches[1])
+	}
+	if part == nil {
+		logging.Debugf("未找到 %s 对应的媒体文件信息，转发至上游服务器", ctx.Request.URL.Path)
+		plexHandler.ReverseProxy(ctx.Writer, ctx.Request)
+		return
+	}
+
+	if !plexHandler.redirectPart(ctx, part) {
+		plexHandler.ReverseProxy(ctx.Writer, ctx.Request)
+	}
+}
+
+// 转码播放处理器
+//
+// /video/:/transcode/universal/start?path=/library/metadata/:ratingKey
+// 禁止转码时将 Strm 文件直接重定向，HLS / DASH 播放列表请求转发至上游服务器
+func (plexHandler *PlexHandler) TranscodeHandler(ctx *gin.Context) {
+	cfg := config.Get()
+	if ext := path.Ext(ctx.Request.URL.Path); ext == ".m3u8" || ext == ".mpd" {
+		plexHandler.ReverseProxy(ctx.Writer, ctx.Request)
+		return
+	}
+
+	matches := constants.PlexRegexp.Others.RatingKey.FindStringSubmatch(ctx.Query("path"))
+	if len(matches) != 2 {
+		plexHandler.ReverseProxy(ctx.Writer, ctx.Request)
+		return
+	}
+
+	logging.Debugf("请求 GetMetadata：%s", matches[1])
+	container, err := plexHandler.server.GetMetadata(matches[1])
+	if err != nil {
+		logging.Warning("请求 GetMetadata 失败：", err)
+		plexHandler.ReverseProxy(ctx.Writer, ctx.Request)
+		return
+	}
+	plexHandler.storeParts(container)
+
+	for _, item := range container.Items() {
+		for _, media := range item.Media {
+			for _, part := range media.Part {
+				strmFileType, _ := recgonizeStrmFileType(part.File)
+				if _, _, ok := recgonizeAlistPathMap(part.File); ok && !strings.HasSuffix(strings.ToLower(part.File), ".strm") {
+					strmFileType = constants.AlistStrm // 挂载的网盘文件按 AlistStrm 处理
+				}
+				if (strmFileType == constants.HTTPStrm && cfg.HTTPStrm.TransCode) ||
+					(strmFileType == constants.AlistStrm && cfg.AlistStrm.TransCode) {
+					logging.Infof("%s 保持原有转码设置", item.Title)
+					continue
+				}
+				if plexHandler.redirectPart(ctx, &part) {
+					return
+				}
+			}
+		}
+	}
+	plexHandler.ReverseProxy(ctx.Writer, ctx.Request)
+}
+
+// 记录 MediaContainer 中所有的媒体文件
+func (plexHandler *PlexHandler) storeParts(container *plex.MediaContainer) {
+	for _, item := range container.Items() {
+		for _, media := range item.Media {
+			for _, part := range media.Part {
+				plexHandler.storePart(&part)
+			}
+		}
+	}
+}
+
+func (plexHandler *PlexHandler) storePart(part *plex.Part) {
+	data, err := json.Marshal(part)
+	if err != nil {
+		return
+	}
+	if err := plexHandler.partCache.Set(strconv.FormatInt(part.ID, 10), data); err != nil {
+		logging.Debug("缓存媒体文件信息失败：", err)
+	}
+}
+
+// 获取媒体文件信息
+//
+// 未缓存时（如 MediaWarp 重启后客户端直接播放）遍历 Plex 媒体库建立索引后再查找，未找到时返回 nil
+func (plexHandler *PlexHandler) loadPart(partID string) *plex.Part {
+	if part := plexHandler.cachedPart(partID); part != nil {
+		return part
+	}
+	logging.Debugf("未缓存媒体文件 %s 的信息，从 Plex 媒体库中查找", partID)
+	plexHandler.indexParts()
+	return plexHandler.cachedPart(partID)
+}
+
+// 获取已缓存的媒体文件信息
+func (plexHandler *PlexHandler) cachedPart(partID string) *plex.Part {
+	data, err := plexHandler.partCache.Get(partID)
+	if err != nil {
+		return nil
+	}
+	var part plex.Part
+	if json.Unmarshal(data, &part) != nil {
+		return nil
+	}
+	return &part
+}
+
+// 遍历 Plex 媒体库，记录所有媒体文件的信息
+//
+// 距离上次遍历不足 plexPartIndexMinGap 时不再重复遍历，避免不存在的 Part ID 反复触发遍历
+func (plexHandler *PlexHandler) indexParts() {
+	plexHandler.partIndexMutex.Lock()
+	defer plexHandler.partIndexMutex.Unlock()
+	if time.Since(plexHandler.partIndexTime) < plexPartIndexMinGap {
+		return
+	}
+	plexHandler.partIndexTime = time.Now()
+
+	parts, err := plexHandler.server.GetParts()
+	if err != nil {
+		logging.Warning("遍历 Plex 媒体库失败：", err)
+		return
+	}
+	for i := range parts {
+		plexHandler.storePart(&parts[i])
+	}
+	logging.Infof("已记录 Plex 媒体库中 %d 个媒体文件的信息", len(parts))
+}
+
+// 重定向媒体文件
+//
+// 返回是否已经处理了该请求
+func (plexHandler *PlexHandler) redirectPart(ctx *gin.Context, part *plex.Part) bool {
+	if !strings.HasSuffix(strings.ToLower(part.File), ".strm") { // 不是 Strm 文件
+		if alistAddr, alistPath, ok := recgonizeAlistPathMap(part.File); ok {
+			alistPath = plexHandler.strmRewriter.Rewrite(constants.AlistStrm, alistAddr, alistPath, ctx.Request.UserAgent(), ctx.ClientIP())
+			if redirectURL := alistStrmHandler(alistPath, alistAddr); redirectURL != "" {
+				plexHandler.strmStreamer.Serve(ctx, constants.AlistStrm, redirectURL)
+				return true
+			}
+		}
+		logging.Debugf("播放本地视频：%s，不进行处理", part.File)
+		return false
+	}
+
+	strmFileType, opt := recgonizeStrmFileType(part.File)
+	if strmFileType == constants.UnknownStrm {
+		return false
+	}
+
+	content, err := plexHandler.server.GetPartContent(part.Key, plexStrmContentLimit)
+	if err != nil {
+		logging.Warning("读取 Strm 文件内容失败：", err)
+		return false
+	}
+	strmContent := plexHandler.strmRewriter.Rewrite(strmFileType, opt, strings.TrimSpace(string(content)), ctx.Request.UserAgent(), ctx.ClientIP())
+
+	switch strmFileType {
+	case constants.HTTPStrm:
+		plexHandler.strmStreamer.Serve(ctx, strmFileType, plexHandler.httpStrmHandler(strmContent, ctx.Request.UserAgent()))
+		return true
+
+	case constants.AlistStrm:
+		redirectURL := alistStrmHandler(strmContent, opt.(string))
+		if redirectURL != "" {
+			plexHandler.strmStreamer.Serve(ctx, strmFileType, redirectURL)
+			return true
+		}
+	}
+	return false
+}
+
+var _ MediaServerHandler = (*PlexHandler)(nil) // 确保 PlexHandler 实现 MediaServerHandler 接口
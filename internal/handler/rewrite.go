@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"MediaWarp/constants"
+	"MediaWarp/internal/config"
+	"MediaWarp/internal/logging"
+	"MediaWarp/utils"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Strm 内容重写规则
+type rewriteRule struct {
+	regexp  *regexp.Regexp
+	replace string
+	uaList  []string
+	cidr    *utils.CIDRMatcher
+}
+
+// 判断规则是否对该客户端生效
+func (rule *rewriteRule) match(ua string, clientIP string) bool {
+	if len(rule.uaList) > 0 {
+		matched := false
+		for _, s := range rule.uaList {
+			if strings.Contains(ua, s) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return rule.cidr.Match(clientIP)
+}
+
+// 有序的 Strm 内容重写规则列表
+type rewriteRules []rewriteRule
+
+func newRewriteRules(settings []config.RewriteSetting) (rewriteRules, error) {
+	rules := make(rewriteRules, 0, len(settings))
+	for index, setting := range settings {
+		reg, err := regexp.Compile(setting.Regexp)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 条重写规则正则表达式 %s 错误: %w", index+1, setting.Regexp, err)
+		}
+		cidr, err := utils.NewCIDRMatcher(setting.CIDRList)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 条重写规则%w", index+1, err)
+		}
+		rule := rewriteRule{
+			regexp:  reg,
+			replace: setting.Replace,
+			uaList:  setting.UAList,
+			cidr:    cidr,
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// 依次应用所有对该客户端生效的规则
+func (rules rewriteRules) Rewrite(content string, ua string, clientIP string) string {
+	result := content
+	for _, rule := range rules {
+		if !rule.regexp.MatchString(result) || !rule.match(ua, clientIP) {
+			continue
+		}
+		result = rule.regexp.ReplaceAllString(result, rule.replace)
+	}
+	if result != content {
+		logging.Debugf("Strm 内容 %s 重写为：%s", content, result)
+	}
+	return result
+}
+
+// Strm 内容重写器
+//
+// 在解析 Strm 内容（获取 Alist 链接、HTTP 重定向）之前重写 Strm 内容，用于修正旧的主机名、挂载点等
+type strmRewriter struct {
+	httpStrm  rewriteRules            // HTTPStrm 重写规则
+	alistStrm map[string]rewriteRules // Alist 服务器地址 -> AlistStrm 重写规则
+}
+
+func newStrmRewriter(cfg *config.Setting) (*strmRewriter, error) {
+	var (
+		rewriter = strmRewriter{alistStrm: make(map[string]rewriteRules)}
+		err      error
+	)
+	if cfg.HTTPStrm.Enable {
+		if rewriter.httpStrm, err = newRewriteRules(cfg.HTTPStrm.RewriteList); err != nil {
+			return nil, fmt.Errorf("HTTPStrm %w", err)
+		}
+	}
+	if cfg.AlistStrm.Enable {
+		for _, alistStrmConfig := range cfg.AlistStrm.List {
+			rules, err := newRewriteRules(alistStrmConfig.RewriteList)
+			if err != nil {
+				return nil, fmt.Errorf("AlistStrm（%s）%w", alistStrmConfig.ADDR, err)
+			}
+			rewriter.alistStrm[alistStrmConfig.ADDR] = append(rewriter.alistStrm[alistStrmConfig.ADDR], rules...)
+		}
+	}
+	return &rewriter, nil
+}
+
+// 重写 Strm 内容
+//
+// opt 为 recgonizeStrmFileType 返回的可选配置
+func (rewriter *strmRewriter) Rewrite(strmFileType constants.StrmFileType, opt any, content string, ua string, clientIP string) string {
+	switch strmFileType {
+	case constants.HTTPStrm:
+		return rewriter.httpStrm.Rewrite(content, ua, clientIP)
+	case constants.AlistStrm:
+		if alistAddr, ok := opt.(string); ok {
+			return rewriter.alistStrm[alistAddr].Rewrite(content, ua, clientIP)
+		}
+	}
+	return content
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"net/http"
 	"regexp"
+	"sync/atomic"
 )
 
 // 媒体服务器处理接口
@@ -14,26 +15,46 @@ type MediaServerHandler interface {
 	GetRegexpRouteRules() []RegexpRouteRule          // 获取正则路由表
 	GetImageCacheRegexp() *regexp.Regexp             // 获取图片缓存正则表达式
 	GetSubtitleCacheRegexp() *regexp.Regexp          // 字幕缓存正则表达式
+	GetPlaybackRegexps() []*regexp.Regexp            // 播放请求正则表达式（用于限流）
+	ResolveUser(*http.Request) string                // 根据访问令牌获取用户 ID，无法识别时返回空字符串
 }
 
-var mediaServerHandler MediaServerHandler
+var mediaServerHandler atomic.Value // 当前使用的媒体服务器处理器
 var ErrInvalidMediaServerType = errors.New("错误的媒体服务器类型")
 
 // 初始化媒体服务器处理器
 func Init() error {
-	var err error
-	switch config.MediaServer.Type {
+	handler, err := New(config.Get())
+	if err != nil {
+		return err
+	}
+	SetMediaServer(handler)
+	return nil
+}
+
+// 根据配置创建媒体服务器处理器
+//
+// 使用传入的 cfg 而不是当前配置，重新加载配置时可以在替换配置前创建处理器
+func New(cfg *config.Setting) (MediaServerHandler, error) {
+	switch cfg.MediaServer.Type {
 	case constants.EMBY:
-		mediaServerHandler, err = NewEmbyServerHandler(config.MediaServer.ADDR, config.MediaServer.AUTH)
+		return NewEmbyServerHandler(cfg)
 	case constants.JELLYFIN:
-		mediaServerHandler, err = NewJellyfinHander(config.MediaServer.ADDR, config.MediaServer.AUTH)
+		return NewJellyfinHander(cfg)
+	case constants.PLEX:
+		return NewPlexHandler(cfg)
 	default:
-		err = ErrInvalidMediaServerType
+		return nil, ErrInvalidMediaServerType
 	}
-	return err
 }
 
 // 获取媒体服务器接口
 func GetMediaServer() MediaServerHandler {
-	return mediaServerHandler
+	handler, _ := mediaServerHandler.Load().(MediaServerHandler)
+	return handler
+}
+
+// 替换媒体服务器处理器（重新加载配置时使用）
+func SetMediaServer(handler MediaServerHandler) {
+	mediaServerHandler.Store(handler)
 }
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"MediaWarp/internal/logging"
+	"MediaWarp/internal/session"
+	"MediaWarp/utils"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const playingSessionBodyLimit = 1 << 20 // 播放进度上报请求体的最大读取长度
+
+// 请求路径中的用户 ID，如 /emby/Users/6f2b1f8e5c1a4c0f9d0e7b3a2c1d4e5f/Items
+var userIDPattern = regexp.MustCompile(`(?i)/Users/([0-9a-f]{32}|[0-9a-f-]{36})(/|$)`)
+
+// 获取请求中携带的用户 ID
+//
+// 依次从 X-Emby-UserId、查询参数 UserId、请求路径中获取，未经媒体服务器校验
+func getRequestUserID(req *http.Request) string {
+	if userID := utils.GetEmbyAuthValue(req, "X-Emby-UserId", "UserId", "UserId"); userID != "" {
+		return userID
+	}
+	if matches := userIDPattern.FindStringSubmatch(req.URL.Path); matches != nil {
+		return matches[1]
+	}
+	return ""
+}
+
+// 获取请求中的播放会话 ID（Emby、Jellyfin 的 PlaySessionId，Plex 的 X-Plex-Session-Identifier）
+func getPlaySessionID(req *http.Request) string {
+	if playSessionID := getQueryValueCaseInsensitive(req.URL.Query(), "PlaySessionId"); playSessionID != "" {
+		return playSessionID
+	}
+	return utils.GetEmbyAuthValue(req, "X-Plex-Session-Identifier", "", "X-Plex-Session-Identifier")
+}
+
+// 在直链播放链接中添加 PlaySessionId
+//
+// 客户端请求媒体流时据此识别播放会话
+func addPlaySessionID(directStreamURL string, playSessionID *string) string {
+	if playSessionID == nil || *playSessionID == "" || strings.Contains(strings.ToLower(directStreamURL), "playsessionid=") {
+		return directStreamURL
+	}
+	return directStreamURL + "&PlaySessionId=" + url.QueryEscape(*playSessionID)
+}
+
+// 检查 PlaybackInfo 请求的客户端是否可以开始新的播放
+//
+// clientIP 为客户端 IP，userID 为通过访问令牌查询到的用户 ID；
+// 可以播放时记录 PlaySessionId 对应的客户端，返回 nil；超出数量上限时返回错误
+func checkPlaybackSession(req *http.Request, clientIP string, playSessionID *string, userID string) error {
+	var (
+		owner = session.NewOwner(req, clientIP, userID)
+		id    string
+	)
+	if playSessionID != nil {
+		id = *playSessionID
+	}
+	if err := session.Check(owner, id); err != nil {
+		logging.Infof("%s，拒绝播放：%s", err, req.URL.Path)
+		return err
+	}
+	session.Prepare(id, owner)
+	return nil
+}
+
+// 播放进度上报处理器
+//
+// /Sessions/Playing、/Sessions/Playing/Progress、/Sessions/Playing/Ping 刷新会话的活跃时间，
+// /Sessions/Playing/Stopped 结束会话，随后将请求转发至上游服务器
+func playingSessionHandler(proxy http.Handler) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		playSessionID := getPlaySessionID(ctx.Request)
+		if playSessionID == "" && ctx.Request.Body != nil {
+			originalBody := ctx.Request.Body
+			body, err := io.ReadAll(io.LimitReader(originalBody, playingSessionBodyLimit))
+			if err != nil {
+				logging.Warning("读取播放进度上报请求体失败：", err)
+				ctx.Status(http.StatusBadRequest)
+				return
+			}
+			ctx.Request.Body = struct { // 超出读取长度的部分继续从原请求体中读取
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), originalBody), originalBody}
+
+			var playbackInfo struct {
+				PlaySessionID string `json:"PlaySessionId"`
+			}
+			if err := json.Unmarshal(body, &playbackInfo); err == nil {
+				playSessionID = playbackInfo.PlaySessionID
+			}
+		}
+
+		if playSessionID != "" {
+			if strings.HasSuffix(strings.ToLower(ctx.Request.URL.Path), "/stopped") {
+				logging.Debugf("播放会话 %s 已停止", playSessionID)
+				session.Stop(playSessionID)
+			} else {
+				session.Touch(playSessionID)
+			}
+		}
+		proxy.ServeHTTP(ctx.Writer, ctx.Request)
+	}
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"MediaWarp/constants"
+	"MediaWarp/internal/config"
+	"MediaWarp/internal/logging"
+	"MediaWarp/internal/metrics"
+	"MediaWarp/internal/session"
+	"MediaWarp/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	streamBufferSize = 256 * 1024 // 代理媒体流的缓冲区大小
+
+	defaultChunkSize  = 4  // 默认分块大小（MB）
+	defaultBufferSize = 64 // 默认预读缓冲区大小（MB）
+	defaultRetry      = 3  // 默认分块下载失败重试次数
+)
+
+var (
+	// 转发给上游的请求头
+	streamRequestHeaders = []string{"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "User-Agent", "Accept"}
+	// 转发给客户端的响应头
+	streamResponseHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified", "ETag", "Cache-Control", "Expires", "Content-Disposition"}
+
+	streamBufferPool = sync.Pool{New: func() any { return make([]byte, streamBufferSize) }}
+)
+
+// Strm 媒体流响应器
+//
+// 根据 Strm 类型和客户端 User-Agent 决定 302 重定向还是代理媒体流
+type strmStreamer struct {
+	httpStrmProxyUA  []*regexp.Regexp
+	alistStrmProxyUA []*regexp.Regexp
+	downloader       *utils.RangeDownloader         // 多连接分块下载器，未启用时为 nil
+	resolveUser      func(req *http.Request) string // 根据访问令牌获取用户 ID（用于播放会话管理）
+}
+
+func newStrmStreamer(cfg *config.Setting, resolveUser func(req *http.Request) string) (*strmStreamer, error) {
+	var (
+		streamer = strmStreamer{resolveUser: resolveUser}
+		err      error
+	)
+	if streamer.httpStrmProxyUA, err = compileRegexps(cfg.HTTPStrm.ProxyUAList); err != nil {
+		return nil, fmt.Errorf("HTTPStrm proxy_ua %w", err)
+	}
+	if streamer.alistStrmProxyUA, err = compileRegexps(cfg.AlistStrm.ProxyUAList); err != nil {
+		return nil, fmt.Errorf("AlistStrm proxy_ua %w", err)
+	}
+
+	if setting := cfg.ProxyStream; setting.Connections > 1 {
+		chunkSize, bufferSize, retry := setting.ChunkSize, setting.BufferSize, setting.Retry
+		if chunkSize <= 0 {
+			chunkSize = defaultChunkSize
+		}
+		if bufferSize <= 0 {
+			bufferSize = defaultBufferSize
+		}
+		if retry <= 0 {
+			retry = defaultRetry
+		}
+		streamer.downloader = utils.NewRangeDownloader(utils.GetRangeHTTPClient(), setting.Connections, chunkSize<<20, bufferSize<<20, retry)
+		logging.Infof("代理媒体流启用多连接分块下载，并发连接数：%d，分块大小：%dMB，预读缓冲区大小：%dMB", setting.Connections, chunkSize, bufferSize)
+	}
+	return &streamer, nil
+}
+
+// 编译正则表达式列表
+func compileRegexps(exprs []string) ([]*regexp.Regexp, error) {
+	regs := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		reg, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("正则表达式 %s 错误: %w", expr, err)
+		}
+		regs = append(regs, reg)
+	}
+	return regs, nil
+}
+
+// 获取客户端使用的响应模式
+func (streamer *strmStreamer) Mode(strmFileType constants.StrmFileType, ua string) constants.StreamMode {
+	cfg := config.Get()
+	var (
+		mode constants.StreamMode
+		regs []*regexp.Regexp
+	)
+	switch strmFileType {
+	case constants.HTTPStrm:
+		mode, regs = cfg.HTTPStrm.Mode, streamer.httpStrmProxyUA
+	case constants.AlistStrm:
+		mode, regs = cfg.AlistStrm.Mode, streamer.alistStrmProxyUA
+	default:
+		return constants.RedirectMode
+	}
+	if mode == constants.ProxyMode {
+		return mode
+	}
+	for _, reg := range regs {
+		if reg.MatchString(ua) {
+			return constants.ProxyMode
+		}
+	}
+	return constants.RedirectMode
+}
+
+// 响应媒体链接
+//
+// 重定向模式下 302 重定向至 mediaURL，代理模式下由 MediaWarp 请求 mediaURL 并将媒体流转发给客户端；
+// 启用播放会话管理时，超出同时播放数量上限的客户端会收到 429 响应
+func (streamer *strmStreamer) Serve(ctx *gin.Context, strmFileType constants.StrmFileType, mediaURL string) {
+	mode := streamer.Mode(strmFileType, ctx.Request.UserAgent())
+	if session.Enabled() {
+		owner := session.NewOwner(ctx.Request, ctx.ClientIP(), streamer.resolveUser(ctx.Request))
+		release, err := session.Start(getPlaySessionID(ctx.Request), owner, ctx.Request.URL.Path, strmFileType.String(), mode.String(), mode == constants.ProxyMode)
+		if err != nil {
+			logging.Infof("%s，拒绝播放：%s", err, ctx.Request.URL.Path)
+			ctx.String(http.StatusTooManyRequests, err.Error())
+			return
+		}
+		defer release()
+	}
+	metrics.StrmRedirects.Inc(strmFileType.String(), mode.String())
+	if mode != constants.ProxyMode {
+		ctx.Redirect(http.StatusFound, mediaURL)
+		return
+	}
+	logging.Infof("%s 使用代理模式，代理媒体流：%s", strmFileType, mediaURL)
+	streamer.proxyStream(ctx, mediaURL)
+}
+
+// 代理媒体流
+//
+// 支持 Range 请求，客户端断开连接时会同时取消上游请求；
+// 启用多连接分块下载时，较大的范围会拆分为多个分块并发下载
+func (streamer *strmStreamer) proxyStream(ctx *gin.Context, mediaURL string) {
+	req, err := http.NewRequestWithContext(ctx.Request.Context(), ctx.Request.Method, mediaURL, nil)
+	if err != nil {
+		logging.Warning("创建媒体流请求失败：", err)
+		ctx.Status(http.StatusBadGateway)
+		return
+	}
+	for _, key := range streamRequestHeaders {
+		if value := ctx.Request.Header.Get(key); value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+
+	resp, err := utils.GetStreamHTTPClient().Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			logging.Debug("客户端已断开连接，取消媒体流请求：", mediaURL)
+			return
+		}
+		logging.Warning("请求媒体流失败：", err)
+		ctx.Status(http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, key := range streamResponseHeaders {
+		if value := resp.Header.Get(key); value != "" {
+			ctx.Writer.Header().Set(key, value)
+		}
+	}
+	ctx.Status(resp.StatusCode)
+	if resp.StatusCode >= http.StatusBadRequest {
+		logging.Warningf("上游媒体流响应异常状态码：%d，URL：%s", resp.StatusCode, mediaURL)
+	}
+	if ctx.Request.Method == http.MethodHead {
+		ctx.Writer.WriteHeaderNow()
+		return
+	}
+
+	var (
+		written int64
+		start   int64
+		end     int64
+		ok      bool
+	)
+	if streamer.downloader != nil {
+		start, end, ok = parseStreamRange(resp)
+		ok = ok && end-start+1 > 2*streamer.downloader.ChunkSize() // 范围较小时直接转发
+	}
+	if ok {
+		logging.Debugf("使用多连接分块下载，范围：%d-%d，URL：%s", start, end, mediaURL)
+		written, err = streamer.downloader.Copy(ctx.Request.Context(), resp.Request.URL, req.Header, resp.Body, start, end, ctx.Writer) // 使用重定向后的最终 URL
+	} else {
+		buf := streamBufferPool.Get().([]byte)
+		defer streamBufferPool.Put(buf)
+		written, err = io.CopyBuffer(ctx.Writer, resp.Body, buf)
+	}
+	switch {
+	case err == nil:
+		logging.Debugf("媒体流代理完成，共传输 %d 字节：%s", written, mediaURL)
+	case errors.Is(err, context.Canceled), errors.Is(err, syscall.EPIPE), errors.Is(err, syscall.ECONNRESET):
+		logging.Debugf("客户端已断开连接，已传输 %d 字节：%s", written, mediaURL)
+	default:
+		logging.Warningf("代理媒体流出错，已传输 %d 字节：%s", written, err)
+	}
+}
+
+// 解析媒体流响应对应的字节范围
+//
+// 206 响应读取 Content-Range，200 响应要求上游支持 Range 请求并且返回了 Content-Length
+func parseStreamRange(resp *http.Response) (int64, int64, bool) {
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		var start, end int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/", &start, &end); err != nil || end < start {
+			return 0, 0, false
+		}
+		return start, end, true
+	case http.StatusOK:
+		if resp.Header.Get("Accept-Ranges") != "bytes" || resp.ContentLength <= 0 {
+			return 0, 0, false
+		}
+		return 0, resp.ContentLength - 1, true
+	default:
+		return 0, 0, false
+	}
+}
@@ -1,10 +1,10 @@
 package handler
 
 import (
+	"MediaWarp/internal/cache"
 	"MediaWarp/internal/config"
 	"MediaWarp/internal/logging"
 	"MediaWarp/internal/service"
-	"context"
 	"fmt"
 	"net/http"
 
@@ -13,15 +13,15 @@ import (
 
 type StrmHandlerFunc func(content string, ua string) string
 
-func getHTTPStrmHandler() (StrmHandlerFunc, error) {
-	var cache *bigcache.BigCache
-	if config.Cache.Enable && config.Cache.HTTPStrmTTL > 0 && config.HTTPStrm.FinalURL {
+func getHTTPStrmHandler(cfg *config.Setting) (StrmHandlerFunc, error) {
+	var urlCache *bigcache.BigCache
+	if cfg.Cache.Enable && cfg.Cache.HTTPStrmTTL > 0 && cfg.HTTPStrm.FinalURL {
 		var err error
-		cache, err = bigcache.New(context.Background(), bigcache.DefaultConfig(config.Cache.HTTPStrmTTL))
+		urlCache, err = cache.GetPool("http_strm", cfg.Cache.HTTPStrmTTL)
 		if err != nil {
 			return nil, fmt.Errorf("创建 HTTPStrm 缓存失败: %w", err)
 		}
-		logging.Info("启用 HTTPStrm 缓存，TTL: ", config.Cache.HTTPStrmTTL)
+		logging.Info("启用 HTTPStrm 缓存，TTL: ", cfg.Cache.HTTPStrmTTL)
 	}
 
 	client := &http.Client{ // 创建自定义HTTP客户端配置
@@ -32,9 +32,9 @@ func getHTTPStrmHandler() (StrmHandlerFunc, error) {
 		},
 	}
 	return func(content string, ua string) string {
-		if config.HTTPStrm.FinalURL {
-			if cache != nil {
-				if cachedURL, err := cache.Get(content); err == nil {
+		if cfg.HTTPStrm.FinalURL {
+			if urlCache != nil {
+				if cachedURL, err := urlCache.Get(content); err == nil {
 					logging.Infof("HTTPStrm 重定向至: %s (缓存)", string(cachedURL))
 					return string(cachedURL)
 				}
@@ -47,8 +47,8 @@ func getHTTPStrmHandler() (StrmHandlerFunc, error) {
 			} else {
 				logging.Info("HTTPStrm 重定向至: ", finalURL)
 			}
-			if cache != nil {
-				if err := cache.Set(content, []byte(finalURL)); err != nil {
+			if urlCache != nil {
+				if err := urlCache.Set(content, []byte(finalURL)); err != nil {
 					logging.Warning("缓存 HTTPStrm URL 失败: ", err)
 				} else {
 					logging.Debug("缓存 HTTPStrm URL 成功")
@@ -63,12 +63,12 @@ func getHTTPStrmHandler() (StrmHandlerFunc, error) {
 }
 
 func alistStrmHandler(content string, alistAddr string) string {
-	alistClient, err := service.GetAlistClient(alistAddr)
+	alistGroup, err := service.GetAlistGroup(alistAddr)
 	if err != nil {
-		logging.Warning("获取 AlistClient 失败：", err)
+		logging.Warning("获取 Alist 节点组失败：", err)
 		return ""
 	}
-	url, err := alistClient.GetFileURL(content, config.AlistStrm.RawURL)
+	url, err := alistGroup.GetFileURL(content, config.Get().AlistStrm.RawURL)
 	if err != nil {
 		logging.Warning("获取文件 URL 失败：", err)
 		return ""
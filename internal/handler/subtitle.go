@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"MediaWarp/internal/cache"
+	"MediaWarp/internal/config"
+	"MediaWarp/internal/fonts"
+	"MediaWarp/internal/logging"
+	"MediaWarp/utils"
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+const defaultFontSubsetTTL = 24 * time.Hour // 未启用字幕缓存时字体子集的缓存时间
+
+// 字幕处理器
+//
+// Emby、Jellyfin 共用，负责 SRT 字幕转 ASS 以及 ASS 字幕字体子集化
+type subtitleModifier struct {
+	library *fonts.Library     // 本地字体库
+	cache   *bigcache.BigCache // 字体子集缓存（字幕 + 字体 -> 子集化后的字体）
+}
+
+func newSubtitleModifier(cfg *config.Setting) (*subtitleModifier, error) {
+	var modifier subtitleModifier
+	if !cfg.Subtitle.SubSet {
+		return &modifier, nil
+	}
+
+	library, err := fonts.NewLibrary(cfg.Subtitle.FontLibraryDir())
+	if err != nil {
+		return nil, err
+	}
+	logging.Infof("字体子集化已启用，字体目录：%s，共加载 %d 个字体名称", cfg.Subtitle.FontLibraryDir(), library.Len())
+	modifier.library = library
+
+	ttl := defaultFontSubsetTTL
+	if cfg.Cache.Enable && cfg.Cache.SubtitleTTL > 0 {
+		ttl = cfg.Cache.SubtitleTTL
+	}
+	modifier.cache, err = cache.GetPool("font_subset", ttl)
+	if err != nil {
+		return nil, fmt.Errorf("创建字体子集缓存失败: %w", err)
+	}
+	return &modifier, nil
+}
+
+// 修改字幕响应
+//
+// 将 SRT 字幕转 ASS，并对 ASS 字幕中使用到的字体进行子集化后嵌入字幕
+func (modifier *subtitleModifier) ModifyResponse(rw *http.Response) error {
+	cfg := config.Get()
+	defer rw.Body.Close()
+	subtitile, err := io.ReadAll(rw.Body) // 读取字幕文件
+	if err != nil {
+		logging.Warning("读取原始字幕 Body 出错：", err)
+		return err
+	}
+
+	if utils.IsSRT(subtitile) { // 判断是否为 SRT 格式
+		logging.Info("字幕文件为 SRT 格式")
+		if cfg.Subtitle.SRT2ASS {
+			logging.Info("已将 SRT 字幕已转为 ASS 格式")
+			subtitile = utils.SRT2ASS(subtitile, cfg.Subtitle.ASSStyle)
+			rw.Header.Set("Content-Type", "text/x-ssa; charset=utf-8")
+		}
+	}
+
+	if modifier.library != nil && utils.IsASS(subtitile) {
+		subtitile = modifier.embedFonts(subtitile)
+	}
+
+	rw.Header.Set("Content-Length", strconv.Itoa(len(subtitile)))
+	rw.Body = io.NopCloser(bytes.NewReader(subtitile))
+	return nil
+}
+
+// 子集化 ASS 字幕中使用到的字体并嵌入字幕
+func (modifier *subtitleModifier) embedFonts(subtitle []byte) []byte {
+	var (
+		startTime   = time.Now()
+		subtitleKey = utils.MD5Hash(string(subtitle))
+		embedded    = make(map[string][]byte) // 嵌入的字体文件名 -> 子集化后的字体
+	)
+
+	type faceGlyphs struct {
+		face   *fonts.Face
+		glyphs utils.SetInterface[rune]
+	}
+	faces := make(map[string]*faceGlyphs) // 不同的字体名称可能匹配到同一个字体，需要合并字符
+	for font, glyphs := range utils.CollectASSFontGlyphs(subtitle) {
+		face, ok := modifier.library.Match(font.Name, font.Bold, font.Italic)
+		if !ok {
+			logging.Debugf("字体库中未找到字体：%s", font.Name)
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", face.Path, face.Index)
+		if _, ok := faces[key]; !ok {
+			faces[key] = &faceGlyphs{face: face, glyphs: utils.NewSet[rune]()}
+		}
+		faces[key].glyphs.Adds(glyphs.Values()...)
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(faces)) { // 按顺序处理，同名的字体文件得到固定的文件名
+		item := faces[key]
+		data, err := modifier.cache.Get(subtitleKey + ":" + key)
+		if err != nil {
+			data, err = modifier.library.Subset(item.face, item.glyphs.Values())
+			if err != nil {
+				logging.Warningf("字体 %s 子集化失败：%s", item.face.Path, err)
+				continue
+			}
+			if err := modifier.cache.Set(subtitleKey+":"+key, data); err != nil {
+				logging.Warning("缓存字体子集失败：", err)
+			}
+		}
+
+		// 字体集合中的多个字体、不同目录中的同名字体文件需要使用不同的文件名
+		name := item.face.FileName()
+		for i := 1; embedded[name] != nil; i++ {
+			ext := path.Ext(item.face.FileName())
+			name = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(item.face.FileName(), ext), i, ext)
+		}
+		embedded[name] = data
+	}
+
+	if len(embedded) == 0 {
+		return subtitle
+	}
+	logging.Infof("已嵌入 %d 个子集化字体，耗时：%s", len(embedded), time.Since(startTime))
+	return utils.EmbedASSFonts(subtitle, embedded)
+}
@@ -4,11 +4,16 @@ import (
 	"MediaWarp/constants"
 	"MediaWarp/internal/config"
 	"MediaWarp/internal/logging"
+	"MediaWarp/internal/metrics"
+	"MediaWarp/utils"
+	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"path"
 	"reflect"
 	"runtime"
 	"runtime/debug"
@@ -34,12 +39,28 @@ func responseModifyCreater(proxy *httputil.ReverseProxy, modifyResponseFN func(r
 		}()
 		return modifyResponseFN(rw)
 	}
+	proxy.ErrorHandler = proxyErrorHandler(funcName)
 
 	return func(ctx *gin.Context) {
 		proxy.ServeHTTP(ctx.Writer, ctx.Request)
 	}
 }
 
+// 反向代理错误处理器
+//
+// 记录转发请求至上游服务器失败的次数（不包括客户端断开连接），响应 502
+func proxyErrorHandler(handlerName string) func(rw http.ResponseWriter, req *http.Request, err error) {
+	return func(rw http.ResponseWriter, req *http.Request, err error) {
+		if errors.Is(err, context.Canceled) { // 客户端断开连接
+			logging.Debugf("%s 客户端断开连接：%s", handlerName, req.URL.Path)
+			return
+		}
+		metrics.UpstreamProxyErrors.Inc(handlerName)
+		logging.Warningf("%s 转发请求至上游服务器失败：%s", handlerName, err)
+		rw.WriteHeader(http.StatusBadGateway)
+	}
+}
+
 // 不区分大小写地获取查询参数值
 //
 // 从 url.Values 中查找指定键名的值，忽略大小写
@@ -56,20 +77,74 @@ func getQueryValueCaseInsensitive(query url.Values, key string) string {
 	return ""
 }
 
+// 反向代理请求的客户端 IP 解析器
+//
+// 用于 ModifyResponse 中，与 gin.Context.ClientIP 的行为一致：
+// 只有连接地址属于可信代理（trusted_proxies）时才使用 X-Forwarded-For、X-Real-IP；
+// X-Forwarded-For 从右向左跳过可信代理，取第一个不可信的地址
+type clientIPResolver struct {
+	trustedProxies *utils.CIDRMatcher // 可信代理，为 nil 时不信任任何代理
+}
+
+// 根据配置创建客户端 IP 解析器
+//
+// 未设置 trusted_proxies 时信任所有代理（与 gin 的默认行为一致），设置为空列表时不信任任何代理
+func newClientIPResolver(cfg *config.Setting) (*clientIPResolver, error) {
+	var resolver clientIPResolver
+	if cfg.TrustedProxies == nil || len(cfg.TrustedProxies) > 0 {
+		matcher, err := utils.NewCIDRMatcher(cfg.TrustedProxies) // 空的匹配器匹配所有地址
+		if err != nil {
+			return nil, err
+		}
+		resolver.trustedProxies = matcher
+	}
+	return &resolver, nil
+}
+
+// 获取反向代理请求对应的客户端 IP
+func (resolver *clientIPResolver) ClientIP(req *http.Request) string {
+	remoteIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		remoteIP = req.RemoteAddr
+	}
+	matcher := resolver.trustedProxies
+	if matcher == nil || !matcher.Match(remoteIP) {
+		return remoteIP
+	}
+
+	if forwardedFor := req.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		items := strings.Split(forwardedFor, ",")
+		for i := len(items) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(items[i])
+			if net.ParseIP(ip) == nil {
+				break
+			}
+			if i == 0 || !matcher.Match(ip) {
+				return ip
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(req.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return remoteIP
+}
+
 // 根据 Strm 文件路径识别 Strm 文件类型
 //
 // 返回 Strm 文件类型和一个可选配置
 func recgonizeStrmFileType(strmFilePath string) (constants.StrmFileType, any) {
-	if config.HTTPStrm.Enable {
-		for _, prefix := range config.HTTPStrm.PrefixList {
+	cfg := config.Get()
+	if cfg.HTTPStrm.Enable {
+		for _, prefix := range cfg.HTTPStrm.PrefixList {
 			if strings.HasPrefix(strmFilePath, prefix) {
 				logging.Debugf("%s 成功匹配路径：%s，Strm 类型：%s", strmFilePath, prefix, constants.HTTPStrm)
 				return constants.HTTPStrm, nil
 			}
 		}
 	}
-	if config.AlistStrm.Enable {
-		for _, alistStrmConfig := range config.AlistStrm.List {
+	if cfg.AlistStrm.Enable {
+		for _, alistStrmConfig := range cfg.AlistStrm.List {
 			for _, prefix := range alistStrmConfig.PrefixList {
 				if strings.HasPrefix(strmFilePath, prefix) {
 					logging.Debugf("%s 成功匹配路径：%s，Strm 类型：%s，AlistServer 地址：%s", strmFilePath, prefix, constants.AlistStrm, alistStrmConfig.ADDR)
@@ -82,6 +157,27 @@ func recgonizeStrmFileType(strmFilePath string) (constants.StrmFileType, any) {
 	return constants.UnknownStrm, nil
 }
 
+// 根据媒体服务器中的本地文件路径查找对应的 Alist 路径
+//
+// 用于通过 rclone、CloudDrive2 等挂载到本地的网盘文件，返回 Alist 服务器地址和 Alist 路径
+func recgonizeAlistPathMap(localPath string) (string, string, bool) {
+	cfg := config.Get()
+	if !cfg.AlistStrm.Enable {
+		return "", "", false
+	}
+	localPath = strings.ReplaceAll(localPath, "\\", "/") // 兼容 Windows 路径
+	for _, alistStrmConfig := range cfg.AlistStrm.List {
+		for _, pathMap := range alistStrmConfig.PathMapList {
+			if rest, ok := utils.TrimPathPrefix(localPath, strings.ReplaceAll(pathMap.Local, "\\", "/")); ok {
+				alistPath := path.Join("/", pathMap.Alist, rest)
+				logging.Debugf("%s 成功匹配本地路径映射：%s，Alist 路径：%s，AlistServer 地址：%s", localPath, pathMap.Local, alistPath, alistStrmConfig.ADDR)
+				return alistStrmConfig.ADDR, alistPath, true
+			}
+		}
+	}
+	return "", "", false
+}
+
 const (
 	MaxRedirectAttempts = 10               // 最大重定向次数限制
 	RedirectTimeout     = 10 * time.Second // 最大超时时间
@@ -94,7 +190,7 @@ var (
 )
 
 // 获取URL的最终目标地址（自动跟踪重定向）
-func getFinalURL(client *http.Client, rawURL string, ua string) (string, error) {
+func getFinalURL(client *http.Client, rawURL string, ua string) (finalURL string, err error) {
 	startTime := time.Now()
 	defer func() {
 		logging.Debugf("获取 %s 最终URL耗时：%s", rawURL, time.Since(startTime))
@@ -111,6 +207,13 @@ func getFinalURL(client *http.Client, rawURL string, ua string) (string, error)
 	currentURL := parsedURL.String()
 	visited := make(map[string]struct{}, MaxRedirectAttempts)
 	redirectChain := make([]string, 0, MaxRedirectAttempts+1)
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		metrics.FinalURLHops.Observe(float64(max(len(redirectChain)-1, 0)), result)
+	}()
 
 	// 跟踪重定向链
 	for i := 0; i <= MaxRedirectAttempts; i++ {
@@ -4,6 +4,7 @@ import (
 	"MediaWarp/internal/config"
 	"MediaWarp/utils"
 	"os"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
@@ -12,6 +13,7 @@ type LoggerFileHook struct {
 	isService bool
 	file      *os.File
 	day       int
+	mutex     sync.Mutex
 }
 
 func NewLoggerFileHook(isService bool) *LoggerFileHook {
@@ -28,6 +30,9 @@ func (h *LoggerFileHook) Levels() []logrus.Level {
 //
 // 将日志写入文件
 func (h *LoggerFileHook) Fire(entry *logrus.Entry) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
 	if h.file == nil || h.day != entry.Time.Day() {
 		if h.file != nil {
 			h.file.Close()
@@ -56,4 +61,19 @@ func (h *LoggerFileHook) Fire(entry *logrus.Entry) error {
 	return err
 }
 
+// 关闭日志文件
+//
+// 关闭后再次写入日志时会重新打开日志文件
+func (h *LoggerFileHook) Close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
+
 var _ logrus.Hook = (*LoggerFileHook)(nil)
@@ -4,6 +4,7 @@ import (
 	"MediaWarp/internal/config"
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -12,6 +13,9 @@ import (
 var (
 	accessLogger  = logrus.New() // 访问日志
 	serviceLogger = logrus.New() // 服务日志
+
+	accessFileHook  = NewLoggerFileHook(false) // 访问日志文件钩子
+	serviceFileHook = NewLoggerFileHook(true)  // 服务日志文件钩子
 )
 
 func init() {
@@ -19,24 +23,42 @@ func init() {
 	serviceLogger.SetFormatter(&LoggerServiceFormatter{})
 }
 
+// 根据配置初始化日志
+//
+// 可以重复调用（重新加载配置时），每次调用都会重新设置日志输出
 func Init() {
+	cfg := config.Get()
 	serviceLogger.SetReportCaller(false) // 关闭报告调用方
 
-	if !config.Logger.AccessLogger.Console { // 访问日志不输出到终端
-		accessLogger.Out = io.Discard
+	accessLogger.SetOutput(os.Stderr)
+	if !cfg.Logger.AccessLogger.Console { // 访问日志不输出到终端
+		accessLogger.SetOutput(io.Discard)
 	}
 
-	if !config.Logger.ServiceLogger.Console { // 服务日志不输出到终端
-		serviceLogger.Out = io.Discard
+	serviceLogger.SetOutput(os.Stderr)
+	if !cfg.Logger.ServiceLogger.Console { // 服务日志不输出到终端
+		serviceLogger.SetOutput(io.Discard)
 	}
 
-	if config.Logger.AccessLogger.File {
-		accessLogger.AddHook(NewLoggerFileHook(false))
+	accessHooks := make(logrus.LevelHooks)
+	if cfg.Logger.AccessLogger.File {
+		accessHooks.Add(accessFileHook)
 	}
+	accessLogger.ReplaceHooks(accessHooks)
 
-	if config.Logger.ServiceLogger.File {
-		serviceLogger.AddHook(NewLoggerFileHook(true))
+	serviceHooks := make(logrus.LevelHooks)
+	if cfg.Logger.ServiceLogger.File {
+		serviceHooks.Add(serviceFileHook)
 	}
+	serviceLogger.ReplaceHooks(serviceHooks)
+}
+
+// 关闭日志文件
+//
+// 退出时调用，确保日志写入文件
+func Close() {
+	accessFileHook.Close()
+	serviceFileHook.Close()
 }
 
 // 访问日志
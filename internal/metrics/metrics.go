@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"sync"
+)
+
+var (
+	RouteRequests = NewCounterVec(
+		"mediawarp_route_requests_total",
+		"匹配正则路由规则的请求数",
+		"rule", "code",
+	)
+	RouteDuration = NewHistogramVec(
+		"mediawarp_route_request_duration_seconds",
+		"匹配正则路由规则的请求处理耗时",
+		DefaultBuckets,
+		"rule",
+	)
+	StrmRedirects = NewCounterVec(
+		"mediawarp_strm_redirects_total",
+		"Strm 媒体链接响应次数",
+		"type", "mode",
+	)
+	AlistAPIDuration = NewHistogramVec(
+		"mediawarp_alist_api_duration_seconds",
+		"Alist API 请求耗时（不包含缓存命中）",
+		DefaultBuckets,
+		"api",
+	)
+	AlistAPIErrors = NewCounterVec(
+		"mediawarp_alist_api_errors_total",
+		"Alist API 请求失败次数",
+		"api",
+	)
+	FinalURLHops = NewHistogramVec(
+		"mediawarp_final_url_hops",
+		"获取 HTTPStrm 最终 URL 时经过的重定向次数",
+		[]float64{0, 1, 2, 3, 5, 10},
+		"result",
+	)
+	AlistFailovers = NewCounterVec(
+		"mediawarp_alist_failovers_total",
+		"Alist 请求切换到其他节点的次数",
+		"group",
+	)
+	RateLimitRequests = NewCounterVec(
+		"mediawarp_rate_limit_requests_total",
+		"限流器处理的请求数",
+		"class", "result",
+	)
+	StrmSyncRuns = NewCounterVec(
+		"mediawarp_strm_sync_runs_total",
+		"Strm 同步任务运行次数",
+		"task", "result",
+	)
+	StrmSyncFiles = NewCounterVec(
+		"mediawarp_strm_sync_files_total",
+		"Strm 同步任务生成、复制和删除的文件数",
+		"task", "action",
+	)
+	UpstreamProxyErrors = NewCounterVec(
+		"mediawarp_upstream_proxy_errors_total",
+		"转发请求至上游媒体服务器失败次数",
+		"handler",
+	)
+)
+
+// 缓存池统计信息
+type CacheStats struct {
+	Hits    int64 // 命中次数
+	Misses  int64 // 未命中次数
+	Entries int64 // 条目数量
+	Bytes   int64 // 占用空间（字节）
+}
+
+// 缓存池
+type cachePool struct {
+	key   any // 用于取消注册
+	stats func() CacheStats
+}
+
+var (
+	cachePoolsMutex sync.Mutex
+	cachePools      = make(map[string][]cachePool) // 缓存池名称 -> 缓存池（同名缓存池的指标会合并）
+)
+
+// 注册缓存池
+//
+// 用于导出缓存命中、未命中次数以及缓存大小，key 用于取消注册，stats 在每次采集时调用
+func RegisterCacheStats(name string, key any, stats func() CacheStats) {
+	cachePoolsMutex.Lock()
+	defer cachePoolsMutex.Unlock()
+	cachePools[name] = append(cachePools[name], cachePool{key: key, stats: stats})
+}
+
+// 取消注册缓存池
+func UnregisterCache(name string, key any) {
+	cachePoolsMutex.Lock()
+	defer cachePoolsMutex.Unlock()
+	pools := cachePools[name]
+	for i, pool := range pools {
+		if pool.key == key {
+			cachePools[name] = append(pools[:i:i], pools[i+1:]...)
+			break
+		}
+	}
+	if len(cachePools[name]) == 0 {
+		delete(cachePools, name)
+	}
+}
+
+// 汇总所有缓存池的统计信息
+func CollectCaches() map[string]CacheStats {
+	cachePoolsMutex.Lock()
+	defer cachePoolsMutex.Unlock()
+	result := make(map[string]CacheStats, len(cachePools))
+	for name, pools := range cachePools {
+		var total CacheStats
+		for _, pool := range pools {
+			stats := pool.stats()
+			total.Hits += stats.Hits
+			total.Misses += stats.Misses
+			total.Entries += stats.Entries
+			total.Bytes += stats.Bytes
+		}
+		result[name] = total
+	}
+	return result
+}
+
+// 汇总所有缓存池的指标
+func collectCaches(value func(stats CacheStats) int64) func() map[string]float64 {
+	return func() map[string]float64 {
+		caches := CollectCaches()
+		result := make(map[string]float64, len(caches))
+		for name, stats := range caches {
+			result[name] = float64(value(stats))
+		}
+		return result
+	}
+}
+
+func init() {
+	NewCounterFunc(
+		"mediawarp_cache_hits_total", "缓存命中次数", "pool",
+		collectCaches(func(stats CacheStats) int64 { return stats.Hits }),
+	)
+	NewCounterFunc(
+		"mediawarp_cache_misses_total", "缓存未命中次数", "pool",
+		collectCaches(func(stats CacheStats) int64 { return stats.Misses }),
+	)
+	NewGaugeFunc(
+		"mediawarp_cache_entries", "缓存条目数量", "pool",
+		collectCaches(func(stats CacheStats) int64 { return stats.Entries }),
+	)
+	NewGaugeFunc(
+		"mediawarp_cache_capacity_bytes", "缓存占用的空间大小", "pool",
+		collectCaches(func(stats CacheStats) int64 { return stats.Bytes }),
+	)
+}
@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 指标收集器
+type collector interface {
+	write(w io.Writer) // 以 Prometheus 文本格式输出指标
+}
+
+var (
+	collectorsMutex sync.Mutex
+	collectors      []collector
+)
+
+// 注册指标收集器
+func register(c collector) {
+	collectorsMutex.Lock()
+	defer collectorsMutex.Unlock()
+	collectors = append(collectors, c)
+}
+
+// 将所有指标以 Prometheus 文本格式写入 w
+func WriteTo(w io.Writer) error {
+	collectorsMutex.Lock()
+	list := append([]collector(nil), collectors...)
+	collectorsMutex.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range list {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// 指标 HTTP 处理器
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	}
+}
+
+// 指标描述
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+// 输出 HELP 和 TYPE 注释
+func (d *desc) writeHeader(w io.Writer, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, metricType)
+}
+
+// 一组标签值对应的时间序列
+type series[T any] struct {
+	labelValues []string
+	value       T
+}
+
+// 带标签的时间序列集合
+type seriesMap[T any] struct {
+	mutex  sync.Mutex
+	series map[string]*series[T]
+}
+
+// 获取标签值对应的时间序列，不存在时创建，调用方需要持有锁
+func (m *seriesMap[T]) get(d *desc, labelValues []string, init func() T) *series[T] {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("指标 %s 需要 %d 个标签值，实际为 %d 个", d.name, len(d.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	if m.series == nil {
+		m.series = make(map[string]*series[T])
+	}
+	s, ok := m.series[key]
+	if !ok {
+		s = &series[T]{labelValues: append([]string(nil), labelValues...), value: init()}
+		m.series[key] = s
+	}
+	return s
+}
+
+// 按标签值排序后的时间序列，调用方需要持有锁
+func (m *seriesMap[T]) sorted() []*series[T] {
+	list := make([]*series[T], 0, len(m.series))
+	for _, s := range m.series {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return strings.Join(list[i].labelValues, "\xff") < strings.Join(list[j].labelValues, "\xff")
+	})
+	return list
+}
+
+// 格式化标签
+//
+// extra 为额外的标签键值对（如直方图的 le）
+func formatLabels(names []string, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name + `="` + escapeLabelValue(values[i]) + `"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if sb.Len() > 1 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(extra[i] + `="` + escapeLabelValue(extra[i+1]) + `"`)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+var (
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+// 格式化数值
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
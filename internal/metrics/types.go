@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// 默认直方图桶（秒）
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// 计数器
+type CounterVec struct {
+	desc
+	values seriesMap[float64]
+}
+
+// 创建并注册计数器
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name: name, help: help, labels: labels}}
+	register(c)
+	return c
+}
+
+// 计数器加一
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// 计数器增加 v
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	c.values.mutex.Lock()
+	defer c.values.mutex.Unlock()
+	c.values.get(&c.desc, labelValues, func() float64 { return 0 }).value += v
+}
+
+// 清空计数器的所有时间序列
+func (c *CounterVec) Reset() {
+	c.values.mutex.Lock()
+	defer c.values.mutex.Unlock()
+	clear(c.values.series)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.writeHeader(w, "counter")
+	c.values.mutex.Lock()
+	defer c.values.mutex.Unlock()
+	for _, s := range c.values.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, s.labelValues), formatFloat(s.value))
+	}
+}
+
+// 直方图
+type HistogramVec struct {
+	desc
+	buckets []float64
+	values  seriesMap[*histogram]
+}
+
+type histogram struct {
+	counts []uint64 // 每个桶的计数（非累计）
+	count  uint64
+	sum    float64
+}
+
+// 创建并注册直方图
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{desc: desc{name: name, help: help, labels: labels}, buckets: buckets}
+	register(h)
+	return h
+}
+
+// 记录观测值
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.values.mutex.Lock()
+	defer h.values.mutex.Unlock()
+	s := h.values.get(&h.desc, labelValues, func() *histogram {
+		return &histogram{counts: make([]uint64, len(h.buckets))}
+	})
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.value.counts[i]++
+	}
+	s.value.count++
+	s.value.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.writeHeader(w, "histogram")
+	h.values.mutex.Lock()
+	defer h.values.mutex.Unlock()
+	for _, s := range h.values.sorted() {
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.value.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labelValues, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labelValues, "le", formatFloat(math.Inf(1))), s.value.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labelValues), formatFloat(s.value.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labelValues), s.value.count)
+	}
+}
+
+// 采集时计算的指标
+type funcMetric struct {
+	desc
+	metricType string
+	collect    func() map[string]float64 // 标签值 -> 数值
+}
+
+// 创建并注册仪表盘指标
+//
+// collect 在每次采集时调用，返回的键为唯一标签 label 的值
+func NewGaugeFunc(name string, help string, label string, collect func() map[string]float64) {
+	register(&funcMetric{desc: desc{name: name, help: help, labels: []string{label}}, metricType: "gauge", collect: collect})
+}
+
+// 创建并注册计数器指标
+//
+// 用于数值由其他组件维护的计数器（如缓存命中次数），collect 在每次采集时调用
+func NewCounterFunc(name string, help string, label string, collect func() map[string]float64) {
+	register(&funcMetric{desc: desc{name: name, help: help, labels: []string{label}}, metricType: "counter", collect: collect})
+}
+
+func (m *funcMetric) write(w io.Writer) {
+	m.writeHeader(w, m.metricType)
+	values := m.collect()
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", m.name, formatLabels(m.labels, []string{key}), formatFloat(values[key]))
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"MediaWarp/internal/config"
+	"MediaWarp/internal/logging"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 管理 API 认证
+//
+// 通过请求头 Authorization: Bearer <key> 或 X-API-Key: <key> 传递访问密钥
+func AdminAuth() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		expected := config.Get().API.Key
+		if expected == "" || !checkKey(ctx, expected) {
+			logging.Warningf("管理 API 认证失败，客户端 IP：%s，请求：%s", ctx.ClientIP(), ctx.Request.URL.Path)
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// Prometheus 指标认证
+//
+// 与管理 API 使用相同的方式传递访问密钥，key 为空时不需要认证
+func MetricsAuth(key string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if key != "" && !checkKey(ctx, key) {
+			logging.Warningf("Prometheus 指标认证失败，客户端 IP：%s", ctx.ClientIP())
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// 检查请求中的访问密钥
+func checkKey(ctx *gin.Context, expected string) bool {
+	key := ctx.GetHeader("X-API-Key")
+	if authorization := ctx.GetHeader("Authorization"); key == "" && len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		key = authorization[7:]
+	}
+	return subtle.ConstantTimeCompare([]byte(key), []byte(expected)) == 1
+}
@@ -1,35 +1,76 @@
 package middleware
 
 import (
+	"MediaWarp/internal/cache"
+	"MediaWarp/internal/config"
 	"MediaWarp/internal/logging"
+	"MediaWarp/utils"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"net/url"
 	"sort"
+	"time"
 
-	"github.com/allegro/bigcache/v3"
 	"github.com/gin-gonic/gin"
 )
 
 type CacheData struct {
-	StatusCode int         // code 响应码
-	Header     http.Header // header 响应头信息
-	Body       []byte      // body 响应体
+	StatusCode   int         // code 响应码
+	Header       http.Header // header 响应头信息
+	Body         []byte      // body 响应体
+	ETag         string      // 上游返回的 ETag，用于重新验证
+	LastModified string      // 上游返回的 Last-Modified，用于重新验证
+	Expires      time.Time   // 新鲜期截止时间，零值表示在缓存有效期内始终新鲜
 }
 
 func (c *CacheData) Json() ([]byte, error) {
 	return json.Marshal(c)
 }
 
+// 缓存是否仍在新鲜期内
+func (c *CacheData) Fresh(now time.Time) bool {
+	return c.Expires.IsZero() || now.Before(c.Expires)
+}
+
+// 是否可以向上游发送条件请求重新验证
+func (c *CacheData) Revalidatable() bool {
+	return c.ETag != "" || c.LastModified != ""
+}
+
+// 根据上游响应头更新新鲜期
+func (c *CacheData) UpdateExpires(header http.Header, now time.Time) {
+	if lifetime, ok := utils.GetFreshnessLifetime(header, now); ok {
+		c.Expires = now.Add(lifetime)
+	} else {
+		c.Expires = time.Time{}
+	}
+}
+
+// 写入缓存的响应
+//
+// 响应码为 200 时根据请求头处理条件请求（304）和范围请求（206），
+// 上游未返回 ETag 时使用响应体的 SHA-256 作为 ETag
 func (c *CacheData) WriteResponse(ctx *gin.Context) {
-	ctx.Status(c.StatusCode)            // 设置响应码
 	for key, values := range c.Header { // 设置响应头
 		for _, value := range values {
 			ctx.Writer.Header().Add(key, value)
 		}
 	}
-	ctx.Writer.Write(c.Body) // 设置响应体
+	if c.StatusCode != http.StatusOK {
+		ctx.Status(c.StatusCode) // 设置响应码
+		ctx.Writer.Write(c.Body) // 设置响应体
+		return
+	}
+
+	if ctx.Writer.Header().Get("ETag") == "" {
+		sum := sha256.Sum256(c.Body)
+		ctx.Writer.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	}
+	modtime, _ := http.ParseTime(c.Header.Get("Last-Modified"))
+	http.ServeContent(ctx.Writer, ctx.Request, "", modtime, bytes.NewReader(c.Body))
 }
 
 func ParseCacheData(data []byte) (*CacheData, error) {
@@ -40,22 +81,108 @@ func ParseCacheData(data []byte) (*CacheData, error) {
 	return &cacheData, nil
 }
 
-// 自定义的请求响应器
+// 缓存响应时不保存的响应头
+var cacheIgnoreHeaders = []string{
+	"Content-Length",
+	"Content-Range",
+	"Accept-Ranges",
+	"Date",
+	"Set-Cookie",
+}
+
+// 根据上游响应创建缓存数据
+func NewCacheData(code int, header http.Header, body []byte, now time.Time) *CacheData {
+	header = header.Clone()
+	for _, key := range cacheIgnoreHeaders {
+		header.Del(key)
+	}
+	cacheData := &CacheData{
+		StatusCode:   code,
+		Header:       header,
+		Body:         body,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+	}
+	cacheData.UpdateExpires(header, now)
+	return cacheData
+}
+
+// 条件请求和范围请求相关的请求头
 //
-// 用于记录缓存数据
-type WriterWarp struct {
+// 请求上游时删除这些请求头，以便获取完整的响应并写入缓存
+var conditionalHeaders = []string{
+	"If-None-Match",
+	"If-Modified-Since",
+	"If-Match",
+	"If-Unmodified-Since",
+	"If-Range",
+	"Range",
+}
+
+// 缓存中间件使用的响应器
+//
+// 上游的响应不会直接写入客户端，由缓存中间件决定如何响应
+type cacheWriter struct {
 	gin.ResponseWriter
-	Body bytes.Buffer
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+var _ gin.ResponseWriter = (*cacheWriter)(nil)
+
+func (w *cacheWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *cacheWriter) WriteHeaderNow() {
+	w.WriteHeader(http.StatusOK)
 }
 
-var _ gin.ResponseWriter = (*WriterWarp)(nil)
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(data)
+}
+
+func (w *cacheWriter) WriteString(s string) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.WriteString(s)
+}
+
+func (w *cacheWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *cacheWriter) Size() int {
+	if w.status == 0 {
+		return -1
+	}
+	return w.body.Len()
+}
 
-func (w *WriterWarp) Write(data []byte) (int, error) {
-	w.Body.Write(data)
-	return w.ResponseWriter.Write(data)
+func (w *cacheWriter) Written() bool {
+	return w.status != 0
 }
 
-var _ gin.ResponseWriter = (*WriterWarp)(nil)
+func (w *cacheWriter) Flush() {}
+
+// 将上游的响应原样写入客户端
+func (w *cacheWriter) writeTo(writer gin.ResponseWriter) {
+	for key, values := range w.header {
+		writer.Header()[key] = values
+	}
+	writer.WriteHeader(w.Status())
+	writer.Write(w.body.Bytes())
+}
 
 // 计算Key时忽略的查询参数
 var CacheKeyIgnoreQuery = []string{
@@ -138,47 +265,115 @@ func getCacheKey(ctx *gin.Context) string {
 	return path + query.Encode() // + headerStr
 }
 
-func getCacheBaseFunc(cachePool *bigcache.BigCache, cacheName string, reg string) gin.HandlerFunc {
+// 根据缓存设置获取缓存后端
+func getCacheBackend(cacheSetting *config.CacheSetting, name string, ttl time.Duration) (cache.Backend, error) {
+	return cache.GetBackend(name, cache.BackendOptions{
+		Type:    cacheSetting.Backend,
+		TTL:     ttl,
+		Dir:     cacheSetting.DiskDir(),
+		MaxSize: cacheSetting.DiskMaxSize(),
+	})
+}
+
+// 缓存中间件
+//
+// 新鲜的缓存直接响应；过期的缓存向上游发送条件请求重新验证，上游返回 304 时继续使用缓存，
+// 上游出错时使用过期的缓存响应；客户端的条件请求和范围请求均由缓存处理。
+// 相同缓存键的并发请求只会请求一次上游，其余请求等待并使用写入的缓存响应
+func getCacheBaseFunc(cachePool cache.Backend, cacheName string, reg string) gin.HandlerFunc {
+	var flight utils.SingleFlight[*CacheData]
 	return func(ctx *gin.Context) {
 		cacheKey := getCacheKey(ctx)
 		logging.AccessDebugf(ctx, "命中 %s 缓存正则表达式: %s, CacheKey: %s", cacheName, reg, cacheKey)
+		var cacheData *CacheData
 		if cacheByte, err := cachePool.Get(cacheKey); err == nil {
-			if cacheData, err := ParseCacheData(cacheByte); err == nil {
-				logging.AccessDebugf(ctx, "命中 %s 缓存: %s", cacheName, cacheKey)
-				cacheData.WriteResponse(ctx)
-				ctx.Abort()
-				return
-			} else {
+			if cacheData, err = ParseCacheData(cacheByte); err != nil {
 				logging.AccessWarningf(ctx, "解析 %s 缓存失败: %v", cacheName, err)
 			}
 		}
+		if cacheData != nil && cacheData.Fresh(time.Now()) {
+			logging.AccessDebugf(ctx, "命中 %s 缓存: %s", cacheName, cacheKey)
+			cacheData.WriteResponse(ctx)
+			ctx.Abort()
+			return
+		}
+
+		var leader bool
+		result, _ := flight.Do(cacheKey, func() (*CacheData, error) {
+			leader = true
+			return fetchCache(ctx, cachePool, cacheName, cacheKey, cacheData), nil
+		})
+		if leader {
+			return
+		}
+		if result != nil {
+			logging.AccessDebugf(ctx, "使用合并请求的 %s 缓存: %s", cacheName, cacheKey)
+			result.WriteResponse(ctx)
+			ctx.Abort()
+			return
+		}
+		fetchCache(ctx, cachePool, cacheName, cacheKey, cacheData) // 上游响应不能缓存，单独请求
+	}
+}
 
-		writer := &WriterWarp{
-			ResponseWriter: ctx.Writer,
-			Body:           bytes.Buffer{},
+// 请求上游并更新缓存
+//
+// 返回用于响应的缓存数据（新写入的缓存或上游出错时使用的过期缓存），上游响应不能缓存时返回 nil
+func fetchCache(ctx *gin.Context, cachePool cache.Backend, cacheName string, cacheKey string, cacheData *CacheData) *CacheData {
+	now := time.Now()
+	clientHeader := ctx.Request.Header.Clone()
+	for _, key := range conditionalHeaders {
+		ctx.Request.Header.Del(key)
+	}
+	if cacheData != nil && cacheData.Revalidatable() { // 缓存已过期，向上游发送条件请求
+		logging.AccessDebugf(ctx, "%s 缓存已过期，重新验证: %s", cacheName, cacheKey)
+		if cacheData.ETag != "" {
+			ctx.Request.Header.Set("If-None-Match", cacheData.ETag)
 		}
-		ctx.Writer = writer
+		if cacheData.LastModified != "" {
+			ctx.Request.Header.Set("If-Modified-Since", cacheData.LastModified)
+		}
+	}
 
-		ctx.Next() // 处理请求
+	originWriter := ctx.Writer
+	writer := &cacheWriter{ResponseWriter: originWriter, header: make(http.Header)}
+	ctx.Writer = writer
+	ctx.Next() // 处理请求
+	ctx.Writer = originWriter
+	ctx.Request.Header = clientHeader
 
-		code := ctx.Writer.Status()
-		if code >= http.StatusOK && code < http.StatusMultipleChoices { // 响应是2xx的成功响应，更新缓存记录
-			cacheData := &CacheData{ // 创建缓存数据
-				StatusCode: code, //ctx.Request.Response.StatusCode,
-				Header:     ctx.Writer.Header().Clone(),
-				Body:       writer.Body.Bytes(),
+	code := writer.Status()
+	switch {
+	case !writer.Written():
+		logging.AccessDebugf(ctx, "上游未响应, 不进行 %s 缓存", cacheName)
+		return nil
+	case code == http.StatusNotModified && cacheData != nil: // 缓存仍然有效，更新新鲜期
+		for key, values := range writer.header {
+			if key != "Content-Length" && key != "Date" {
+				cacheData.Header[key] = values
 			}
+		}
+		cacheData.UpdateExpires(writer.header, now)
+		logging.AccessDebugf(ctx, "%s 缓存重新验证成功", cacheName)
+	case code == http.StatusOK: // 更新缓存记录
+		cacheData = NewCacheData(code, writer.header, writer.body.Bytes(), now)
+	case code >= http.StatusInternalServerError && cacheData != nil:
+		logging.AccessWarningf(ctx, "上游响应码为: %d, 使用过期的 %s 缓存", code, cacheName)
+		cacheData.WriteResponse(ctx)
+		return cacheData
+	default:
+		logging.AccessDebugf(ctx, "响应码为: %d, 不进行 %s 缓存", code, cacheName)
+		writer.writeTo(originWriter)
+		return nil
+	}
 
-			if cacheByte, err := cacheData.Json(); err == nil {
-				err = cachePool.Set(cacheKey, cacheByte)
-				if err != nil {
-					logging.AccessWarningf(ctx, "写入 %s 缓存失败: %v", cacheName, err)
-				} else {
-					logging.AccessDebugf(ctx, "写入 %s 缓存成功", cacheName)
-				}
-			}
+	if cacheByte, err := cacheData.Json(); err == nil {
+		if err = cachePool.Set(cacheKey, cacheByte); err != nil {
+			logging.AccessWarningf(ctx, "写入 %s 缓存失败: %v", cacheName, err)
 		} else {
-			logging.AccessDebugf(ctx, "响应码为: %d, 不进行 %s 缓存", code, cacheName)
+			logging.AccessDebugf(ctx, "写入 %s 缓存成功", cacheName)
 		}
 	}
+	cacheData.WriteResponse(ctx)
+	return cacheData
 }
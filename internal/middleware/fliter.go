@@ -4,46 +4,153 @@ import (
 	"MediaWarp/constants"
 	"MediaWarp/internal/config"
 	"MediaWarp/internal/logging"
+	"MediaWarp/utils"
+	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// 客户端访问控制规则
+type clientFilterRule struct {
+	name       string
+	action     constants.FilterAction
+	source     *utils.CIDRMatcher
+	clientIP   *utils.CIDRMatcher
+	ua         *regexp.Regexp
+	client     *regexp.Regexp
+	deviceName *regexp.Regexp
+	path       *regexp.Regexp
+}
+
+func newClientFilterRule(index int, setting config.ClientFilterRule) (*clientFilterRule, error) {
+	rule := clientFilterRule{
+		name:   setting.Name,
+		action: setting.Action,
+	}
+	if rule.name == "" {
+		rule.name = fmt.Sprintf("第 %d 条规则", index+1)
+	}
+
+	var err error
+	if rule.source, err = utils.NewCIDRMatcher(setting.SourceList); err != nil {
+		return nil, fmt.Errorf("客户端过滤规则 %s 来源 IP %w", rule.name, err)
+	}
+	if rule.clientIP, err = utils.NewCIDRMatcher(setting.ClientIPList); err != nil {
+		return nil, fmt.Errorf("客户端过滤规则 %s 客户端 IP %w", rule.name, err)
+	}
+	for _, field := range []struct {
+		target **regexp.Regexp
+		expr   string
+	}{
+		{&rule.ua, setting.UA},
+		{&rule.client, setting.Client},
+		{&rule.deviceName, setting.DeviceName},
+		{&rule.path, setting.Path},
+	} {
+		if field.expr == "" {
+			continue
+		}
+		if *field.target, err = regexp.Compile(field.expr); err != nil {
+			return nil, fmt.Errorf("客户端过滤规则 %s 正则表达式 %s 错误: %w", rule.name, field.expr, err)
+		}
+	}
+	return &rule, nil
+}
+
+// 判断请求是否满足规则的所有条件
+func (rule *clientFilterRule) match(ctx *gin.Context, client string, deviceName string) bool {
+	if !rule.source.Match(ctx.RemoteIP()) || !rule.clientIP.Match(ctx.ClientIP()) {
+		return false
+	}
+	if rule.ua != nil && !rule.ua.MatchString(ctx.Request.UserAgent()) {
+		return false
+	}
+	if rule.client != nil && !rule.client.MatchString(client) {
+		return false
+	}
+	if rule.deviceName != nil && !rule.deviceName.MatchString(deviceName) {
+		return false
+	}
+	if rule.path != nil && !rule.path.MatchString(ctx.Request.URL.Path) {
+		return false
+	}
+	return true
+}
+
+// 使用 User-Agent 黑白名单判断是否放行
+func allowedByUserAgent(filterSetting *config.ClientFilterSetting, userAgent string) bool {
+	if userAgent == "" { // 开启了客户端过滤器后禁止所有未提供User-Agent的链接
+		return false
+	}
+	switch filterSetting.Mode {
+	case constants.WHITELIST: // 白名单模式
+		for _, ua := range filterSetting.ClientList {
+			if strings.Contains(userAgent, ua) {
+				return true
+			}
+		}
+		return false
+	case constants.BLACKLIST: // 黑名单模式
+		for _, ua := range filterSetting.ClientList {
+			if strings.Contains(userAgent, ua) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 // 客户端过滤器
-func ClientFilter() gin.HandlerFunc {
+//
+// 按顺序匹配访问控制规则，第一条匹配的规则决定放行或拦截；
+// 未匹配任何规则时使用 User-Agent 黑白名单判断；试运行模式下只记录日志，不拦截请求
+func ClientFilter(filterSetting config.ClientFilterSetting) (gin.HandlerFunc, error) {
+	rules := make([]*clientFilterRule, 0, len(filterSetting.Rules))
+	for index, ruleSetting := range filterSetting.Rules {
+		rule, err := newClientFilterRule(index, ruleSetting)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
 	return func(ctx *gin.Context) {
-		userAgent := ctx.Request.UserAgent()
-		var allowed bool
-		if userAgent == "" { // 开启了客户端过滤器后禁止所有未提供User-Agent的链接
-			allowed = false
-		} else {
-			switch config.ClientFilter.Mode {
-			case constants.WHITELIST: // 白名单模式
-				allowed = false
-				for _, ua := range config.ClientFilter.ClientList {
-					if strings.Contains(userAgent, ua) {
-						allowed = true
-						break
-					}
-				}
-			case constants.BLACKLIST: // 黑名单模式
-				allowed = true
-				for _, ua := range config.ClientFilter.ClientList {
-					if strings.Contains(userAgent, ua) {
-						allowed = false
-						break
-					}
-				}
+		var (
+			userAgent          = ctx.Request.UserAgent()
+			client, deviceName = utils.GetClientInfo(ctx.Request)
+			allowed            bool
+			reason             string
+			matchedRule        *clientFilterRule
+		)
+		for _, rule := range rules {
+			if rule.match(ctx, client, deviceName) {
+				matchedRule = rule
+				break
 			}
 		}
+		if matchedRule != nil {
+			allowed = matchedRule.action == constants.FilterAllow
+			reason = "规则：" + matchedRule.name
+		} else {
+			allowed = allowedByUserAgent(&filterSetting, userAgent)
+			reason = fmt.Sprintf("User-Agent %s", filterSetting.Mode)
+		}
+
 		if !allowed {
+			if filterSetting.DryRun {
+				logging.Infof("客户端过滤器（试运行）将拦截请求 %s，%s，客户端 IP：%s，User-Agent：%s，客户端：%s，设备：%s", ctx.Request.URL.Path, reason, ctx.ClientIP(), userAgent, client, deviceName)
+				ctx.Next()
+				return
+			}
 			ctx.AbortWithStatus(http.StatusForbidden) // 禁止访问
-			logging.Info("客户端过滤器拦截了请求，User-Agent: ", userAgent)
+			logging.Infof("客户端过滤器拦截了请求 %s，%s，客户端 IP：%s，User-Agent：%s，客户端：%s，设备：%s", ctx.Request.URL.Path, reason, ctx.ClientIP(), userAgent, client, deviceName)
 			return
 		}
-		logging.Debug("客户端过滤器放行了请求，User-Agent: ", userAgent)
+		logging.Debugf("客户端过滤器放行了请求 %s，%s，User-Agent：%s", ctx.Request.URL.Path, reason, userAgent)
 		ctx.Next()
-
-	}
+	}, nil
 }
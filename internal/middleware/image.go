@@ -1,20 +1,17 @@
 package middleware
 
 import (
-	"context"
-	"fmt"
+	"MediaWarp/internal/config"
 	"net/http"
 	"regexp"
-	"time"
 
-	"github.com/allegro/bigcache/v3"
 	"github.com/gin-gonic/gin"
 )
 
-func ImageCache(ttl time.Duration, reg *regexp.Regexp) gin.HandlerFunc {
-	cachePool, err := bigcache.New(context.Background(), bigcache.DefaultConfig(ttl))
+func ImageCache(cacheSetting *config.CacheSetting, reg *regexp.Regexp) (gin.HandlerFunc, error) {
+	cachePool, err := getCacheBackend(cacheSetting, "image", cacheSetting.ImageTTL)
 	if err != nil {
-		panic(fmt.Sprintf("create image cache pool failed: %v", err))
+		return nil, err
 	}
 	cacheFunc := getCacheBaseFunc(cachePool, "图片", reg.String())
 
@@ -24,5 +21,5 @@ func ImageCache(ttl time.Duration, reg *regexp.Regexp) gin.HandlerFunc {
 			return
 		}
 		cacheFunc(ctx)
-	}
+	}, nil
 }
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"MediaWarp/constants"
+	"MediaWarp/internal/config"
+	"MediaWarp/internal/logging"
+	"MediaWarp/internal/metrics"
+	"MediaWarp/utils"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 限流器
+type rateLimiter struct {
+	rule    config.RateLimitRule
+	limiter *utils.RateLimiter
+}
+
+var (
+	rateLimitersMutex sync.Mutex
+	rateLimiters      = make(map[string]*rateLimiter) // 请求类型 -> 限流器
+)
+
+func init() {
+	metrics.NewGaugeFunc("mediawarp_rate_limit_keys", "正在限流的 key 数量", "class", func() map[string]float64 {
+		rateLimitersMutex.Lock()
+		defer rateLimitersMutex.Unlock()
+		result := make(map[string]float64, len(rateLimiters))
+		for class, l := range rateLimiters {
+			result[class] = float64(l.limiter.Len())
+		}
+		return result
+	})
+}
+
+// 获取限流器
+//
+// 规则未改变时复用原限流器（重新加载配置时保留限流状态）；规则未启用时返回 nil
+func getRateLimiter(class string, rule config.RateLimitRule) *utils.RateLimiter {
+	rateLimitersMutex.Lock()
+	defer rateLimitersMutex.Unlock()
+
+	if rule.Rate <= 0 {
+		delete(rateLimiters, class)
+		return nil
+	}
+	if l, ok := rateLimiters[class]; ok && l.rule == rule {
+		return l.limiter
+	}
+	l := &rateLimiter{rule: rule, limiter: utils.NewRateLimiter(rule.Rate, rule.Burst)}
+	rateLimiters[class] = l
+	logging.Infof("%s 请求限流已启用，每秒 %g 个请求，突发 %d 个，限流维度：%s", class, rule.Rate, rule.Burst, rule.Key)
+	return l.limiter
+}
+
+// 清除所有限流器和限流请求计数
+//
+// 重新加载配置后未启用请求限流时调用，不再导出已停用的限流器的指标
+func ResetRateLimit() {
+	rateLimitersMutex.Lock()
+	clear(rateLimiters)
+	rateLimitersMutex.Unlock()
+	metrics.RateLimitRequests.Reset()
+}
+
+// 请求限流中间件
+//
+// 将转发至媒体服务器的请求分为播放（playbackRegexps）、图片（imageRegexp）和其他 API 请求三类，
+// 分别按照用户、设备或客户端 IP 进行令牌桶限流，超出限制时响应 429；
+// resolveUser 根据访问令牌获取用户 ID（由媒体服务器校验），用于按用户限流
+func RateLimit(rateLimitSetting config.RateLimitSetting, resolveUser func(req *http.Request) string, playbackRegexps []*regexp.Regexp, imageRegexp *regexp.Regexp) gin.HandlerFunc {
+	var (
+		playbackLimiter = getRateLimiter("playback", rateLimitSetting.Playback)
+		imageLimiter    = getRateLimiter("image", rateLimitSetting.Image)
+		apiLimiter      = getRateLimiter("api", rateLimitSetting.API)
+	)
+
+	return func(ctx *gin.Context) {
+		var (
+			path    = ctx.Request.URL.Path
+			class   string
+			rule    config.RateLimitRule
+			limiter *utils.RateLimiter
+		)
+		switch {
+		case matchAny(playbackRegexps, path):
+			class, rule, limiter = "playback", rateLimitSetting.Playback, playbackLimiter
+		case imageRegexp != nil && imageRegexp.MatchString(path):
+			class, rule, limiter = "image", rateLimitSetting.Image, imageLimiter
+		case !isStaticPath(path):
+			class, rule, limiter = "api", rateLimitSetting.API, apiLimiter
+		}
+
+		if limiter != nil {
+			key := rateLimitKey(ctx, rule.Key, resolveUser)
+			if allowed, retryAfter := limiter.Allow(key); !allowed {
+				metrics.RateLimitRequests.Inc(class, "limited")
+				logging.AccessDebugf(ctx, "%s 请求被限流，限流 key：%s", class, key)
+				ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				ctx.AbortWithStatus(http.StatusTooManyRequests)
+				return
+			}
+			metrics.RateLimitRequests.Inc(class, "allowed")
+		}
+
+		ctx.Next()
+	}
+}
+
+// 计算限流 key
+//
+// 用户无法识别时使用 Token（媒体服务器未能确认 Token 对应的用户时）、设备 ID，设备 ID 无法识别时使用客户端 IP
+func rateLimitKey(ctx *gin.Context, keyType constants.RateLimitKey, resolveUser func(req *http.Request) string) string {
+	switch keyType {
+	case constants.RateLimitByUser:
+		if token := utils.GetClientToken(ctx.Request); token != "" {
+			if userID := resolveUser(ctx.Request); userID != "" {
+				return "user:" + userID
+			}
+			return "token:" + utils.MD5Hash(token)
+		}
+		fallthrough
+	case constants.RateLimitByDevice:
+		if deviceID := utils.GetClientDeviceID(ctx.Request); deviceID != "" {
+			return "device:" + deviceID
+		}
+		fallthrough
+	default:
+		return "ip:" + ctx.ClientIP()
+	}
+}
+
+// 是否匹配其中任意一个正则表达式
+func matchAny(regexps []*regexp.Regexp, s string) bool {
+	for _, reg := range regexps {
+		if reg.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否为 Web 静态资源
+func isStaticPath(path string) bool {
+	path = strings.ToLower(path)
+	return strings.HasPrefix(path, "/web/") || strings.HasPrefix(path, "/emby/web/")
+}
@@ -1,20 +1,17 @@
 package middleware
 
 import (
-	"context"
-	"fmt"
+	"MediaWarp/internal/config"
 	"net/http"
 	"regexp"
-	"time"
 
-	"github.com/allegro/bigcache/v3"
 	"github.com/gin-gonic/gin"
 )
 
-func SubtitleCache(ttl time.Duration, reg *regexp.Regexp) gin.HandlerFunc {
-	cachePool, err := bigcache.New(context.Background(), bigcache.DefaultConfig(ttl))
+func SubtitleCache(cacheSetting *config.CacheSetting, reg *regexp.Regexp) (gin.HandlerFunc, error) {
+	cachePool, err := getCacheBackend(cacheSetting, "subtitle", cacheSetting.SubtitleTTL)
 	if err != nil {
-		panic(fmt.Sprintf("create subtitle cache pool failed: %v", err))
+		return nil, err
 	}
 	cacheFunc := getCacheBaseFunc(cachePool, "字幕", reg.String())
 
@@ -24,5 +21,5 @@ func SubtitleCache(ttl time.Duration, reg *regexp.Regexp) gin.HandlerFunc {
 			return
 		}
 		cacheFunc(ctx)
-	}
+	}, nil
 }
@@ -0,0 +1,234 @@
+package router
+
+import (
+	"MediaWarp/constants"
+	"MediaWarp/internal/cache"
+	"MediaWarp/internal/config"
+	"MediaWarp/internal/handler"
+	"MediaWarp/internal/logging"
+	"MediaWarp/internal/middleware"
+	"MediaWarp/internal/session"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultCacheKeysLimit = 100  // 默认列出的缓存键数量
+	maxWarmItems          = 1000 // 单次预热的最大条目数量
+)
+
+var itemIDRegexp = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
+// 注册管理 API 路由
+func initAPIRouter(apiRouter *gin.RouterGroup, mediaServerHandler handler.MediaServerHandler) {
+	apiRouter.GET("/sessions", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, session.List())
+	})
+
+	apiRouter.GET("/cache", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, cache.List())
+	})
+	apiRouter.GET("/cache/:name", listCacheKeys)
+	apiRouter.DELETE("/cache/:name", purgeCache)
+	apiRouter.POST("/cache/image/warm", warmImageCache(mediaServerHandler))
+}
+
+// 根据查询参数 key、prefix、item_id 创建缓存键匹配函数
+//
+// 未指定任何参数时返回 nil（匹配所有缓存键），同时指定多个参数时返回错误
+func getCacheKeyMatcher(ctx *gin.Context) (func(key string) bool, error) {
+	var (
+		match func(key string) bool
+		count int
+	)
+	if key, ok := ctx.GetQuery("key"); ok {
+		match = func(k string) bool { return k == key }
+		count++
+	}
+	if prefix, ok := ctx.GetQuery("prefix"); ok {
+		match = func(k string) bool { return strings.HasPrefix(k, prefix) }
+		count++
+	}
+	if itemID, ok := ctx.GetQuery("item_id"); ok {
+		if itemID == "" {
+			return nil, errors.New("item_id is empty")
+		}
+		match = func(k string) bool { return cacheKeyHasItemID(k, itemID) }
+		count++
+	}
+	if count > 1 {
+		return nil, errors.New("only one of key, prefix and item_id can be specified")
+	}
+	return match, nil
+}
+
+// 缓存键的路径中是否包含指定的媒体项 ID
+//
+// 如 /emby/Items/123/Images/Primary、/Videos/123/mediasource_123/Subtitles/1/Stream.srt
+func cacheKeyHasItemID(key string, itemID string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		segment = strings.TrimPrefix(strings.ToLower(segment), "mediasource_")
+		if strings.EqualFold(segment, itemID) {
+			return true
+		}
+	}
+	return false
+}
+
+// 列出缓存池中的缓存键
+//
+// 支持 key、prefix、item_id 过滤，limit 限制返回数量（默认 100，0 表示不限制）
+func listCacheKeys(ctx *gin.Context) {
+	match, err := getCacheKeyMatcher(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := defaultCacheKeysLimit
+	if value, ok := ctx.GetQuery("limit"); ok {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+
+	keys, err := cache.Keys(ctx.Param("name"), match)
+	if errors.Is(err, cache.ErrPoolNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "cache pool not found"})
+		return
+	}
+	total := len(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	ctx.JSON(http.StatusOK, gin.H{"name": ctx.Param("name"), "total": total, "keys": keys})
+}
+
+// 清除缓存
+//
+// 未指定 key、prefix、item_id 时清空整个缓存池
+func purgeCache(ctx *gin.Context) {
+	match, err := getCacheKeyMatcher(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := ctx.Param("name")
+	count, err := cache.Purge(name, match)
+	switch {
+	case errors.Is(err, cache.ErrPoolNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "cache pool not found"})
+	case err != nil:
+		logging.Warningf("清除 %s 缓存失败: %v", name, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "purged": count})
+	default:
+		logging.Infof("已清除 %s 缓存 %d 个条目，客户端 IP：%s", name, count, ctx.ClientIP())
+		ctx.JSON(http.StatusOK, gin.H{"name": name, "purged": count})
+	}
+}
+
+// 图片缓存预热请求
+type warmRequest struct {
+	ItemIDs    []string `json:"item_ids"`
+	ImageTypes []string `json:"image_types"` // 图片类型，默认为 Primary
+	Query      string   `json:"query"`       // 附加的查询参数（如 maxHeight=300&quality=90），需要与客户端请求一致才能命中缓存
+}
+
+// 图片缓存预热结果
+type warmResult struct {
+	ItemID    string `json:"item_id"`
+	ImageType string `json:"image_type"`
+	Status    int    `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// 预热图片缓存
+//
+// 依次请求媒体项的图片并写入图片缓存，不经过客户端过滤和限流中间件
+func warmImageCache(mediaServerHandler handler.MediaServerHandler) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := config.Get()
+		if !cfg.Cache.Enable || cfg.Cache.ImageTTL <= 0 {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "image cache is disabled"})
+			return
+		}
+		var prefix string
+		switch cfg.MediaServer.Type {
+		case constants.EMBY:
+			prefix = "/emby"
+		case constants.JELLYFIN:
+			prefix = ""
+		default:
+			ctx.JSON(http.StatusNotImplemented, gin.H{"error": "image cache warming is not supported for " + cfg.MediaServer.Type.String()})
+			return
+		}
+
+		var request warmRequest
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(request.ItemIDs) == 0 || len(request.ItemIDs) > maxWarmItems {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "item_ids must contain 1 to " + strconv.Itoa(maxWarmItems) + " items"})
+			return
+		}
+		if len(request.ImageTypes) == 0 {
+			request.ImageTypes = []string{"Primary"}
+		}
+		if _, err := url.ParseQuery(request.Query); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid query: " + err.Error()})
+			return
+		}
+
+		cacheHandler, err := middleware.ImageCache(&cfg.Cache, mediaServerHandler.GetImageCacheRegexp())
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		engine := gin.New()
+		engine.NoRoute(cacheHandler, func(ctx *gin.Context) {
+			mediaServerHandler.ReverseProxy(ctx.Writer, ctx.Request)
+		})
+
+		results := make([]warmResult, 0, len(request.ItemIDs)*len(request.ImageTypes))
+		for _, itemID := range request.ItemIDs {
+			for _, imageType := range request.ImageTypes {
+				result := warmResult{ItemID: itemID, ImageType: imageType}
+				if !itemIDRegexp.MatchString(itemID) || !itemIDRegexp.MatchString(imageType) {
+					result.Error = "invalid item id or image type"
+					results = append(results, result)
+					continue
+				}
+				if err := ctx.Request.Context().Err(); err != nil {
+					return
+				}
+
+				target := prefix + "/Items/" + itemID + "/Images/" + imageType
+				if request.Query != "" {
+					target += "?" + request.Query
+				}
+				req, err := http.NewRequestWithContext(ctx.Request.Context(), http.MethodGet, target, nil)
+				if err != nil {
+					result.Error = err.Error()
+					results = append(results, result)
+					continue
+				}
+				req.RemoteAddr = ctx.Request.RemoteAddr
+				recorder := httptest.NewRecorder()
+				engine.ServeHTTP(recorder, req)
+				result.Status = recorder.Code
+				results = append(results, result)
+			}
+		}
+		logging.Infof("图片缓存预热完成，共 %d 个请求，客户端 IP：%s", len(results), ctx.ClientIP())
+		ctx.JSON(http.StatusOK, results)
+	}
+}
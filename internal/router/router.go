@@ -5,24 +5,52 @@ import (
 	"MediaWarp/internal/config"
 	"MediaWarp/internal/handler"
 	"MediaWarp/internal/logging"
+	"MediaWarp/internal/metrics"
 	"MediaWarp/internal/middleware"
 	"MediaWarp/static"
+	"context"
+	"fmt"
 	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func InitRouter() *gin.Engine {
+// 当前使用的路由引擎
+var (
+	currentEngine  atomic.Pointer[gin.Engine]
+	activeRequests atomic.Int64 // 正在处理的请求数量（包括代理中的媒体流和 WebSocket 会话）
+)
+
+// 初始化路由
+//
+// 使用 cfg 和 mediaServerHandler 创建路由引擎，重新加载配置时可以在替换配置前创建路由引擎
+func InitRouter(cfg *config.Setting, mediaServerHandler handler.MediaServerHandler) (*gin.Engine, error) {
 	ginR := gin.New()
+	if cfg.TrustedProxies != nil { // 未设置时使用 gin 的默认设置（信任所有代理）
+		if err := ginR.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+			return nil, fmt.Errorf("可信代理设置错误: %w", err)
+		}
+	}
 	ginR.Use(
 		middleware.Logger(),
 		middleware.Recovery(),
 		middleware.SetRefererPolicy(constants.SameOrigin),
 	)
 
-	if config.ClientFilter.Enable {
-		ginR.Use(middleware.ClientFilter())
-		logging.Info("客户端过滤中间件已启用")
+	if cfg.ClientFilter.Enable {
+		clientFilter, err := middleware.ClientFilter(cfg.ClientFilter)
+		if err != nil {
+			return nil, err
+		}
+		ginR.Use(clientFilter)
+		if cfg.ClientFilter.DryRun {
+			logging.Info("客户端过滤中间件已启用（试运行，只记录日志不拦截请求）")
+		} else {
+			logging.Info("客户端过滤中间件已启用")
+		}
 	} else {
 		logging.Info("客户端过滤中间件未启用")
 	}
@@ -32,57 +60,79 @@ func InitRouter() *gin.Engine {
 		mediawarpRouter.Any("/version", func(ctx *gin.Context) {
 			ctx.JSON(http.StatusOK, config.Version())
 		})
-		if config.Web.Enable { // 启用 Web 页面修改相关设置
+		if cfg.Web.Enable { // 启用 Web 页面修改相关设置
 			mediawarpRouter.StaticFS("/static", http.FS(static.EmbeddedStaticAssets))
-			if config.Web.Custom { // 用户自定义静态资源目录
+			if cfg.Web.Custom { // 用户自定义静态资源目录
 				mediawarpRouter.Static("/custom", config.CostomDir())
 			}
-			if config.Web.Robots != "" { // 自定义 robots.txt
+			if cfg.Web.Robots != "" { // 自定义 robots.txt
 				ginR.GET(
 					"/robots.txt",
 					func(ctx *gin.Context) {
-						ctx.String(http.StatusOK, config.Web.Robots)
+						ctx.String(http.StatusOK, cfg.Web.Robots)
 					},
 				)
 			}
 		}
+		if cfg.API.Enable { // 管理 API
+			initAPIRouter(mediawarpRouter.Group("/api", middleware.AdminAuth()), mediaServerHandler)
+			logging.Info("管理 API 已启用")
+		}
+		if cfg.Metrics.Enable { // Prometheus 指标
+			mediawarpRouter.GET("/metrics", middleware.MetricsAuth(cfg.Metrics.Key), gin.WrapF(metrics.Handler()))
+			logging.Info("Prometheus 指标已启用")
+		}
 	}
 
-	handlers := make(gin.HandlersChain, 0, 3)
-	if config.Cache.Enable {
-		mediaServerHandler := handler.GetMediaServer()
+	handlers := make(gin.HandlersChain, 0, 4)
+	if cfg.RateLimit.Enable {
+		logging.Info("请求限流中间件已启用")
+		handlers = append(handlers, middleware.RateLimit(cfg.RateLimit, mediaServerHandler.ResolveUser, mediaServerHandler.GetPlaybackRegexps(), mediaServerHandler.GetImageCacheRegexp()))
+	} else {
+		middleware.ResetRateLimit()
+		logging.Info("请求限流中间件未启用")
+	}
+
+	if cfg.Cache.Enable {
 		{
-			if config.Cache.ImageTTL > 0 {
-				logging.Infof("图片缓存中间件已启用, TTL: %s", config.Cache.ImageTTL.String())
-				handlers = append(handlers, middleware.ImageCache(config.Cache.ImageTTL, mediaServerHandler.GetImageCacheRegexp()))
+			if cfg.Cache.ImageTTL > 0 {
+				cacheHandler, err := middleware.ImageCache(&cfg.Cache, mediaServerHandler.GetImageCacheRegexp())
+				if err != nil {
+					return nil, err
+				}
+				logging.Infof("图片缓存中间件已启用, TTL: %s, 存储方式: %s", cfg.Cache.ImageTTL.String(), cfg.Cache.Backend)
+				handlers = append(handlers, cacheHandler)
 			} else {
-				logging.Infof("图片缓存中间件未启用, TTL: %s", config.Cache.ImageTTL.String())
+				logging.Infof("图片缓存中间件未启用, TTL: %s", cfg.Cache.ImageTTL.String())
 			}
 		}
 
 		{
-			if config.Cache.SubtitleTTL > 0 {
-				logging.Infof("字幕缓存中间件已启用, TTL: %s", config.Cache.SubtitleTTL.String())
-				handlers = append(handlers, middleware.SubtitleCache(config.Cache.SubtitleTTL, mediaServerHandler.GetSubtitleCacheRegexp()))
+			if cfg.Cache.SubtitleTTL > 0 {
+				cacheHandler, err := middleware.SubtitleCache(&cfg.Cache, mediaServerHandler.GetSubtitleCacheRegexp())
+				if err != nil {
+					return nil, err
+				}
+				logging.Infof("字幕缓存中间件已启用, TTL: %s, 存储方式: %s", cfg.Cache.SubtitleTTL.String(), cfg.Cache.Backend)
+				handlers = append(handlers, cacheHandler)
 			} else {
-				logging.Infof("字幕缓存中间件未启用, TTL: %s", config.Cache.SubtitleTTL.String())
+				logging.Infof("字幕缓存中间件未启用, TTL: %s", cfg.Cache.SubtitleTTL.String())
 			}
 		}
 	} else {
 		logging.Info("全局缓存未启用, 未添加缓存中间件")
 	}
 
-	handlers = append(handlers, getRegexpRouterHandler())
+	handlers = append(handlers, getRegexpRouterHandler(mediaServerHandler))
 	ginR.NoRoute(handlers...)
-	return ginR
+	return ginR, nil
 }
 
 // 正则表达式路由处理器
 //
 // 从媒体服务器处理结构体中获取正则路由规则
 // 依次匹配请求, 找到对应的处理器
-func getRegexpRouterHandler() gin.HandlerFunc {
-	mediaServerHandler := handler.GetMediaServer()
+func getRegexpRouterHandler(mediaServerHandler handler.MediaServerHandler) gin.HandlerFunc {
 	middlewareChain := NewMiddlewareChain().
 		Add(QueryKeyCaseInsensitive).
 		Add(DisableCompression)
@@ -92,12 +142,61 @@ func getRegexpRouterHandler() gin.HandlerFunc {
 			if rule.Regexp.MatchString(ctx.Request.URL.Path) { // 不带查询参数的字符串：/emby/Items/54/Images/Primary
 				logging.AccessDebugf(ctx, "匹配成功正则表达式: %s", rule.Regexp.String())
 
+				startTime := time.Now()
 				middlewareChain.Execute(rule.Handler)(ctx)
+				observeRoute(ctx, rule.Regexp.String(), startTime)
 				return
 			}
 		}
 
 		// 未匹配路由
+		startTime := time.Now()
 		mediaServerHandler.ReverseProxy(ctx.Writer, ctx.Request)
+		observeRoute(ctx, "default", startTime)
+	}
+}
+
+// 记录路由规则的请求数和处理耗时
+func observeRoute(ctx *gin.Context, rule string, startTime time.Time) {
+	metrics.RouteRequests.Inc(rule, strconv.Itoa(ctx.Writer.Status()))
+	metrics.RouteDuration.Observe(time.Since(startTime).Seconds(), rule)
+}
+
+// 替换路由引擎
+//
+// 重新加载配置时使用，正在处理的请求继续使用原路由引擎
+func SetEngine(engine *gin.Engine) {
+	currentEngine.Store(engine)
+}
+
+// HTTP 处理器
+//
+// 将请求交给当前的路由引擎处理
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		activeRequests.Add(1)
+		defer activeRequests.Add(-1)
+		currentEngine.Load().ServeHTTP(w, r)
+	})
+}
+
+// 正在处理的请求数量
+func ActiveRequests() int64 {
+	return activeRequests.Load()
+}
+
+// 等待所有请求处理完成
+//
+// http.Server.Shutdown 不会等待已被劫持的连接（WebSocket），因此需要单独等待
+func WaitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for ActiveRequests() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
 	}
+	return nil
 }
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"MediaWarp/internal/config"
+	"MediaWarp/internal/logging"
+	"MediaWarp/utils"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const proxyHeaderTimeout = 10 * time.Second // 读取 PROXY protocol 头部的超时时间
+
+// 监听地址对应的 HTTP 服务
+type listenServer struct {
+	setting  config.ListenSetting
+	listener net.Listener
+	server   *http.Server
+}
+
+// HTTP 服务器
+//
+// 每个监听地址对应一个 http.Server，共用同一个 Handler
+type Server struct {
+	servers []*listenServer
+}
+
+// 创建 HTTP 服务器并监听配置中的所有地址
+//
+// baseCtx 为所有请求的父 Context
+func New(handler http.Handler, baseCtx context.Context) (*Server, error) {
+	var s Server
+	for _, setting := range config.ListenList() {
+		ls, err := newListenServer(setting, handler, baseCtx)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.servers = append(s.servers, ls)
+	}
+	return &s, nil
+}
+
+func newListenServer(setting config.ListenSetting, handler http.Handler, baseCtx context.Context) (*listenServer, error) {
+	listener, err := listen(setting.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("监听 %s 失败: %w", setting.Addr, err)
+	}
+	if setting.ProxyProtocol {
+		listener = utils.NewProxyProtocolListener(listener, proxyHeaderTimeout)
+	}
+
+	server := &http.Server{
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+		Protocols:   new(http.Protocols),
+	}
+	server.Protocols.SetHTTP1(true)
+	if setting.TLS() {
+		reloader, err := newCertReloader(setting.CertFile, setting.KeyFile)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		server.Protocols.SetHTTP2(true)
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		}
+	} else if setting.H2C {
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return &listenServer{setting: setting, listener: listener, server: server}, nil
+}
+
+// 创建监听器
+//
+// unix: 开头的地址表示 unix socket，会删除残留的 socket 文件
+func listen(addr string) (net.Listener, error) {
+	if socketPath, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if info, err := os.Stat(socketPath); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(socketPath)
+		}
+		return net.Listen("unix", socketPath)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// 描述监听地址，用于日志
+func (ls *listenServer) String() string {
+	var features []string
+	if ls.setting.TLS() {
+		features = append(features, "TLS")
+	} else if ls.setting.H2C {
+		features = append(features, "h2c")
+	}
+	if ls.setting.ProxyProtocol {
+		features = append(features, "PROXY protocol")
+	}
+	if len(features) == 0 {
+		return ls.setting.Addr
+	}
+	return fmt.Sprintf("%s（%s）", ls.setting.Addr, strings.Join(features, "、"))
+}
+
+// 开始处理请求
+//
+// 任意一个监听地址出错时将错误发送到 errChan
+func (s *Server) Serve(errChan chan<- error) {
+	for _, ls := range s.servers {
+		logging.Info("MediaWarp 监听地址：", ls)
+		go func() {
+			var err error
+			if ls.setting.TLS() {
+				err = ls.server.ServeTLS(ls.listener, "", "")
+			} else {
+				err = ls.server.Serve(ls.listener)
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errChan <- fmt.Errorf("%s: %w", ls.setting.Addr, err)
+			}
+		}()
+	}
+}
+
+// 停止接收新连接并等待空闲
+func (s *Server) Shutdown(ctx context.Context) error {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(s.servers))
+	)
+	for index, ls := range s.servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[index] = ls.server.Shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// 立即关闭所有监听地址和连接
+func (s *Server) Close() error {
+	var errs []error
+	for _, ls := range s.servers {
+		if err := ls.server.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		ls.listener.Close() // 未开始 Serve 时 http.Server 不会关闭监听器
+	}
+	return errors.Join(errs...)
+}
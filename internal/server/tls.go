@@ -0,0 +1,84 @@
+package server
+
+import (
+	"MediaWarp/internal/logging"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const certCheckInterval = 10 * time.Second // 检查证书文件是否修改的间隔
+
+// 证书重新加载器
+//
+// 握手时检查证书文件的修改时间，文件修改后重新加载证书（如 acme.sh、certbot 续期证书后），
+// 加载失败时继续使用原证书
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mutex     sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	reloader := certReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return &reloader, nil
+}
+
+// 加载证书
+func (r *certReloader) load() error {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return fmt.Errorf("读取 TLS 证书失败: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("读取 TLS 私钥失败: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("加载 TLS 证书失败: %w", err)
+	}
+	r.cert, r.certMod, r.keyMod = &cert, certInfo.ModTime(), keyInfo.ModTime()
+	return nil
+}
+
+// 判断证书文件是否被修改
+func (r *certReloader) modified() bool {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false
+	}
+	return !certInfo.ModTime().Equal(r.certMod) || !keyInfo.ModTime().Equal(r.keyMod)
+}
+
+// 用于 tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if time.Since(r.checkedAt) >= certCheckInterval {
+		r.checkedAt = time.Now()
+		if r.modified() {
+			if err := r.load(); err != nil {
+				logging.Warningf("重新加载 TLS 证书 %s 失败，继续使用原证书：%s", r.certFile, err)
+			} else {
+				logging.Infof("已重新加载 TLS 证书：%s", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
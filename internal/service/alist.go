@@ -1,46 +1,145 @@
 package service
 
 import (
+	"MediaWarp/constants"
 	"MediaWarp/internal/config"
 	"MediaWarp/internal/logging"
 	"MediaWarp/internal/service/alist"
 	"MediaWarp/utils"
 	"fmt"
+	"strings"
 	"sync"
 )
 
 var (
-	alistClientMap sync.Map
+	alistGroupMap sync.Map // Alist 节点组名称（addr 对应的服务器入口） -> *alistGroupEntry
 )
 
-// 初始化 Alist 客户端
-func InitAlistClient() {
-	if config.AlistStrm.Enable {
-		for _, alist := range config.AlistStrm.List {
-			registerAlistClient(alist.ADDR, alist.Username, alist.Password, alist.Token)
+// 已注册的 Alist 节点组
+type alistGroupEntry struct {
+	group *alist.Group
+	key   string // 创建节点组时使用的配置，配置未改变时复用节点组
+}
+
+// 初始化 Alist 节点组
+//
+// 可以重复调用（重新加载配置时），配置未改变的节点组会被复用，配置中已删除的节点组会被移除
+func InitAlistClient(cfg *config.Setting) {
+	endpoints := make(map[string]struct{})
+	if cfg.AlistStrm.Enable {
+		for _, alistSetting := range cfg.AlistStrm.List {
+			endpoint := utils.GetEndpoint(alistSetting.ADDR)
+			endpoints[endpoint] = struct{}{}
+
+			nodes := getAlistNodes(&alistSetting)
+			passwords := make([]alist.FolderPassword, 0, len(alistSetting.FolderPasswordList))
+			for _, folderPassword := range alistSetting.FolderPasswordList {
+				passwords = append(passwords, alist.FolderPassword{Path: folderPassword.Path, Password: folderPassword.Password})
+			}
+			key := alistGroupKey(cfg, alistSetting.Strategy, nodes, passwords)
+			if entry, ok := alistGroupMap.Load(endpoint); ok && entry.(*alistGroupEntry).key == key {
+				continue
+			}
+			registerAlistGroup(cfg, endpoint, alistSetting.Strategy, nodes, passwords, key)
+		}
+	}
+	alistGroupMap.Range(func(endpoint, _ any) bool {
+		if _, ok := endpoints[endpoint.(string)]; !ok {
+			if entry, loaded := alistGroupMap.LoadAndDelete(endpoint); loaded {
+				entry.(*alistGroupEntry).group.Close()
+			}
+			logging.Infof("已移除 Alist 节点组：%s", endpoint)
+		}
+		return true
+	})
+}
+
+// 获取节点组中所有节点的设置
+//
+// 第一个节点为 addr 对应的服务器，镜像节点未设置账户时使用节点组的账户
+func getAlistNodes(alistSetting *config.AlistSetting) []alist.NodeOptions {
+	nodes := make([]alist.NodeOptions, 0, len(alistSetting.Nodes)+1)
+	nodes = append(nodes, alist.NodeOptions{
+		ADDR:      alistSetting.ADDR,
+		Username:  alistSetting.Username,
+		Password:  alistSetting.Password,
+		OTPSecret: alistSetting.OTPSecret,
+		Token:     alistSetting.Token,
+		Weight:    alistSetting.Weight,
+	})
+	for _, node := range alistSetting.Nodes {
+		options := alist.NodeOptions{
+			ADDR:      node.ADDR,
+			Username:  node.Username,
+			Password:  node.Password,
+			OTPSecret: node.OTPSecret,
+			Token:     node.Token,
+			Weight:    node.Weight,
+		}
+		if node.Username == "" && node.Token == nil {
+			options.Username = alistSetting.Username
+			options.Password = alistSetting.Password
+			options.OTPSecret = alistSetting.OTPSecret
+			options.Token = alistSetting.Token
 		}
+		nodes = append(nodes, options)
 	}
+	return nodes
 }
 
-// 注册Alist客户端
+// 计算 Alist 节点组配置标识
+func alistGroupKey(cfg *config.Setting, strategy constants.AlistStrategy, nodes []alist.NodeOptions, passwords []alist.FolderPassword) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%s\x00%t\x00%s\x00%s\x00%s", strategy, cfg.Cache.Enable, cfg.Cache.AlistAPITTL, cfg.AlistStrm.HealthCheck.CheckInterval(), cfg.AlistStrm.HealthCheck.RequestTimeout())
+	for _, node := range nodes {
+		var token string
+		if node.Token != nil {
+			token = *node.Token
+		}
+		fmt.Fprintf(&builder, "\x00%s\x00%s\x00%s\x00%s\x00%s\x00%d", node.ADDR, node.Username, node.Password, node.OTPSecret, token, node.Weight)
+	}
+	for _, folderPassword := range passwords {
+		fmt.Fprintf(&builder, "\x00%s\x00%s", folderPassword.Path, folderPassword.Password)
+	}
+	return utils.MD5Hash(builder.String())
+}
+
+// 注册 Alist 节点组
 //
-// 将Alist客户端注册到全局Map中
-func registerAlistClient(addr string, username string, password string, token *string) {
-	alistClient, err := alist.NewAlistClient(addr, username, password, token)
+// 将 Alist 节点组注册到全局Map中
+func registerAlistGroup(cfg *config.Setting, endpoint string, strategy constants.AlistStrategy, nodes []alist.NodeOptions, passwords []alist.FolderPassword, key string) {
+	group, err := alist.NewGroup(cfg, strategy, nodes, passwords)
 	if err != nil {
-		logging.Warningf("注册 Alist 客户端 %s 失败：%s", addr, err)
+		logging.Warningf("注册 Alist 节点组 %s 失败：%s", endpoint, err)
 		return
 	}
-	alistClientMap.Store(alistClient.GetEndpoint(), alistClient)
+	if len(nodes) > 1 {
+		logging.Infof("已注册 Alist 节点组 %s，共 %d 个节点，策略：%s", endpoint, len(nodes), strategy)
+	}
+	if old, loaded := alistGroupMap.Swap(endpoint, &alistGroupEntry{group: group, key: key}); loaded {
+		old.(*alistGroupEntry).group.Close() // 配置已改变，关闭原节点组
+	}
+}
+
+// 关闭所有 Alist 节点组
+//
+// 退出时调用
+func CloseAlistClients() {
+	alistGroupMap.Range(func(endpoint, _ any) bool {
+		if entry, loaded := alistGroupMap.LoadAndDelete(endpoint); loaded {
+			entry.(*alistGroupEntry).group.Close()
+		}
+		return true
+	})
 }
 
-// 获取Alist客户端
+// 获取 Alist 节点组
 //
-// 从全局Map中获取Alist客户端
-func GetAlistClient(addr string) (*alist.AlistClient, error) {
+// 从全局Map中获取 addr 对应的 Alist 节点组
+func GetAlistGroup(addr string) (*alist.Group, error) {
 	endpoint := utils.GetEndpoint(addr)
-	if client, ok := alistClientMap.Load(endpoint); ok {
-		return client.(*alist.AlistClient), nil
+	if entry, ok := alistGroupMap.Load(endpoint); ok {
+		return entry.(*alistGroupEntry).group, nil
 	}
-	return nil, fmt.Errorf("%s 未注册到 Alist 客户端列表中", endpoint)
+	return nil, fmt.Errorf("%s 未注册到 Alist 节点组列表中", endpoint)
 }
@@ -1,13 +1,18 @@
 package alist
 
 import (
+	"MediaWarp/internal/cache"
 	"MediaWarp/internal/config"
+	"MediaWarp/internal/logging"
+	"MediaWarp/internal/metrics"
 	"MediaWarp/utils"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"path"
 	"strings"
 	"sync"
@@ -16,30 +21,45 @@ import (
 	"github.com/allegro/bigcache/v3"
 )
 
+const (
+	alistTokenDuration = 2*24*time.Hour - 5*time.Minute // Token 有效期为 2 天，提前 5 分钟刷新
+	alistListPageSize  = 200                            // 分页获取目录内容时每页的条目数量
+	alistAdminRole     = 2                              // 管理员账户的角色
+)
+
 type alistToken struct {
 	value    string       // 令牌 Token
 	expireAt time.Time    // 令牌过期时间
 	mutex    sync.RWMutex // 令牌锁
 }
+
+// 令牌是否有效，需要持有锁
+func (token *alistToken) valid() bool {
+	return token.value != "" && (token.expireAt.IsZero() || time.Now().Before(token.expireAt)) // 零值表示永不过期
+}
+
 type AlistClient struct {
-	endpoint string // 服务器入口 URL
-	username string // 用户名
-	password string // 密码
+	endpoint  string // 服务器入口 URL
+	username  string // 用户名
+	password  string // 密码
+	otpSecret string // 二步验证的 TOTP 密钥
 
 	userInfo UserInfoData
 
 	token  alistToken
 	client *http.Client
 	cache  *bigcache.BigCache
+	flight utils.SingleFlight[[]byte] // 合并相同缓存键的并发请求
 }
 
 // 获得AlistClient实例
-func NewAlistClient(addr string, username string, password string, token *string) (*AlistClient, error) {
+func NewAlistClient(cfg *config.Setting, addr string, username string, password string, otpSecret string, token *string) (*AlistClient, error) {
 	client := AlistClient{
-		endpoint: utils.GetEndpoint(addr),
-		username: username,
-		password: password,
-		client:   utils.GetHTTPClient(),
+		endpoint:  utils.GetEndpoint(addr),
+		username:  username,
+		password:  password,
+		otpSecret: otpSecret,
+		client:    &http.Client{Transport: utils.GetHTTPClient().Transport, Timeout: cfg.AlistStrm.HealthCheck.RequestTimeout()},
 	}
 	if token != nil {
 		client.token = alistToken{
@@ -48,10 +68,11 @@ func NewAlistClient(addr string, username string, password string, token *string
 		}
 	}
 
-	if config.Cache.Enable && config.Cache.AlistAPITTL > 0 {
-		cache, err := bigcache.New(context.Background(), bigcache.DefaultConfig(config.Cache.AlistAPITTL))
+	if cfg.Cache.Enable && cfg.Cache.AlistAPITTL > 0 {
+		apiCache, err := bigcache.New(context.Background(), bigcache.DefaultConfig(cfg.Cache.AlistAPITTL))
 		if err == nil {
-			client.cache = cache
+			client.cache = apiCache
+			cache.Register("alist_api", client.cache)
 		} else {
 			return nil, fmt.Errorf("创建 Alist API 缓存失败: %w", err)
 		}
@@ -62,10 +83,24 @@ func NewAlistClient(addr string, username string, password string, token *string
 		return nil, fmt.Errorf("获取用户当前信息失败：%w", err)
 	}
 	client.userInfo = *userInfo
+	if userInfo.Otp && otpSecret == "" {
+		logging.Warningf("Alist 账户 %s 已开启二步验证但未配置 otp_secret，令牌失效后将无法自动重新登录", client.GetEndpoint())
+	}
 
 	return &client, nil
 }
 
+// 关闭客户端
+//
+// 释放 API 缓存和空闲连接，重新加载配置后不再使用的客户端需要关闭
+func (client *AlistClient) Close() {
+	if client.cache != nil {
+		cache.Unregister("alist_api", client.cache)
+		client.cache.Close()
+	}
+	client.client.CloseIdleConnections()
+}
+
 // 得到服务器入口
 //
 // 避免直接访问 endpoint 字段
@@ -80,33 +115,69 @@ func (client *AlistClient) GetUsername() string {
 	return client.username
 }
 
+// 是否为管理员账户
+func (client *AlistClient) IsAdmin() bool {
+	return client.userInfo.Role == alistAdminRole
+}
+
+// 清除满足 match 的 API 缓存
+func (client *AlistClient) purgeCache(match func(key string) bool) {
+	if client.cache == nil {
+		return
+	}
+	var keys []string
+	iterator := client.cache.Iterator()
+	for iterator.SetNext() {
+		entry, err := iterator.Value()
+		if err == nil && match(entry.Key()) {
+			keys = append(keys, entry.Key())
+		}
+	}
+	for _, key := range keys {
+		client.cache.Delete(key)
+	}
+}
+
 // 得到一个可用的 Token
 //
-// 先从缓存池中读取，若过期或者未找到则重新生成
+// 先从缓存池中读取，若过期或者未找到则重新生成；
+// 重新登录时持有写锁，同时获取 Token 的请求会等待登录完成而不会重复登录
 func (client *AlistClient) getToken() (string, error) {
-	var tokenDuration = 2*24*time.Hour - 5*time.Minute // Token 有效期为 2 天，提前 5 分钟刷新
-
 	client.token.mutex.RLock()
-	if client.token.value != "" && (client.token.expireAt.IsZero() || time.Now().Before(client.token.expireAt)) {
-		// 零值表示永不过期
+	if client.token.valid() {
 		defer client.token.mutex.RUnlock()
 		return client.token.value, nil
 	}
+	client.token.mutex.RUnlock()
 
+	client.token.mutex.Lock()
+	defer client.token.mutex.Unlock()
+	if client.token.valid() { // 其他请求已经重新登录
+		return client.token.value, nil
+	}
 	loginData, err := client.authLogin() // 重新生成一个token
-	client.token.mutex.RUnlock()
 	if err != nil {
 		return "", err
 	}
+	client.token.value = loginData.Token
+	client.token.expireAt = time.Now().Add(alistTokenDuration)
+	return loginData.Token, nil
+}
 
+// 令牌失效时清除令牌，下次获取时重新登录
+//
+// 只清除与 token 相同的令牌，避免清除其他请求刚刚重新登录得到的令牌
+func (client *AlistClient) invalidateToken(token string) {
 	client.token.mutex.Lock()
 	defer client.token.mutex.Unlock()
-	client.token.value = loginData.Token
-	client.token.expireAt = time.Now().Add(tokenDuration) // Token 有效期为30分钟
-
-	return loginData.Token, nil
+	if client.token.value == token {
+		client.token.value = ""
+	}
 }
 
+// 发送请求并解析响应
+//
+// 可以缓存的请求先从缓存中读取，相同缓存键的并发请求只会请求一次 Alist
 func doRequest[T any](client *AlistClient, r Request) (*T, error) {
 	var resp AlistResponse[T]
 	cacheKey := r.GetCacheKey()
@@ -118,11 +189,68 @@ func doRequest[T any](client *AlistClient, r Request) (*T, error) {
 		}
 	}
 
+	var (
+		data []byte
+		err  error
+	)
+	if cacheKey != "" {
+		data, err = client.flight.Do(cacheKey, func() ([]byte, error) {
+			return client.fetch(r)
+		})
+	} else {
+		data, err = client.fetch(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("解析响应体失败: %w", err)
+	}
+	return &resp.Data, nil
+}
+
+// 请求 Alist 并返回响应体，响应成功且请求可以缓存时写入缓存
+//
+// 令牌失效（如在 Alist 中被注销、配置的令牌已过期）时重新登录并重试一次
+func (client *AlistClient) fetch(r Request) (_ []byte, err error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.AlistAPIDuration.Observe(time.Since(startTime).Seconds(), r.GetAPIPath())
+		if err != nil {
+			metrics.AlistAPIErrors.Inc(r.GetAPIPath())
+		}
+	}()
+
+	data, err := client.send(r)
+	if errors.Is(err, ErrUnauthorized) && r.NeedAuth() {
+		logging.Warningf("Alist %s 令牌已失效，重新登录后重试：%s", client.GetEndpoint(), r.GetAPIPath())
+		data, err = client.send(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheKey := r.GetCacheKey(); cacheKey != "" && client.cache != nil {
+		err = client.cache.Set(cacheKey, data)
+		if err != nil {
+			return nil, fmt.Errorf("缓存响应体失败: %w", err)
+		}
+	}
+
+	return data, nil
+}
+
+// 发送请求，检查响应状态码并返回响应体
+//
+// 令牌失效时清除令牌并返回 ErrUnauthorized
+func (client *AlistClient) send(r Request) ([]byte, error) {
 	req := newHTTPReq(client.GetEndpoint(), r)
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
+	var token string
 	if r.NeedAuth() {
-		token, err := client.getToken()
+		var err error
+		token, err = client.getToken()
 		if err != nil {
 			return nil, err
 		}
@@ -140,23 +268,26 @@ func doRequest[T any](client *AlistClient, r Request) (*T, error) {
 		return nil, fmt.Errorf("读取响应体失败: %w", err)
 	}
 
-	err = json.Unmarshal(data, &resp)
-	if err != nil {
-		return nil, fmt.Errorf("解析响应体失败: %w", err)
+	var resp AlistResponse[json.RawMessage]
+	if err = json.Unmarshal(data, &resp); err != nil {
+		if res.StatusCode == http.StatusOK {
+			return nil, fmt.Errorf("解析响应体失败: %w", err)
+		}
+		// 部分版本的 Alist 令牌失效时直接响应 401，反向代理出错时响应体也不是 JSON
+		if token != "" && res.StatusCode == http.StatusUnauthorized {
+			client.invalidateToken(token)
+		}
+		return nil, &APIError{StatusCode: res.StatusCode, Message: http.StatusText(res.StatusCode)}
 	}
 
 	if resp.Code != http.StatusOK {
-		return nil, fmt.Errorf("请求失败，HTTP 状态码: %d, 响应状态码: %d, 响应信息: %s", res.StatusCode, resp.Code, resp.Message)
-	}
-
-	if cacheKey != "" && client.cache != nil {
-		err = client.cache.Set(cacheKey, data)
-		if err != nil {
-			return nil, fmt.Errorf("缓存响应体失败: %w", err)
+		apiErr := &APIError{StatusCode: res.StatusCode, Code: resp.Code, Message: resp.Message}
+		if token != "" && errors.Is(apiErr, ErrUnauthorized) {
+			client.invalidateToken(token)
 		}
+		return nil, apiErr
 	}
-
-	return &resp.Data, nil
+	return data, nil
 }
 
 // ==========Alist API(v3) 相关操作==========
@@ -167,6 +298,13 @@ func (client *AlistClient) authLogin() (*AuthLoginData, error) {
 		Username: client.GetUsername(),
 		Password: client.password,
 	}
+	if client.otpSecret != "" {
+		code, err := utils.GenerateTOTP(client.otpSecret, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("生成二步验证码失败: %w", err)
+		}
+		req.OtpCode = code
+	}
 	data, err := doRequest[AuthLoginData](client, &req)
 	if err != nil {
 		return nil, fmt.Errorf("登录失败: %w", err)
@@ -184,6 +322,89 @@ func (client *AlistClient) FsGet(req *FsGetRequest) (*FsGetData, error) {
 	return respData, nil
 }
 
+// 获取目录中的文件/目录（分页）
+func (client *AlistClient) FsList(req *FsListRequest) (*FsListData, error) {
+	respData, err := doRequest[FsListData](client, req)
+	if err != nil {
+		return nil, fmt.Errorf("获取目录内容失败: %w", err)
+	}
+	return respData, nil
+}
+
+// 分页获取目录中的所有文件/目录
+func (client *AlistClient) FsListAll(p string, password string) ([]FsObject, error) {
+	var objects []FsObject
+	for page := uint32(1); ; page++ {
+		data, err := client.FsList(&FsListRequest{Path: p, Password: password, Page: page, PerPage: alistListPageSize})
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, data.Content...)
+		if len(data.Content) == 0 || int64(len(objects)) >= data.Total {
+			return objects, nil
+		}
+	}
+}
+
+// 强制 Alist 刷新存储中的目录，并清除该目录及其中文件的 API 缓存
+//
+// 需要账户拥有写入权限
+func (client *AlistClient) FsRefresh(p string, password string) error {
+	req := FsListRequest{Path: p, Password: password, Page: 1, PerPage: 1, Refresh: true}
+	if _, err := doRequest[FsListData](client, &req); err != nil {
+		return fmt.Errorf("刷新目录失败: %w", err)
+	}
+	dir := strings.TrimSuffix(p, "/")
+	client.purgeCache(func(key string) bool {
+		for _, prefix := range []string{req.GetAPIPath(), FsGetRequest{}.GetAPIPath(), FsDirsRequest{}.GetAPIPath()} {
+			if rest, ok := strings.CutPrefix(key, prefix+dir); ok && (strings.HasPrefix(rest, "?") || strings.HasPrefix(rest, "/")) {
+				return true
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// 搜索文件/目录
+func (client *AlistClient) FsSearch(req *FsSearchRequest) (*FsSearchData, error) {
+	respData, err := doRequest[FsSearchData](client, req)
+	if err != nil {
+		return nil, fmt.Errorf("搜索失败: %w", err)
+	}
+	return respData, nil
+}
+
+// 获取目录中的子目录
+func (client *AlistClient) FsDirs(req *FsDirsRequest) ([]FsDirsObject, error) {
+	respData, err := doRequest[[]FsDirsObject](client, req)
+	if err != nil {
+		return nil, fmt.Errorf("获取子目录失败: %w", err)
+	}
+	return *respData, nil
+}
+
+// 调用存储驱动的其他方法，返回原始的响应数据
+func (client *AlistClient) FsOther(req *FsOtherRequest) (json.RawMessage, error) {
+	respData, err := doRequest[json.RawMessage](client, req)
+	if err != nil {
+		return nil, fmt.Errorf("调用存储驱动方法 %s 失败: %w", req.Method, err)
+	}
+	return *respData, nil
+}
+
+// 列出所有存储（需要管理员账户）
+func (client *AlistClient) AdminStorageList() (*StorageListData, error) {
+	if !client.IsAdmin() {
+		return nil, fmt.Errorf("列出存储失败: %w，需要管理员账户", ErrForbidden)
+	}
+	respData, err := doRequest[StorageListData](client, &AdminStorageListRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("列出存储失败: %w", err)
+	}
+	return respData, nil
+}
+
 func (client *AlistClient) Me() (*UserInfoData, error) {
 	data, err := doRequest[UserInfoData](client, &MeRequest{})
 	if err != nil {
@@ -192,20 +413,28 @@ func (client *AlistClient) Me() (*UserInfoData, error) {
 	return data, nil
 }
 
+// 检查客户端是否可用
+//
+// 直接请求 /api/me，不从缓存中读取，也不与其他请求合并
+func (client *AlistClient) ping() error {
+	_, err := client.fetch(&MeRequest{})
+	return err
+}
+
 // GetFileURL 获取文件的可访问 URL
-func (client *AlistClient) GetFileURL(p string, isRawURL bool) (string, error) {
-	fileData, err := client.FsGet(&FsGetRequest{Path: p, Page: 1})
+//
+// password 为文件所在加密目录的密码，不在加密目录中时为空字符串
+func (client *AlistClient) GetFileURL(p string, password string, isRawURL bool) (string, error) {
+	fileData, err := client.FsGet(&FsGetRequest{Path: p, Password: password, Page: 1})
 	if err != nil {
 		return "", fmt.Errorf("获取文件信息失败：%w", err)
 	}
 	if isRawURL {
 		return fileData.RawURL, nil
 	}
-	var url strings.Builder
-	url.WriteString(client.GetEndpoint())
+	fileURL := client.GetEndpoint() + (&url.URL{Path: path.Join("/d", client.userInfo.BasePath, p)}).EscapedPath()
 	if fileData.Sign != "" {
-		url.WriteString("?sign=" + fileData.Sign)
+		fileURL += "?sign=" + url.QueryEscape(fileData.Sign)
 	}
-	url.WriteString(path.Join("/d", client.userInfo.BasePath, p))
-	return url.String(), nil
+	return fileURL, nil
 }
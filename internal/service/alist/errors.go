@@ -0,0 +1,47 @@
+package alist
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrUnauthorized = errors.New("Alist 令牌无效或已过期")
+	ErrForbidden    = errors.New("没有权限或目录密码错误")
+	ErrNotFound     = errors.New("文件、目录或存储不存在")
+	ErrServer       = errors.New("Alist 服务器错误")
+)
+
+// Alist API 请求失败
+//
+// 可以通过 errors.Is 判断失败原因：ErrUnauthorized、ErrForbidden、ErrNotFound、ErrServer
+type APIError struct {
+	StatusCode int    // HTTP 状态码
+	Code       int64  // 响应状态码
+	Message    string // 响应信息
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("请求失败，HTTP 状态码: %d, 响应状态码: %d, 响应信息: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Alist 找不到文件或存储时响应状态码为 500，需要根据响应信息判断（如 object not found、storage not found）
+func (e *APIError) notFound() bool {
+	return e.Code == http.StatusNotFound || strings.Contains(strings.ToLower(e.Message), "not found")
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.Code == http.StatusUnauthorized || e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.Code == http.StatusForbidden || e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.notFound()
+	case ErrServer:
+		return e.StatusCode >= http.StatusInternalServerError || (e.Code >= http.StatusInternalServerError && !e.notFound())
+	}
+	return false
+}
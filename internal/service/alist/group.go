@@ -0,0 +1,387 @@
+package alist
+
+import (
+	"MediaWarp/constants"
+	"MediaWarp/internal/config"
+	"MediaWarp/internal/logging"
+	"MediaWarp/internal/metrics"
+	"MediaWarp/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 节点设置
+type NodeOptions struct {
+	ADDR      string
+	Username  string
+	Password  string
+	OTPSecret string
+	Token     *string
+	Weight    int // 权重，小于等于 0 时为 1
+}
+
+// 加密目录
+type FolderPassword struct {
+	Path     string // Alist 目录路径
+	Password string // 目录密码
+}
+
+// 节点组中的节点
+type groupNode struct {
+	options NodeOptions
+	client  atomic.Pointer[AlistClient] // 创建客户端失败时为 nil，由健康检查重新创建
+	healthy atomic.Bool
+}
+
+func (node *groupNode) endpoint() string {
+	return utils.GetEndpoint(node.options.ADDR)
+}
+
+// 创建节点的客户端
+func (node *groupNode) connect(cfg *config.Setting) error {
+	o := node.options
+	client, err := NewAlistClient(cfg, o.ADDR, o.Username, o.Password, o.OTPSecret, o.Token)
+	if err != nil {
+		return err
+	}
+	node.client.Store(client)
+	return nil
+}
+
+// Alist 节点组
+//
+// 由内容相同的多个 Alist 服务器组成，按照策略选择节点，
+// 请求失败或超时时自动切换到其他节点；定期通过 /api/me 检查节点是否可用
+type Group struct {
+	cfg       *config.Setting // 创建节点组时使用的配置
+	name      string          // 节点组名称（第一个节点的地址）
+	strategy  constants.AlistStrategy
+	nodes     []*groupNode
+	counter   atomic.Uint64    // 轮询计数
+	passwords []FolderPassword // 加密目录，按路径长度从长到短排序
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+var groups sync.Map // 正在使用的节点组 *Group -> struct{}，用于导出节点状态指标
+
+func init() {
+	metrics.NewGaugeFunc("mediawarp_alist_node_up", "Alist 节点是否可用", "node", func() map[string]float64 {
+		result := make(map[string]float64)
+		groups.Range(func(key, _ any) bool {
+			for _, node := range key.(*Group).nodes {
+				if node.healthy.Load() {
+					result[node.endpoint()] = 1
+				} else {
+					result[node.endpoint()] = 0
+				}
+			}
+			return true
+		})
+		return result
+	})
+}
+
+// 创建节点组
+//
+// 使用 cfg 中的缓存、超时和健康检查设置创建客户端，创建客户端失败的节点标记为不可用，由健康检查重新创建
+func NewGroup(cfg *config.Setting, strategy constants.AlistStrategy, nodes []NodeOptions, passwords []FolderPassword) (*Group, error) {
+	if len(nodes) == 0 {
+		return nil, errors.New("节点组中没有节点")
+	}
+	group := &Group{
+		cfg:      cfg,
+		name:     utils.GetEndpoint(nodes[0].ADDR),
+		strategy: strategy,
+		nodes:    make([]*groupNode, 0, len(nodes)),
+		passwords: slices.SortedStableFunc(slices.Values(passwords), func(a, b FolderPassword) int {
+			return len(b.Path) - len(a.Path) // 优先匹配更深的目录
+		}),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	var wg sync.WaitGroup
+	for _, options := range nodes {
+		if options.Weight <= 0 {
+			options.Weight = 1
+		}
+		node := &groupNode{options: options}
+		group.nodes = append(group.nodes, node)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := node.connect(cfg); err != nil {
+				logging.Warningf("注册 Alist 节点 %s 失败：%v", node.endpoint(), err)
+				return
+			}
+			node.healthy.Store(true)
+		}()
+	}
+	wg.Wait()
+
+	groups.Store(group, struct{}{})
+	go group.healthCheckLoop(cfg.AlistStrm.HealthCheck.CheckInterval())
+	return group, nil
+}
+
+// 节点组名称
+func (group *Group) Name() string {
+	return group.name
+}
+
+// 检查节点是否可用，节点状态改变时记录日志
+func (group *Group) check(node *groupNode) {
+	var err error
+	if client := node.client.Load(); client == nil {
+		err = node.connect(group.cfg)
+	} else {
+		err = client.ping()
+	}
+	group.setHealthy(node, err)
+}
+
+// 更新节点状态，err 为 nil 表示节点可用
+func (group *Group) setHealthy(node *groupNode, err error) {
+	healthy := err == nil
+	if node.healthy.Swap(healthy) == healthy {
+		return
+	}
+	if healthy {
+		logging.Infof("Alist 节点组 %s 中的节点 %s 已恢复可用", group.name, node.endpoint())
+	} else {
+		logging.Warningf("Alist 节点组 %s 中的节点 %s 不可用：%v", group.name, node.endpoint(), err)
+	}
+}
+
+// 定期检查所有节点
+func (group *Group) healthCheckLoop(interval time.Duration) {
+	defer close(group.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-group.stop:
+			return
+		case <-ticker.C:
+			var wg sync.WaitGroup
+			for _, node := range group.nodes {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					group.check(node)
+				}()
+			}
+			wg.Wait()
+		}
+	}
+}
+
+// 按照策略排列节点，可用的节点在前，不可用的节点作为最后的选择
+func (group *Group) candidates() []*groupNode {
+	nodes := slices.Clone(group.nodes)
+	switch group.strategy {
+	case constants.RoundRobinStrategy:
+		start := int((group.counter.Add(1) - 1) % uint64(len(nodes)))
+		nodes = append(nodes[start:], nodes[:start]...)
+	case constants.WeightedStrategy: // 按照权重依次随机抽取
+		for i := range nodes {
+			var total int
+			for _, node := range nodes[i:] {
+				total += node.options.Weight
+			}
+			n := rand.IntN(total)
+			for j := i; j < len(nodes); j++ {
+				if n -= nodes[j].options.Weight; n < 0 {
+					nodes[i], nodes[j] = nodes[j], nodes[i]
+					break
+				}
+			}
+		}
+	}
+	slices.SortStableFunc(nodes, func(a, b *groupNode) int {
+		switch {
+		case a.healthy.Load() == b.healthy.Load():
+			return 0
+		case a.healthy.Load():
+			return -1
+		default:
+			return 1
+		}
+	})
+	return nodes
+}
+
+// 依次使用各个节点执行 fn，直到成功
+//
+// 网络错误或超时时将节点标记为不可用
+func doGroup[T any](group *Group, fn func(client *AlistClient) (T, error)) (T, error) {
+	var (
+		zero T
+		errs []error
+	)
+	for index, node := range group.candidates() {
+		client := node.client.Load()
+		if client == nil {
+			errs = append(errs, fmt.Errorf("%s: 客户端未初始化", node.endpoint()))
+			continue
+		}
+		result, err := fn(client)
+		if err == nil {
+			if index > 0 {
+				metrics.AlistFailovers.Inc(group.name)
+				logging.Infof("Alist 节点组 %s 已切换到节点 %s", group.name, node.endpoint())
+			}
+			return result, nil
+		}
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			group.setHealthy(node, err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", node.endpoint(), err))
+	}
+	return zero, errors.Join(errs...)
+}
+
+// 获取路径所在加密目录的密码，不在加密目录中时返回空字符串
+func (group *Group) folderPassword(p string) string {
+	for _, folder := range group.passwords {
+		if _, ok := utils.TrimPathPrefix(p, folder.Path); ok || strings.TrimSuffix(folder.Path, "/") == "" {
+			return folder.Password
+		}
+	}
+	return ""
+}
+
+// 获取某个文件/目录信息
+//
+// 未指定密码时使用所在加密目录的密码
+func (group *Group) FsGet(req *FsGetRequest) (*FsGetData, error) {
+	if req.Password == "" {
+		withPassword := *req
+		withPassword.Password = group.folderPassword(req.Path)
+		req = &withPassword
+	}
+	return doGroup(group, func(client *AlistClient) (*FsGetData, error) {
+		return client.FsGet(req)
+	})
+}
+
+// 获取目录中的文件/目录（分页）
+//
+// 未指定密码时使用所在加密目录的密码
+func (group *Group) FsList(req *FsListRequest) (*FsListData, error) {
+	if req.Password == "" {
+		withPassword := *req
+		withPassword.Password = group.folderPassword(req.Path)
+		req = &withPassword
+	}
+	return doGroup(group, func(client *AlistClient) (*FsListData, error) {
+		return client.FsList(req)
+	})
+}
+
+// 分页获取目录中的所有文件/目录，所有分页从同一个节点获取
+func (group *Group) FsListAll(p string) ([]FsObject, error) {
+	password := group.folderPassword(p)
+	return doGroup(group, func(client *AlistClient) ([]FsObject, error) {
+		return client.FsListAll(p, password)
+	})
+}
+
+// 强制刷新目录
+//
+// 镜像节点的存储各自独立，需要在所有可用的节点上刷新
+func (group *Group) FsRefresh(p string) error {
+	password := group.folderPassword(p)
+	var errs []error
+	for _, node := range group.nodes {
+		client := node.client.Load()
+		if client == nil || !node.healthy.Load() {
+			continue
+		}
+		if err := client.FsRefresh(p, password); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", node.endpoint(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 搜索文件/目录
+//
+// 未指定密码时使用搜索目录所在加密目录的密码
+func (group *Group) FsSearch(req *FsSearchRequest) (*FsSearchData, error) {
+	if req.Password == "" {
+		withPassword := *req
+		withPassword.Password = group.folderPassword(req.Parent)
+		req = &withPassword
+	}
+	return doGroup(group, func(client *AlistClient) (*FsSearchData, error) {
+		return client.FsSearch(req)
+	})
+}
+
+// 获取目录中的子目录
+//
+// 未指定密码时使用所在加密目录的密码
+func (group *Group) FsDirs(req *FsDirsRequest) ([]FsDirsObject, error) {
+	if req.Password == "" {
+		withPassword := *req
+		withPassword.Password = group.folderPassword(req.Path)
+		req = &withPassword
+	}
+	return doGroup(group, func(client *AlistClient) ([]FsDirsObject, error) {
+		return client.FsDirs(req)
+	})
+}
+
+// 调用存储驱动的其他方法
+//
+// 未指定密码时使用所在加密目录的密码
+func (group *Group) FsOther(req *FsOtherRequest) (json.RawMessage, error) {
+	if req.Password == "" {
+		withPassword := *req
+		withPassword.Password = group.folderPassword(req.Path)
+		req = &withPassword
+	}
+	return doGroup(group, func(client *AlistClient) (json.RawMessage, error) {
+		return client.FsOther(req)
+	})
+}
+
+// 列出所有存储（需要管理员账户）
+func (group *Group) AdminStorageList() (*StorageListData, error) {
+	return doGroup(group, func(client *AlistClient) (*StorageListData, error) {
+		return client.AdminStorageList()
+	})
+}
+
+// 获取文件的可访问 URL
+func (group *Group) GetFileURL(p string, isRawURL bool) (string, error) {
+	password := group.folderPassword(p)
+	return doGroup(group, func(client *AlistClient) (string, error) {
+		return client.GetFileURL(p, password, isRawURL)
+	})
+}
+
+// 关闭节点组
+//
+// 停止健康检查并关闭所有客户端
+func (group *Group) Close() {
+	close(group.stop)
+	<-group.done
+	groups.Delete(group)
+	for _, node := range group.nodes {
+		if client := node.client.Load(); client != nil {
+			client.Close()
+		}
+	}
+}
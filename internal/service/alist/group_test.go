@@ -0,0 +1,61 @@
+package alist
+
+import (
+	"MediaWarp/constants"
+	"MediaWarp/internal/config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// 模拟的 Alist 服务器
+func newFakeAlist() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data any
+		switch r.URL.Path {
+		case "/api/auth/login":
+			data = map[string]any{"token": "token"}
+		case "/api/me":
+			data = map[string]any{"username": "admin"}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"code": 200, "message": "success", "data": data})
+	}))
+}
+
+func TestGroupHealthCheck(t *testing.T) {
+	cfg := &config.Setting{Cache: config.CacheSetting{Enable: true, AlistAPITTL: 10 * time.Minute}}
+	primary, mirror := newFakeAlist(), newFakeAlist()
+	defer mirror.Close()
+	group, err := NewGroup(cfg, constants.PrimaryStrategy, []NodeOptions{
+		{ADDR: primary.URL, Username: "admin", Password: "password"},
+		{ADDR: mirror.URL, Username: "admin", Password: "password"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("创建节点组失败：%s", err)
+	}
+	defer group.Close()
+
+	node := group.nodes[0]
+	group.check(node)
+	if !node.healthy.Load() {
+		t.Fatal("节点应可用")
+	}
+
+	primary.Close()
+	group.check(node)
+	if node.healthy.Load() {
+		t.Error("节点停止后健康检查不应使用缓存的结果")
+	}
+	group.check(node)
+	if node.healthy.Load() {
+		t.Error("不可用的节点不应被健康检查恢复为可用")
+	}
+	if candidates := group.candidates(); candidates[0] != group.nodes[1] {
+		t.Error("应优先选择可用的节点")
+	}
+}
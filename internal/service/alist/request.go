@@ -2,10 +2,13 @@ package alist
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 )
 
@@ -61,12 +64,169 @@ func (FsGetRequest) NeedAuth() bool {
 }
 
 func (req *FsGetRequest) GetCacheKey() string {
-	return req.GetAPIPath() + req.Path + req.Password + strconv.Itoa(int(req.Page)) + strconv.Itoa(int(req.PerPage)) + strconv.FormatBool(req.Refresh)
+	query := url.Values{}
+	setPasswordDigest(query, req.Password)
+	query.Set("page", strconv.Itoa(int(req.Page)))
+	query.Set("per_page", strconv.Itoa(int(req.PerPage)))
+	query.Set("refresh", strconv.FormatBool(req.Refresh))
+	return req.GetAPIPath() + req.Path + "?" + query.Encode()
+}
+
+// 缓存键中使用密码的摘要，避免通过缓存管理 API 泄露密码
+func setPasswordDigest(query url.Values, password string) {
+	if password != "" {
+		sum := sha256.Sum256([]byte(password))
+		query.Set("password", hex.EncodeToString(sum[:8]))
+	}
+}
+
+type FsListRequest struct {
+	Path     string `json:"path"`
+	Password string `json:"password"`
+	Page     uint32 `json:"page"`
+	PerPage  uint32 `json:"per_page"` // 为 0 时返回所有条目
+	Refresh  bool   `json:"refresh"`  // 强制刷新存储中的目录（需要写入权限）
+}
+
+func (FsListRequest) GetMethod() string {
+	return http.MethodPost
+}
+
+func (FsListRequest) GetAPIPath() string {
+	return "/api/fs/list"
+}
+
+func (FsListRequest) NeedAuth() bool {
+	return true
+}
+
+// 强制刷新的请求不缓存
+func (req *FsListRequest) GetCacheKey() string {
+	if req.Refresh {
+		return ""
+	}
+	query := url.Values{}
+	setPasswordDigest(query, req.Password)
+	query.Set("page", strconv.Itoa(int(req.Page)))
+	query.Set("per_page", strconv.Itoa(int(req.PerPage)))
+	return req.GetAPIPath() + req.Path + "?" + query.Encode()
+}
+
+// 搜索范围
+type SearchScope int
+
+const (
+	SearchScopeAll  SearchScope = iota // 文件和目录
+	SearchScopeDir                     // 仅目录
+	SearchScopeFile                    // 仅文件
+)
+
+// 搜索文件/目录，需要在 Alist 中开启搜索索引
+type FsSearchRequest struct {
+	Parent   string      `json:"parent"` // 搜索的目录
+	Keywords string      `json:"keywords"`
+	Scope    SearchScope `json:"scope"`
+	Page     uint32      `json:"page"`
+	PerPage  uint32      `json:"per_page"`
+	Password string      `json:"password"`
+}
+
+func (FsSearchRequest) GetMethod() string {
+	return http.MethodPost
+}
+
+func (FsSearchRequest) GetAPIPath() string {
+	return "/api/fs/search"
+}
+
+func (FsSearchRequest) NeedAuth() bool {
+	return true
+}
+
+func (req *FsSearchRequest) GetCacheKey() string {
+	query := url.Values{}
+	setPasswordDigest(query, req.Password)
+	query.Set("keywords", req.Keywords)
+	query.Set("scope", strconv.Itoa(int(req.Scope)))
+	query.Set("page", strconv.Itoa(int(req.Page)))
+	query.Set("per_page", strconv.Itoa(int(req.PerPage)))
+	return req.GetAPIPath() + req.Parent + "?" + query.Encode()
+}
+
+// 获取子目录
+type FsDirsRequest struct {
+	Path      string `json:"path"`
+	Password  string `json:"password"`
+	ForceRoot bool   `json:"force_root"` // 从根目录而不是用户的基本路径开始
+}
+
+func (FsDirsRequest) GetMethod() string {
+	return http.MethodPost
+}
+
+func (FsDirsRequest) GetAPIPath() string {
+	return "/api/fs/dirs"
+}
+
+func (FsDirsRequest) NeedAuth() bool {
+	return true
+}
+
+func (req *FsDirsRequest) GetCacheKey() string {
+	query := url.Values{}
+	setPasswordDigest(query, req.Password)
+	query.Set("force_root", strconv.FormatBool(req.ForceRoot))
+	return req.GetAPIPath() + req.Path + "?" + query.Encode()
+}
+
+// 调用存储驱动的其他方法（如获取视频预览播放地址 video_preview）
+type FsOtherRequest struct {
+	Path     string `json:"path"`
+	Password string `json:"password"`
+	Method   string `json:"method"`
+	Data     any    `json:"data,omitempty"`
+}
+
+func (FsOtherRequest) GetMethod() string {
+	return http.MethodPost
+}
+
+func (FsOtherRequest) GetAPIPath() string {
+	return "/api/fs/other"
+}
+
+func (FsOtherRequest) NeedAuth() bool {
+	return true
+}
+
+// 响应中通常包含有时效的链接，不缓存
+func (req *FsOtherRequest) GetCacheKey() string {
+	return ""
+}
+
+// 列出所有存储（需要管理员账户）
+type AdminStorageListRequest struct{}
+
+func (AdminStorageListRequest) GetMethod() string {
+	return http.MethodGet
+}
+
+func (AdminStorageListRequest) GetAPIPath() string {
+	return "/api/admin/storage/list"
+}
+
+func (AdminStorageListRequest) NeedAuth() bool {
+	return true
+}
+
+func (req *AdminStorageListRequest) GetCacheKey() string {
+	return ""
 }
 
 type AuthLoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	OtpCode  string `json:"otp_code,omitempty"` // 二步验证码
 }
 
 func (AuthLoginRequest) GetMethod() string {
@@ -28,6 +28,72 @@ type FsGetData struct {
 	Type     int64  `json:"type"`  // 类型
 }
 
+// 目录中的文件/目录
+type FsObject struct {
+	Created  string `json:"created"` // 创建时间
+	HashInfo any    `json:"hash_info"`
+	Hashinfo string `json:"hashinfo"`
+	IsDir    bool   `json:"is_dir"`   // 是否是文件夹
+	Modified string `json:"modified"` // 修改时间
+	Name     string `json:"name"`     // 文件名
+	Sign     string `json:"sign"`     // 签名
+	Size     int64  `json:"size"`     // 大小
+	Thumb    string `json:"thumb"`    // 缩略图
+	Type     int64  `json:"type"`     // 类型
+}
+
+type FsListData struct {
+	Content  []FsObject `json:"content"`  // 文件/目录列表
+	Header   string     `json:"header"`   // 说明
+	Provider string     `json:"provider"` // 存储驱动
+	Readme   string     `json:"readme"`   // 说明
+	Total    int64      `json:"total"`    // 总数
+	Write    bool       `json:"write"`    // 是否有写入权限
+}
+
+type FsSearchObject struct {
+	IsDir  bool   `json:"is_dir"` // 是否是文件夹
+	Name   string `json:"name"`   // 文件名
+	Parent string `json:"parent"` // 所在目录
+	Size   int64  `json:"size"`   // 大小
+	Type   int64  `json:"type"`   // 类型
+}
+
+type FsSearchData struct {
+	Content []FsSearchObject `json:"content"` // 搜索结果
+	Total   int64            `json:"total"`   // 总数
+}
+
+type FsDirsObject struct {
+	Modified string `json:"modified"` // 修改时间
+	Name     string `json:"name"`     // 目录名
+}
+
+type StorageData struct {
+	Addition        string `json:"addition"`         // 驱动的附加设置（JSON）
+	CacheExpiration int64  `json:"cache_expiration"` // 缓存过期时间（分钟）
+	Disabled        bool   `json:"disabled"`         // 是否禁用
+	DownProxyURL    string `json:"down_proxy_url"`   // 下载代理 URL
+	Driver          string `json:"driver"`           // 驱动
+	EnableSign      bool   `json:"enable_sign"`      // 是否启用签名
+	ExtractFolder   string `json:"extract_folder"`
+	ID              int64  `json:"id"`         // id
+	Modified        string `json:"modified"`   // 修改时间
+	MountPath       string `json:"mount_path"` // 挂载路径
+	Order           int64  `json:"order"`      // 排序
+	OrderBy         string `json:"order_by"`
+	OrderDirection  string `json:"order_direction"`
+	Remark          string `json:"remark"` // 备注
+	Status          string `json:"status"` // 状态（work 表示正常）
+	WebProxy        bool   `json:"web_proxy"`
+	WebdavPolicy    string `json:"webdav_policy"`
+}
+
+type StorageListData struct {
+	Content []StorageData `json:"content"` // 存储列表
+	Total   int64         `json:"total"`   // 总数
+}
+
 type UserInfoData struct {
 	BasePath   string `json:"base_path"`  // 根目录
 	Disabled   bool   `json:"disabled"`   // 是否禁用
@@ -4,14 +4,18 @@ import (
 	"MediaWarp/constants"
 	"MediaWarp/utils"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"strconv"
 )
 
 type EmbyServer struct {
 	endpoint string
-	apiKey   string // 认证方式：APIKey；获取方式：Emby控制台 -> 高级 -> API密钥
+	apiKey   string                     // 认证方式：APIKey；获取方式：Emby控制台 -> 高级 -> API密钥
+	flight   utils.SingleFlight[[]byte] // 合并相同的并发查询
 }
 
 // 获取媒体服务器类型
@@ -45,22 +49,53 @@ func (embyServer *EmbyServer) ItemsServiceQueryItem(ids string, limit int, field
 	params.Add("Recursive", "true")
 	params.Add("api_key", embyServer.GetAPIKey())
 	api := embyServer.GetEndpoint() + "/Items?" + params.Encode()
-	resp, err := utils.GetHTTPClient().Get(api)
+	body, err := embyServer.flight.Do(api, func() ([]byte, error) { // 同时查询同一个 Item 时只请求一次
+		resp, err := utils.GetHTTPClient().Get(api)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	err = json.Unmarshal(body, itemResponse)
 	if err != nil {
 		return nil, err
 	}
+	return itemResponse, nil
+}
 
-	err = json.Unmarshal(body, itemResponse)
+// UsersService
+// /Users/{userID}
+//
+// 使用客户端的访问令牌获取用户信息并返回用户 ID，
+// Emby 只允许访问令牌所属的用户（或管理员）获取用户信息，可以用于校验用户 ID 与访问令牌是否对应
+func (embyServer *EmbyServer) UsersServiceGetUserID(token string, userID string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, embyServer.GetEndpoint()+"/Users/"+url.PathEscape(userID), nil)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return itemResponse, nil
+	req.Header.Set("X-Emby-Token", token)
+	resp, err := utils.GetHTTPClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("获取用户信息失败，HTTP 状态码: %d", resp.StatusCode)
+	}
+
+	var user UserDto
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return "", err
+	}
+	if user.ID == "" {
+		return "", errors.New("获取用户信息失败，响应中没有用户 ID")
+	}
+	return user.ID, nil
 }
 
 // 获取index.html内容 API：/web/index.html
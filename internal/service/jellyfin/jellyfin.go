@@ -4,14 +4,18 @@ import (
 	"MediaWarp/constants"
 	"MediaWarp/utils"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"strconv"
 )
 
 type Jellyfin struct {
 	endpoint string
-	apiKey   string // 认证方式：APIKey；获取方式：Jellyfin 控制台 -> 高级 -> API密钥
+	apiKey   string                     // 认证方式：APIKey；获取方式：Jellyfin 控制台 -> 高级 -> API密钥
+	flight   utils.SingleFlight[[]byte] // 合并相同的并发查询
 }
 
 // 获取媒体服务器类型
@@ -44,13 +48,15 @@ func (jellyfin *Jellyfin) ItemsServiceQueryItem(ids string, limit int, fields st
 	params.Add("Fields", fields)
 	params.Add("api_key", jellyfin.GetAPIKey())
 
-	resp, err := utils.GetHTTPClient().Get(jellyfin.GetEndpoint() + "/Items?" + params.Encode())
-	if err != nil {
-		return nil, err
-	}
-
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	api := jellyfin.GetEndpoint() + "/Items?" + params.Encode()
+	body, err := jellyfin.flight.Do(api, func() ([]byte, error) { // 同时查询同一个 Item 时只请求一次
+		resp, err := utils.GetHTTPClient().Get(api)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -61,6 +67,35 @@ func (jellyfin *Jellyfin) ItemsServiceQueryItem(ids string, limit int, fields st
 	return itemResponse, nil
 }
 
+// UserService
+// /Users/Me
+//
+// 使用客户端的访问令牌获取当前用户的 ID
+func (jellyfin *Jellyfin) UserServiceGetCurrentUserID(token string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, jellyfin.GetEndpoint()+"/Users/Me", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Emby-Token", token)
+	resp, err := utils.GetHTTPClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("获取当前用户失败，HTTP 状态码: %d", resp.StatusCode)
+	}
+
+	var user UserDto
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return "", err
+	}
+	if user.ID == "" {
+		return "", errors.New("获取当前用户失败，响应中没有用户 ID")
+	}
+	return user.ID, nil
+}
+
 // 获取 Jellyfin 实例
 func New(addr string, apiKey string) *Jellyfin {
 	jellyfin := &Jellyfin{
@@ -5,6 +5,12 @@ type Response struct {
 	TotalRecordCount *int64        `json:"TotalRecordCount,omitempty"`
 }
 
+// /Users/:userID 的响应（仅包含用到的字段）
+type UserDto struct {
+	ID   string `json:"Id"`
+	Name string `json:"Name,omitempty"`
+}
+
 // /Items/:itemID/PlaybackInfo的响应
 type PlaybackInfoResponse struct {
 	ErrorCode     *PlaybackErrorCode `json:"ErrorCode,omitempty"`
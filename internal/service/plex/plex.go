@@ -0,0 +1,211 @@
+package plex
+
+import (
+	"MediaWarp/constants"
+	"MediaWarp/utils"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	sectionPageSize = 500                           // 遍历媒体库时每页的条目数量
+	plexTVUserURL   = "https://plex.tv/api/v2/user" // 获取访问令牌所属账户的接口
+)
+
+type Plex struct {
+	endpoint string
+	token    string // 认证方式：X-Plex-Token；获取方式：https://support.plex.tv/articles/204059436
+}
+
+// 获取媒体服务器类型
+func (plex *Plex) GetType() constants.MediaServerType {
+	return constants.PLEX
+}
+
+// 获取 Plex 连接地址
+//
+// 包含协议、服务器域名（IP）、端口号
+// 示例：return "http://plex.example.com:32400"
+func (plex *Plex) GetEndpoint() string {
+	return plex.endpoint
+}
+
+// 获取 Plex 的 Token
+func (plex *Plex) GetToken() string {
+	return plex.token
+}
+
+// 获取条目元数据
+// /library/metadata/:ratingKey
+func (plex *Plex) GetMetadata(ratingKey string) (*MediaContainer, error) {
+	return plex.getMediaContainer("/library/metadata/"+ratingKey, nil)
+}
+
+// 获取所有媒体库
+// /library/sections
+func (plex *Plex) GetSections() (*MediaContainer, error) {
+	return plex.getMediaContainer("/library/sections", nil)
+}
+
+// 获取媒体库中的所有媒体文件
+//
+// Plex 没有通过 Part ID 获取媒体文件的接口，需要分页遍历电影和剧集媒体库中的条目
+func (plex *Plex) GetParts() ([]Part, error) {
+	sections, err := plex.GetSections()
+	if err != nil {
+		return nil, fmt.Errorf("获取媒体库失败: %w", err)
+	}
+	var parts []Part
+	for _, section := range sections.Directories {
+		var itemType string
+		switch section.Type {
+		case "movie":
+			itemType = "1"
+		case "show":
+			itemType = "4" // 剧集媒体库中的单集
+		default:
+			continue
+		}
+		for start := 0; ; start += sectionPageSize {
+			query := url.Values{
+				"type":                   {itemType},
+				"X-Plex-Container-Start": {strconv.Itoa(start)},
+				"X-Plex-Container-Size":  {strconv.Itoa(sectionPageSize)},
+			}
+			container, err := plex.getMediaContainer("/library/sections/"+url.PathEscape(section.Key)+"/all", query)
+			if err != nil {
+				return nil, fmt.Errorf("获取媒体库 %s 条目失败: %w", section.Title, err)
+			}
+			items := container.Items()
+			for _, item := range items {
+				for _, media := range item.Media {
+					parts = append(parts, media.Part...)
+				}
+			}
+			if len(items) < sectionPageSize || (container.TotalSize > 0 && int64(start+len(items)) >= container.TotalSize) {
+				break
+			}
+		}
+	}
+	return parts, nil
+}
+
+// 获取访问令牌所属的 Plex 账户 ID
+//
+// Plex 的访问令牌由 plex.tv 签发，需要向 plex.tv 查询；clientID 为客户端标识（X-Plex-Client-Identifier）
+func GetAccountID(token string, clientID string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, plexTVUserURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Plex-Token", token)
+	req.Header.Set("X-Plex-Client-Identifier", clientID)
+	req.Header.Set("X-Plex-Product", "MediaWarp")
+
+	resp, err := utils.GetHTTPClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("获取 Plex 账户失败，HTTP 状态码: %d", resp.StatusCode)
+	}
+
+	var account Account
+	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+		return "", err
+	}
+	if account.ID == 0 {
+		return "", errors.New("获取 Plex 账户失败，响应中没有账户 ID")
+	}
+	return strconv.FormatInt(account.ID, 10), nil
+}
+
+// 请求 Plex API 并解析 MediaContainer
+func (plex *Plex) getMediaContainer(path string, query url.Values) (*MediaContainer, error) {
+	target := plex.GetEndpoint() + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Plex-Token", plex.GetToken())
+
+	resp, err := utils.GetHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("请求失败，HTTP 状态码: %d", resp.StatusCode)
+	}
+	return ParseMediaContainer(body)
+}
+
+// 读取媒体文件内容
+//
+// 用于读取 Strm 文件的内容，limit 为最大读取字节数
+// /library/parts/:partID/:changestamp/file.strm
+func (plex *Plex) GetPartContent(key string, limit int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, plex.GetEndpoint()+key, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Plex-Token", plex.GetToken())
+
+	resp, err := utils.GetHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("请求失败，HTTP 状态码: %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// 解析 MediaContainer
+//
+// Plex 根据请求头 Accept 返回 JSON 或 XML 格式的响应
+func ParseMediaContainer(data []byte) (*MediaContainer, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var resp Response
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, err
+		}
+		return &resp.MediaContainer, nil
+	}
+
+	var container MediaContainer
+	if err := xml.Unmarshal(data, &container); err != nil {
+		return nil, err
+	}
+	return &container, nil
+}
+
+// 获取 Plex 实例
+func New(addr string, token string) *Plex {
+	plex := &Plex{
+		endpoint: utils.GetEndpoint(addr),
+		token:    token,
+	}
+	return plex
+}
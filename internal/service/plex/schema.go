@@ -0,0 +1,68 @@
+package plex
+
+// Plex API 响应（同时支持 JSON 与 XML 两种格式）
+type Response struct {
+	MediaContainer MediaContainer `json:"MediaContainer"`
+}
+
+// MediaContainer
+//
+// Plex 的响应根节点，XML 格式下根节点即为 MediaContainer
+type MediaContainer struct {
+	Size        int64       `json:"size" xml:"size,attr"`
+	TotalSize   int64       `json:"totalSize" xml:"totalSize,attr"` // 分页请求时的条目总数
+	Metadata    []Metadata  `json:"Metadata,omitempty" xml:"-"`
+	Directories []Directory `json:"Directory,omitempty" xml:"Directory"` // 媒体库列表
+
+	// XML 格式下不同类型的条目使用不同的节点名
+	Videos []Metadata `json:"-" xml:"Video"`
+	Tracks []Metadata `json:"-" xml:"Track"`
+}
+
+// 获取所有条目（兼容 JSON 与 XML 格式）
+func (m *MediaContainer) Items() []Metadata {
+	items := make([]Metadata, 0, len(m.Metadata)+len(m.Videos)+len(m.Tracks))
+	items = append(items, m.Metadata...)
+	items = append(items, m.Videos...)
+	items = append(items, m.Tracks...)
+	return items
+}
+
+// 媒体库
+type Directory struct {
+	Key   string `json:"key" xml:"key,attr"`
+	Type  string `json:"type" xml:"type,attr"` // movie、show、artist、photo
+	Title string `json:"title" xml:"title,attr"`
+}
+
+// 媒体条目元数据
+type Metadata struct {
+	RatingKey string  `json:"ratingKey" xml:"ratingKey,attr"`
+	Key       string  `json:"key" xml:"key,attr"`
+	Type      string  `json:"type" xml:"type,attr"`
+	Title     string  `json:"title" xml:"title,attr"`
+	Media     []Media `json:"Media,omitempty" xml:"Media"`
+}
+
+// 媒体版本
+type Media struct {
+	ID        int64  `json:"id" xml:"id,attr"`
+	Container string `json:"container" xml:"container,attr"`
+	Part      []Part `json:"Part,omitempty" xml:"Part"`
+}
+
+// 媒体文件
+type Part struct {
+	ID        int64  `json:"id" xml:"id,attr"`
+	Key       string `json:"key" xml:"key,attr"`   // /library/parts/:partID/:changestamp/file.mkv
+	File      string `json:"file" xml:"file,attr"` // Plex 服务器上的文件路径
+	Size      int64  `json:"size" xml:"size,attr"`
+	Container string `json:"container" xml:"container,attr"`
+}
+
+// plex.tv 账户
+type Account struct {
+	ID       int64  `json:"id"`
+	UUID     string `json:"uuid"`
+	Username string `json:"username"`
+}
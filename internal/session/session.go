@@ -0,0 +1,281 @@
+package session
+
+import (
+	"MediaWarp/internal/config"
+	"MediaWarp/internal/metrics"
+	"MediaWarp/utils"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 播放会话
+//
+// 每个会话对应客户端的一次 Strm 播放（Emby、Jellyfin 的 PlaySessionId）
+type Session struct {
+	ID         string    `json:"id"`                    // 会话 ID（PlaySessionId）
+	User       string    `json:"user,omitempty"`        // 用户 ID，无法识别时为访问令牌的摘要
+	DeviceID   string    `json:"device_id,omitempty"`   // 设备 ID
+	Client     string    `json:"client,omitempty"`      // 客户端名称
+	DeviceName string    `json:"device_name,omitempty"` // 设备名称
+	ClientIP   string    `json:"client_ip"`             // 客户端 IP
+	Path       string    `json:"path"`                  // 媒体流请求路径
+	StrmType   string    `json:"strm_type"`             // Strm 类型
+	Mode       string    `json:"mode"`                  // 响应模式：redirect、proxy
+	Streams    int       `json:"streams"`               // 正在代理的媒体流数量
+	StartTime  time.Time `json:"start_time"`            // 开始播放的时间
+	LastActive time.Time `json:"last_active"`           // 最后一次请求媒体流或上报播放进度的时间
+}
+
+// 发起播放的客户端
+type Owner struct {
+	User       string // 用户 ID，无法识别时为访问令牌的摘要
+	DeviceID   string
+	Client     string
+	DeviceName string
+	ClientIP   string
+}
+
+// 根据请求识别发起播放的客户端
+//
+// userID 为通过访问令牌向媒体服务器查询到的用户 ID（见 ResolveUser），为空时使用访问令牌的摘要
+func NewOwner(req *http.Request, clientIP string, userID string) Owner {
+	owner := Owner{
+		DeviceID: utils.GetClientDeviceID(req),
+		ClientIP: clientIP,
+	}
+	owner.Client, owner.DeviceName = utils.GetClientInfo(req)
+
+	if userID != "" {
+		owner.User = normalizeUserID(userID)
+	} else if token := utils.GetClientToken(req); token != "" {
+		owner.User = "token:" + utils.MD5Hash(token)[:12]
+	}
+	return owner
+}
+
+// 超出同时播放数量上限
+type LimitError struct {
+	Kind  string // 用户、设备
+	Key   string
+	Limit int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s %s 同时播放数量已达上限 %d", e.Kind, e.Key, e.Limit)
+}
+
+// PlaybackInfo 返回的会话，客户端请求媒体流时使用其中记录的客户端信息
+type preparedSession struct {
+	owner  Owner
+	expire time.Time
+}
+
+var (
+	mutex    sync.Mutex
+	sessions = make(map[string]*Session)         // 会话 ID -> 会话
+	prepared = make(map[string]*preparedSession) // 会话 ID -> 客户端
+)
+
+func init() {
+	metrics.NewGaugeFunc("mediawarp_play_sessions", "当前 Strm 播放会话数量", "mode", func() map[string]float64 {
+		mutex.Lock()
+		defer mutex.Unlock()
+		sweep(time.Now())
+		result := make(map[string]float64, 2)
+		for _, session := range sessions {
+			result[session.Mode]++
+		}
+		return result
+	})
+}
+
+// 是否启用播放会话管理
+func Enabled() bool {
+	return config.Get().Session.Enable
+}
+
+// 检查客户端是否可以开始新的播放
+//
+// sessionID 对应的会话已存在时不计入数量
+func Check(owner Owner, sessionID string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	sweep(time.Now())
+	return check(owner, sessionID)
+}
+
+func check(owner Owner, sessionID string) error {
+	setting := config.Get().Session
+	var userCount, deviceCount int
+	for _, session := range sessions {
+		if session.ID == sessionID {
+			continue
+		}
+		if owner.User != "" && session.User == owner.User {
+			userCount++
+		}
+		if owner.DeviceID != "" && session.DeviceID == owner.DeviceID {
+			deviceCount++
+		}
+	}
+	if limit := userLimit(&setting, owner.User); owner.User != "" && limit > 0 && userCount >= limit {
+		return &LimitError{Kind: "用户", Key: owner.User, Limit: limit}
+	}
+	if limit := setting.MaxPerDevice; owner.DeviceID != "" && limit > 0 && deviceCount >= limit {
+		return &LimitError{Kind: "设备", Key: owner.DeviceID, Limit: limit}
+	}
+	return nil
+}
+
+// 获取用户的同时播放数量上限
+func userLimit(setting *config.SessionSetting, user string) int {
+	for userID, limit := range setting.UserLimits {
+		if normalizeUserID(userID) == user {
+			return limit
+		}
+	}
+	return setting.MaxPerUser
+}
+
+// 记录 PlaybackInfo 返回的会话
+//
+// 客户端请求媒体流时通常不携带用户 ID，使用此处记录的客户端信息识别用户
+func Prepare(sessionID string, owner Owner) {
+	if sessionID == "" {
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	prepared[sessionID] = &preparedSession{owner: owner, expire: time.Now().Add(config.SessionIdleTimeout())}
+}
+
+// 开始或继续播放
+//
+// 未携带 PlaySessionId 时使用设备 ID（或客户端 IP）和请求路径作为会话 ID；
+// 新会话超出数量上限时返回 *LimitError；
+// proxy 为 true 时会话在返回的 release 被调用之前保持活跃
+func Start(sessionID string, owner Owner, path string, strmType string, mode string, proxy bool) (func(), error) {
+	now := time.Now()
+	mutex.Lock()
+	defer mutex.Unlock()
+	sweep(now)
+
+	if sessionID == "" {
+		client := owner.DeviceID
+		if client == "" {
+			client = owner.ClientIP
+		}
+		sessionID = client + ":" + strings.ToLower(path)
+	}
+	if p, ok := prepared[sessionID]; ok {
+		owner = mergeOwner(p.owner, owner)
+	}
+
+	session, ok := sessions[sessionID]
+	if !ok {
+		if err := check(owner, sessionID); err != nil {
+			return nil, err
+		}
+		session = &Session{
+			ID:         sessionID,
+			User:       owner.User,
+			DeviceID:   owner.DeviceID,
+			Client:     owner.Client,
+			DeviceName: owner.DeviceName,
+			StartTime:  now,
+		}
+		sessions[sessionID] = session
+	}
+	session.ClientIP = owner.ClientIP
+	session.Path = path
+	session.StrmType = strmType
+	session.Mode = mode
+	session.LastActive = now
+	if !proxy {
+		return func() {}, nil
+	}
+
+	session.Streams++
+	return sync.OnceFunc(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		session.Streams--
+		session.LastActive = time.Now()
+	}), nil
+}
+
+// 合并客户端信息，优先使用 PlaybackInfo 记录的信息
+func mergeOwner(prepared Owner, current Owner) Owner {
+	// 用户 ID 优先于访问令牌的摘要
+	if current.User != "" && (prepared.User == "" || strings.HasPrefix(prepared.User, "token:") && !strings.HasPrefix(current.User, "token:")) {
+		prepared.User = current.User
+	}
+	if prepared.DeviceID == "" {
+		prepared.DeviceID = current.DeviceID
+	}
+	if prepared.Client == "" {
+		prepared.Client = current.Client
+	}
+	if prepared.DeviceName == "" {
+		prepared.DeviceName = current.DeviceName
+	}
+	prepared.ClientIP = current.ClientIP
+	return prepared
+}
+
+// 客户端上报播放进度，刷新会话的活跃时间
+func Touch(sessionID string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if session, ok := sessions[sessionID]; ok {
+		session.LastActive = time.Now()
+	}
+	if p, ok := prepared[sessionID]; ok {
+		p.expire = time.Now().Add(config.SessionIdleTimeout())
+	}
+}
+
+// 客户端停止播放，结束会话
+func Stop(sessionID string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	delete(sessions, sessionID)
+	delete(prepared, sessionID)
+}
+
+// 当前所有会话（按开始时间排序）
+func List() []Session {
+	mutex.Lock()
+	defer mutex.Unlock()
+	sweep(time.Now())
+
+	list := make([]Session, 0, len(sessions))
+	for _, session := range sessions {
+		list = append(list, *session)
+	}
+	slices.SortFunc(list, func(a, b Session) int {
+		return a.StartTime.Compare(b.StartTime)
+	})
+	return list
+}
+
+// 清理过期的会话
+//
+// 没有正在代理的媒体流并且超过 idle_timeout 未活跃的会话视为已结束
+func sweep(now time.Time) {
+	timeout := config.SessionIdleTimeout()
+	for id, session := range sessions {
+		if session.Streams <= 0 && now.Sub(session.LastActive) >= timeout {
+			delete(sessions, id)
+		}
+	}
+	for id, p := range prepared {
+		if now.After(p.expire) {
+			delete(prepared, id)
+		}
+	}
+}
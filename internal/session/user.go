@@ -0,0 +1,94 @@
+package session
+
+import (
+	"MediaWarp/internal/logging"
+	"MediaWarp/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tokenUserTTL       = 24 * time.Hour  // 访问令牌与用户 ID 对应关系的保留时间
+	tokenUserFailedTTL = 1 * time.Minute // 查询失败的访问令牌在此时间内不再重复查询
+)
+
+// 访问令牌对应的用户
+type tokenUser struct {
+	userID string // 查询失败时为空
+	expire time.Time
+}
+
+var (
+	tokenUsersMutex  sync.Mutex
+	tokenUsers       = make(map[string]*tokenUser) // 访问令牌的 MD5 -> 用户
+	tokenUsersSweep  time.Time
+	tokenUsersFlight utils.SingleFlight[string] // 合并同一访问令牌的并发查询
+)
+
+// 获取访问令牌对应的用户 ID
+//
+// 优先使用已记录的对应关系；未记录时调用 lookup 向媒体服务器查询（使用该访问令牌认证），
+// 只有查询成功时才记录对应关系，查询失败时一段时间内不再重复查询。
+// lookup 返回空字符串和 nil 表示当前请求无法确定用户，不记录结果；无法识别用户时返回空字符串
+func ResolveUser(token string, lookup func() (string, error)) string {
+	if token == "" {
+		return ""
+	}
+	key := utils.MD5Hash(token)
+	if userID, ok := cachedTokenUser(key); ok {
+		return userID
+	}
+
+	userID, err := tokenUsersFlight.Do(key, func() (string, error) {
+		userID, err := lookup()
+		switch {
+		case err != nil:
+			logging.Debugf("查询访问令牌对应的用户失败：%s", err)
+			setTokenUser(key, "", tokenUserFailedTTL)
+		case userID != "":
+			userID = normalizeUserID(userID)
+			setTokenUser(key, userID, tokenUserTTL)
+		}
+		return userID, err
+	})
+	if err != nil {
+		return ""
+	}
+	return userID
+}
+
+// 获取已记录的用户 ID
+func cachedTokenUser(key string) (string, bool) {
+	tokenUsersMutex.Lock()
+	defer tokenUsersMutex.Unlock()
+	user, ok := tokenUsers[key]
+	if !ok || time.Now().After(user.expire) {
+		return "", false
+	}
+	if user.userID != "" {
+		user.expire = time.Now().Add(tokenUserTTL)
+	}
+	return user.userID, true
+}
+
+// 记录访问令牌对应的用户 ID
+func setTokenUser(key string, userID string, ttl time.Duration) {
+	now := time.Now()
+	tokenUsersMutex.Lock()
+	defer tokenUsersMutex.Unlock()
+	if now.Sub(tokenUsersSweep) >= time.Hour {
+		tokenUsersSweep = now
+		for key, user := range tokenUsers {
+			if now.After(user.expire) {
+				delete(tokenUsers, key)
+			}
+		}
+	}
+	tokenUsers[key] = &tokenUser{userID: userID, expire: now.Add(ttl)}
+}
+
+// 统一用户 ID 格式（Jellyfin 的用户 ID 可能带有连字符）
+func normalizeUserID(userID string) string {
+	return strings.ToLower(strings.ReplaceAll(userID, "-", ""))
+}
@@ -0,0 +1,79 @@
+package strm
+
+import (
+	"MediaWarp/internal/config"
+	"MediaWarp/internal/logging"
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	schedulerMutex   sync.Mutex
+	schedulerSetting *config.StrmSyncSetting // 正在运行的定时任务使用的设置
+	schedulerCancel  context.CancelFunc
+	schedulerDone    chan struct{}
+)
+
+// 启动 Strm 定时同步
+//
+// 可以重复调用（重新加载配置时），同步设置未改变时继续使用原定时任务，否则停止原定时任务后重新启动
+func InitScheduler() {
+	schedulerMutex.Lock()
+	defer schedulerMutex.Unlock()
+	setting := config.Get().StrmSync
+	if !setting.Enable {
+		stopScheduler()
+		return
+	}
+	if schedulerSetting != nil && reflect.DeepEqual(*schedulerSetting, setting) {
+		return
+	}
+	stopScheduler()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	schedulerSetting, schedulerCancel, schedulerDone = &setting, cancel, make(chan struct{})
+	interval := config.StrmSyncInterval()
+	logging.Infof("已启动 Strm 定时同步，共 %d 个任务，同步间隔：%s", len(setting.Tasks), interval)
+	go schedule(ctx, interval, schedulerDone)
+}
+
+// 停止 Strm 定时同步，等待正在进行的同步结束
+//
+// 退出时调用
+func StopScheduler() {
+	schedulerMutex.Lock()
+	defer schedulerMutex.Unlock()
+	stopScheduler()
+}
+
+func stopScheduler() {
+	if schedulerCancel == nil {
+		return
+	}
+	schedulerCancel()
+	<-schedulerDone
+	schedulerSetting, schedulerCancel, schedulerDone = nil, nil, nil
+	logging.Info("已停止 Strm 定时同步")
+}
+
+// 启动后立即同步一次，之后每隔 interval 同步一次
+func schedule(ctx context.Context, interval time.Duration, done chan struct{}) {
+	defer close(done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			logging.Info("开始 Strm 定时同步")
+			if _, err := Sync(ctx, nil); errors.Is(err, ErrSyncRunning) {
+				logging.Warning("上一次 Strm 同步尚未完成，跳过本次定时同步")
+			}
+			timer.Reset(interval)
+		}
+	}
+}
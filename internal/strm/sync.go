@@ -0,0 +1,469 @@
+package strm
+
+import (
+	"MediaWarp/internal/config"
+	"MediaWarp/internal/logging"
+	"MediaWarp/internal/metrics"
+	"MediaWarp/internal/service"
+	"MediaWarp/internal/service/alist"
+	"MediaWarp/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	tempFilePattern = ".mediawarp-*.tmp"          // 下载附属文件时使用的临时文件
+	manifestFile    = ".mediawarp-strm-sync.json" // 同步清单，记录同步生成的文件
+)
+
+var (
+	ErrSyncRunning  = errors.New("Strm 同步正在进行中")
+	ErrTaskNotFound = errors.New("Strm 同步任务不存在")
+)
+
+var syncMutex sync.Mutex // 同一时间只运行一次同步
+
+// 同步任务的结果
+type Result struct {
+	Task     string        // 任务名称
+	Created  int64         // 新建或更新的 Strm 文件数量
+	Copied   int64         // 复制的附属文件数量
+	Skipped  int64         // 未改变的文件数量
+	Deleted  int64         // 删除的文件数量
+	Errors   int64         // 出错的目录和文件数量
+	Duration time.Duration // 耗时
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("任务 %s：新建或更新 Strm 文件 %d 个，复制附属文件 %d 个，未改变 %d 个，删除 %d 个，错误 %d 个，耗时 %s",
+		r.Task, r.Created, r.Copied, r.Skipped, r.Deleted, r.Errors, r.Duration.Round(time.Millisecond))
+}
+
+// 运行同步任务
+//
+// names 为空时运行所有任务，否则只运行指定名称的任务；任务依次运行，出错的任务不影响其他任务
+func Sync(ctx context.Context, names []string) ([]Result, error) {
+	if !syncMutex.TryLock() {
+		return nil, ErrSyncRunning
+	}
+	defer syncMutex.Unlock()
+
+	tasks := config.Get().StrmSync.Tasks
+	if len(names) > 0 {
+		selected := make([]config.StrmSyncTaskSetting, 0, len(names))
+		for _, name := range names {
+			index := slices.IndexFunc(tasks, func(task config.StrmSyncTaskSetting) bool { return task.TaskName() == name })
+			if index < 0 {
+				return nil, fmt.Errorf("%w：%s", ErrTaskNotFound, name)
+			}
+			selected = append(selected, tasks[index])
+		}
+		tasks = selected
+	}
+
+	var (
+		results = make([]Result, 0, len(tasks))
+		errs    []error
+	)
+	for _, task := range tasks {
+		result, err := syncTask(ctx, task)
+		results = append(results, result)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("任务 %s：%w", task.TaskName(), err))
+			metrics.StrmSyncRuns.Inc(task.TaskName(), "failure")
+			logging.Warningf("Strm 同步任务 %s 失败：%v", task.TaskName(), err)
+		} else {
+			metrics.StrmSyncRuns.Inc(task.TaskName(), "success")
+		}
+		logging.Info("Strm 同步完成，", result.String())
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// 单个任务的同步状态
+type syncer struct {
+	ctx         context.Context
+	task        config.StrmSyncTaskSetting
+	group       *alist.Group
+	videoExts   []string
+	sidecarExts []string
+	semaphore   chan struct{} // 限制同时请求 Alist 的数量
+	wg          sync.WaitGroup
+
+	mutex sync.Mutex
+	files map[string]string // 本地应存在的文件 -> 对应的 Alist 路径
+	err   error             // 第一个错误
+
+	created, copied, skipped, deleted, failed atomic.Int64
+}
+
+// 同步单个任务
+//
+// 遍历过程中出现任何错误时不会删除本地文件，避免 Alist 暂时不可用时误删
+func syncTask(ctx context.Context, task config.StrmSyncTaskSetting) (Result, error) {
+	startTime := time.Now()
+	s := syncer{
+		ctx:         ctx,
+		task:        task,
+		videoExts:   config.StrmSyncVideoExts(),
+		sidecarExts: config.StrmSyncSidecarExts(),
+		semaphore:   make(chan struct{}, config.StrmSyncConcurrency()),
+		files:       make(map[string]string),
+	}
+	err := s.run()
+	return Result{
+		Task:     task.TaskName(),
+		Created:  s.created.Load(),
+		Copied:   s.copied.Load(),
+		Skipped:  s.skipped.Load(),
+		Deleted:  s.deleted.Load(),
+		Errors:   s.failed.Load(),
+		Duration: time.Since(startTime),
+	}, err
+}
+
+func (s *syncer) run() error {
+	group, err := service.GetAlistGroup(s.task.Alist)
+	if err != nil {
+		return err
+	}
+	s.group = group
+	if err := os.MkdirAll(s.task.Target, os.ModePerm); err != nil {
+		return fmt.Errorf("创建本地目录失败：%w", err)
+	}
+	previous, err := s.loadManifest()
+	if err != nil {
+		return fmt.Errorf("读取同步清单失败：%w", err)
+	}
+
+	s.wg.Add(1)
+	go s.walk("")
+	s.wg.Wait()
+
+	var stale []string // 清单中记录但本次未同步的文件
+	for _, localPath := range previous {
+		if _, ok := s.files[localPath]; !ok {
+			stale = append(stale, localPath)
+		}
+	}
+	err = s.walkError()
+	if err == nil && config.Get().StrmSync.Delete {
+		stale, err = s.clean(stale)
+	}
+	// 未删除的文件仍然保留在清单中，之后可以删除
+	if saveErr := s.saveManifest(stale); saveErr != nil {
+		err = errors.Join(err, fmt.Errorf("保存同步清单失败：%w", saveErr))
+	}
+	return err
+}
+
+// 遍历过程中的错误
+func (s *syncer) walkError() error {
+	if s.err != nil {
+		if s.failed.Load() > 1 {
+			return fmt.Errorf("%w（共 %d 个错误）", s.err, s.failed.Load())
+		}
+		return s.err
+	}
+	return s.ctx.Err()
+}
+
+// 记录错误
+func (s *syncer) fail(format string, args ...any) {
+	err := fmt.Errorf(format, args...)
+	s.failed.Add(1)
+	logging.Warningf("Strm 同步任务 %s：%v", s.task.TaskName(), err)
+	s.mutex.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mutex.Unlock()
+}
+
+// 占用一个并发数量，Context 取消时返回 false
+func (s *syncer) acquire() bool {
+	select {
+	case s.semaphore <- struct{}{}:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+func (s *syncer) release() {
+	<-s.semaphore
+}
+
+// 本地文件路径，rel 为相对于 source 的 Alist 路径
+func (s *syncer) localPath(rel string) string {
+	return filepath.Join(s.task.Target, filepath.FromSlash(rel))
+}
+
+// 记录本地应存在的文件，多个 Alist 文件对应同一个本地文件时返回 false
+func (s *syncer) expect(localPath string, alistPath string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if existing, ok := s.files[localPath]; ok {
+		logging.Warningf("Strm 同步任务 %s：%s 与 %s 对应同一个本地文件 %s，忽略后者", s.task.TaskName(), existing, alistPath, localPath)
+		return false
+	}
+	s.files[localPath] = alistPath
+	return true
+}
+
+// 遍历 Alist 目录，rel 为相对于 source 的路径
+func (s *syncer) walk(rel string) {
+	defer s.wg.Done()
+	if !s.acquire() {
+		return
+	}
+	alistPath := path.Join(s.task.Source, rel)
+	objects, err := s.group.FsListAll(alistPath)
+	s.release()
+	if err != nil {
+		s.fail("获取目录 %s 内容失败：%w", alistPath, err)
+		return
+	}
+
+	for _, object := range objects {
+		objectRel := path.Join(rel, object.Name)
+		if object.IsDir {
+			s.wg.Add(1)
+			go s.walk(objectRel)
+			continue
+		}
+		ext := strings.ToLower(strings.TrimPrefix(path.Ext(object.Name), "."))
+		switch {
+		case slices.Contains(s.videoExts, ext):
+			s.writeStrm(objectRel)
+		case slices.Contains(s.sidecarExts, ext):
+			s.wg.Add(1)
+			go s.copySidecar(objectRel, object)
+		}
+	}
+}
+
+// 生成 Strm 文件，内容为视频文件的 Alist 路径
+func (s *syncer) writeStrm(rel string) {
+	alistPath := path.Join(s.task.Source, rel)
+	localPath := s.localPath(strings.TrimSuffix(rel, path.Ext(rel)) + ".strm")
+	if !s.expect(localPath, alistPath) {
+		return
+	}
+	if content, err := os.ReadFile(localPath); err == nil && string(content) == alistPath {
+		s.skipped.Add(1)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), os.ModePerm); err != nil {
+		s.fail("创建目录失败：%w", err)
+		return
+	}
+	if err := os.WriteFile(localPath, []byte(alistPath), 0o644); err != nil {
+		s.fail("写入 Strm 文件失败：%w", err)
+		return
+	}
+	s.created.Add(1)
+	metrics.StrmSyncFiles.Inc(s.task.TaskName(), "created")
+	logging.Debugf("Strm 同步任务 %s：已生成 %s", s.task.TaskName(), localPath)
+}
+
+// 复制附属文件
+//
+// 本地文件的大小和修改时间与 Alist 中一致时跳过
+func (s *syncer) copySidecar(rel string, object alist.FsObject) {
+	defer s.wg.Done()
+	alistPath := path.Join(s.task.Source, rel)
+	localPath := s.localPath(rel)
+	if !s.expect(localPath, alistPath) {
+		return
+	}
+	modified, _ := time.Parse(time.RFC3339, object.Modified)
+	if info, err := os.Stat(localPath); err == nil && info.Size() == object.Size && (modified.IsZero() || info.ModTime().Equal(modified)) {
+		s.skipped.Add(1)
+		return
+	}
+
+	if !s.acquire() {
+		return
+	}
+	err := s.download(alistPath, localPath, modified)
+	s.release()
+	if err != nil {
+		s.fail("复制附属文件 %s 失败：%w", alistPath, err)
+		return
+	}
+	s.copied.Add(1)
+	metrics.StrmSyncFiles.Inc(s.task.TaskName(), "copied")
+	logging.Debugf("Strm 同步任务 %s：已复制 %s", s.task.TaskName(), localPath)
+}
+
+// 下载文件，先写入临时文件，下载完成后替换本地文件
+func (s *syncer) download(alistPath string, localPath string, modified time.Time) error {
+	fileURL, err := s.group.GetFileURL(alistPath, false)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := utils.GetStreamHTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP 状态码 %d", resp.StatusCode)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localPath), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(localPath), tempFilePattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // 重命名成功后删除会失败，可以忽略
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0o644); err != nil {
+		return err
+	}
+	if !modified.IsZero() {
+		if err := os.Chtimes(file.Name(), modified, modified); err != nil {
+			return err
+		}
+	}
+	return os.Rename(file.Name(), localPath)
+}
+
+// 读取同步清单，返回上次同步生成的本地文件
+//
+// 清单不存在时（首次同步）返回空列表，忽略不在本地目录中的路径
+func (s *syncer) loadManifest() ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(s.task.Target, manifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, err
+	}
+	localPaths := make([]string, 0, len(files))
+	for _, rel := range files {
+		if !filepath.IsLocal(filepath.FromSlash(rel)) {
+			logging.Warningf("Strm 同步任务 %s：忽略同步清单中的无效路径 %s", s.task.TaskName(), rel)
+			continue
+		}
+		localPaths = append(localPaths, s.localPath(rel))
+	}
+	return localPaths, nil
+}
+
+// 保存同步清单，记录本次同步的文件和 extra 中的文件
+//
+// 先写入临时文件，写入完成后替换原清单
+func (s *syncer) saveManifest(extra []string) error {
+	files := make([]string, 0, len(s.files)+len(extra))
+	for _, localPath := range append(slices.Collect(maps.Keys(s.files)), extra...) {
+		rel, err := filepath.Rel(s.task.Target, localPath)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+	}
+	slices.Sort(files)
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(s.task.Target, tempFilePattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // 重命名成功后删除会失败，可以忽略
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filepath.Join(s.task.Target, manifestFile))
+}
+
+// 删除 Alist 中已不存在的文件
+//
+// 只删除同步清单中记录的文件（媒体服务器生成的 NFO、海报等文件不受影响）和残留的临时文件，
+// 删除文件后清理空目录。返回删除失败的文件
+func (s *syncer) clean(stale []string) ([]string, error) {
+	var (
+		remain []string
+		errs   []error
+		dirs   = make(map[string]struct{})
+	)
+	for _, localPath := range stale {
+		if err := os.Remove(localPath); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				remain = append(remain, localPath)
+				errs = append(errs, err)
+			}
+			continue
+		}
+		dirs[filepath.Dir(localPath)] = struct{}{}
+		s.deleted.Add(1)
+		metrics.StrmSyncFiles.Inc(s.task.TaskName(), "deleted")
+		logging.Debugf("Strm 同步任务 %s：已删除 %s", s.task.TaskName(), localPath)
+	}
+
+	err := filepath.WalkDir(s.task.Target, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if matched, _ := filepath.Match(tempFilePattern, entry.Name()); matched && !entry.IsDir() {
+			return os.Remove(p)
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// 从删除文件所在的目录开始逐级向上删除，只能删除空目录
+	target := filepath.Clean(s.task.Target)
+	for dir := range dirs {
+		for dir != target && os.Remove(dir) == nil {
+			dir = filepath.Dir(dir)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return remain, fmt.Errorf("删除本地文件失败：%w", err)
+	}
+	return remain, nil
+}
@@ -0,0 +1,222 @@
+package strm
+
+import (
+	"MediaWarp/internal/config"
+	"MediaWarp/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 模拟的 Alist 服务器，files 为文件路径 -> 文件内容
+type fakeAlist struct {
+	mutex  sync.Mutex
+	files  map[string]string
+	broken string // 获取该目录内容时返回错误
+}
+
+func (f *fakeAlist) setFiles(files map[string]string, broken string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.files = files
+	f.broken = broken
+}
+
+// 目录中的文件和子目录
+func (f *fakeAlist) list(dir string) ([]map[string]any, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if dir == f.broken {
+		return nil, false
+	}
+	var (
+		objects []map[string]any
+		dirs    = make(map[string]bool)
+	)
+	for p, content := range f.files {
+		rest, ok := strings.CutPrefix(p, dir+"/")
+		if !ok {
+			continue
+		}
+		if name, _, isDir := strings.Cut(rest, "/"); isDir {
+			if !dirs[name] {
+				dirs[name] = true
+				objects = append(objects, map[string]any{"name": name, "is_dir": true})
+			}
+			continue
+		}
+		objects = append(objects, map[string]any{"name": rest, "size": len(content), "modified": "2024-01-01T00:00:00Z"})
+	}
+	return objects, len(objects) > 0
+}
+
+func (f *fakeAlist) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p, ok := strings.CutPrefix(r.URL.Path, "/d"); ok {
+		f.mutex.Lock()
+		content, exist := f.files[p]
+		f.mutex.Unlock()
+		if !exist {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+		return
+	}
+
+	var body struct {
+		Path string `json:"path"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	var data any
+	switch r.URL.Path {
+	case "/api/auth/login":
+		data = map[string]any{"token": "token"}
+	case "/api/me":
+		data = map[string]any{"username": "admin"}
+	case "/api/fs/get":
+		data = map[string]any{"name": path.Base(body.Path)}
+	case "/api/fs/list":
+		objects, ok := f.list(body.Path)
+		if !ok {
+			json.NewEncoder(w).Encode(map[string]any{"code": 500, "message": "object not found"})
+			return
+		}
+		data = map[string]any{"content": objects, "total": len(objects)}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"code": 200, "message": "success", "data": data})
+}
+
+func TestSyncTask(t *testing.T) {
+	alist := &fakeAlist{}
+	server := httptest.NewServer(alist)
+	defer server.Close()
+
+	target := t.TempDir()
+	task := config.StrmSyncTaskSetting{Alist: server.URL, Source: "/media", Target: target}
+	setting := &config.Setting{
+		AlistStrm: config.AlistStrmSetting{Enable: true, List: []config.AlistSetting{{ADDR: server.URL, Username: "admin", Password: "password"}}},
+		StrmSync:  config.StrmSyncSetting{Delete: true, Tasks: []config.StrmSyncTaskSetting{task}},
+	}
+	service.InitAlistClient(setting)
+	old := config.Swap(setting)
+	defer func() {
+		config.Swap(old)
+		service.InitAlistClient(config.Get())
+	}()
+
+	// 媒体服务器生成或用户创建的文件，不应被同步修改或删除
+	keep := map[string]string{
+		"Movie/fanart.jpg": "fanart",
+		"Show/tvshow.nfo":  "tvshow",
+		"Other.strm":       "/other/Other.mkv",
+	}
+	for rel, content := range keep {
+		localPath := filepath.Join(target, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(localPath), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(localPath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name    string
+		files   map[string]string // Alist 中的文件
+		broken  string
+		wantErr bool
+		exist   map[string]string // 本地应存在的文件 -> 文件内容
+		missing []string          // 本地不应存在的文件或目录
+	}{
+		{
+			name: "首次同步",
+			files: map[string]string{
+				"/media/Movie/Movie.mkv":         "video",
+				"/media/Movie/Movie.nfo":         "movie",
+				"/media/Show/S01E01.mkv":         "video",
+				"/media/Show/S01E01.srt":         "subtitle",
+				"/media/Extra/Extra.mkv":         "video",
+				"/media/Extra/Poster/Poster.jpg": "poster",
+				"/media/readme.txt":              "readme",
+			},
+			exist: map[string]string{
+				"Movie/Movie.strm":        "/media/Movie/Movie.mkv",
+				"Movie/Movie.nfo":         "movie",
+				"Show/S01E01.strm":        "/media/Show/S01E01.mkv",
+				"Show/S01E01.srt":         "subtitle",
+				"Extra/Extra.strm":        "/media/Extra/Extra.mkv",
+				"Extra/Poster/Poster.jpg": "poster",
+			},
+			missing: []string{"readme.txt"},
+		},
+		{
+			name: "遍历出错时不删除文件",
+			files: map[string]string{
+				"/media/Movie/Movie.mkv": "video",
+				"/media/Show/S01E01.mkv": "video",
+			},
+			broken:  "/media/Show",
+			wantErr: true,
+			exist: map[string]string{
+				"Movie/Movie.nfo":         "movie",
+				"Show/S01E01.srt":         "subtitle",
+				"Extra/Extra.strm":        "/media/Extra/Extra.mkv",
+				"Extra/Poster/Poster.jpg": "poster",
+			},
+		},
+		{
+			name: "删除 Alist 中已不存在的文件",
+			files: map[string]string{
+				"/media/Movie/Movie.mkv": "video",
+				"/media/Show/S01E01.mkv": "video",
+			},
+			exist: map[string]string{
+				"Movie/Movie.strm": "/media/Movie/Movie.mkv",
+				"Show/S01E01.strm": "/media/Show/S01E01.mkv",
+			},
+			missing: []string{"Movie/Movie.nfo", "Show/S01E01.srt", "Extra"},
+		},
+	}
+	for _, step := range steps {
+		alist.setFiles(step.files, step.broken)
+		result, err := syncTask(context.Background(), task)
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s：同步结果错误，期望出错：%t，实际：%v", step.name, step.wantErr, err)
+		}
+
+		for rel, want := range step.exist {
+			content, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(rel)))
+			if err != nil {
+				t.Errorf("%s：读取文件 %s 失败：%s", step.name, rel, err)
+			} else if string(content) != want {
+				t.Errorf("%s：文件 %s 内容错误，期望：%s，实际：%s", step.name, rel, want, content)
+			}
+		}
+		for rel, want := range keep {
+			if content, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(rel))); err != nil || string(content) != want {
+				t.Errorf("%s：不是同步生成的文件 %s 不应被修改或删除", step.name, rel)
+			}
+		}
+		for _, rel := range step.missing {
+			if _, err := os.Stat(filepath.Join(target, filepath.FromSlash(rel))); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s：%s 不应存在", step.name, rel)
+			}
+		}
+		if matches, _ := filepath.Glob(filepath.Join(target, tempFilePattern)); len(matches) > 0 {
+			t.Errorf("%s：残留临时文件：%v", step.name, matches)
+		}
+		t.Logf("%s：%s", step.name, result.String())
+	}
+}
@@ -2,17 +2,23 @@ package main
 
 import (
 	"MediaWarp/constants"
+	"MediaWarp/internal/cache"
 	"MediaWarp/internal/config"
 	"MediaWarp/internal/handler"
 	"MediaWarp/internal/logging"
 	"MediaWarp/internal/router"
+	"MediaWarp/internal/server"
 	"MediaWarp/internal/service"
+	"MediaWarp/internal/strm"
 	"MediaWarp/utils"
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"reflect"
 	"syscall"
+	"time"
 
 	"encoding/json"
 
@@ -20,9 +26,13 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const configWatchInterval = 5 * time.Second // 配置文件检查间隔
+
 var (
 	isDebug     bool   // 开启调试模式
 	showVersion bool   // 显示版本信息
+	checkConfig bool   // 检查配置文件
+	strmSync    bool   // 运行 Strm 同步任务后退出
 	configPath  string // 配置文件路径
 )
 
@@ -31,8 +41,16 @@ func init() {
 
 	flag.BoolVar(&showVersion, "version", false, "显示版本信息")
 	flag.BoolVar(&isDebug, "debug", false, "是否启用调试模式")
+	flag.BoolVar(&checkConfig, "check", false, "检查配置文件后退出")
 	flag.StringVar(&configPath, "config", "config/config.yaml", "指定配置文件路径")
 	flag.Parse()
+	if flag.Arg(0) == "check-config" { // mediawarp check-config [--config path]
+		checkConfig = true
+		flag.CommandLine.Parse(flag.Args()[1:])
+	} else if flag.Arg(0) == "strm" && flag.Arg(1) == "sync" { // mediawarp strm sync [--config path] [任务名称...]
+		strmSync = true
+		flag.CommandLine.Parse(flag.Args()[2:])
+	}
 
 	fmt.Print(constants.LOGO)
 	fmt.Println(utils.Center(fmt.Sprintf(" MediaWarp %s ", config.Version().AppVersion), 71, "="))
@@ -45,42 +63,179 @@ func main() {
 		return
 	}
 
+	if checkConfig {
+		if err := config.Check(configPath); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("配置文件 %s 检查通过\n", configPath)
+		return
+	}
+
 	if isDebug {
 		logging.SetLevel(logrus.DebugLevel)
 		logging.Info("已启用调试模式")
 	}
 
+	if strmSync {
+		os.Exit(runStrmSync(flag.Args()))
+	}
+
 	signChan := make(chan os.Signal, 1)
+	reloadChan := make(chan os.Signal, 1)
 	errChan := make(chan error, 1)
 	signal.Notify(signChan, syscall.SIGINT, syscall.SIGTERM)
-	defer func() {
-		logging.Info("MediaWarp 已退出")
-	}()
+	signal.Notify(reloadChan, syscall.SIGHUP)
 
 	if err := config.Init(configPath); err != nil { // 初始化配置
 		panic("配置初始化失败: " + err.Error())
 	}
+	cfg := config.Get()
 
-	logging.Init()                                                                           // 初始化日志
-	logging.Infof("上游媒体服务器类型：%s，服务器地址：%s", config.MediaServer.Type, config.MediaServer.ADDR) // 日志打印
-	service.InitAlistClient()                                                                // 初始化Alist服务器
-	if err := handler.Init(); err != nil {                                                   // 初始化媒体服务器处理器
+	logging.Init()                                                                     // 初始化日志
+	logging.Infof("上游媒体服务器类型：%s，服务器地址：%s", cfg.MediaServer.Type, cfg.MediaServer.ADDR) // 日志打印
+	service.InitAlistClient(cfg)                                                       // 初始化Alist服务器
+	if err := handler.Init(); err != nil {                                             // 初始化媒体服务器处理器
 		panic("媒体服务器处理器初始化失败: " + err.Error())
 	}
 
-	logging.Info("MediaWarp 监听端口：", config.Port)
-	ginR := router.InitRouter() // 路由初始化
+	engine, err := router.InitRouter(cfg, handler.GetMediaServer()) // 路由初始化
+	if err != nil {
+		panic("路由初始化失败: " + err.Error())
+	}
+	router.SetEngine(engine)
+
+	baseCtx, cancelBase := context.WithCancel(context.Background()) // 所有请求的父 Context，取消后强制结束仍在处理的请求
+	defer cancelBase()
+	srv, err := server.New(router.Handler(), baseCtx)
+	if err != nil {
+		panic("HTTP 服务器初始化失败: " + err.Error())
+	}
+	srv.Serve(errChan)
 	logging.Info("MediaWarp 启动成功")
-	go func() {
-		if err := ginR.Run(config.ListenAddr()); err != nil {
-			errChan <- err
+
+	strm.InitScheduler() // 启动 Strm 定时同步
+
+	go config.Watch(baseCtx, configPath, configWatchInterval, func() {
+		logging.Info("检测到配置文件变化，重新加载配置")
+		reloadChan <- syscall.SIGHUP
+	})
+
+	for {
+		select {
+		case sig := <-signChan:
+			logging.Info("MediaWarp 正在退出，信号：", sig)
+			shutdown(srv, cancelBase)
+			return
+		case err := <-errChan:
+			logging.Error("MediaWarp 运行出错：", err)
+			shutdown(srv, cancelBase)
+			return
+		case <-reloadChan:
+			if err := reload(); err != nil {
+				logging.Warning("重新加载配置失败，继续使用原配置：", err)
+			} else {
+				logging.Info("重新加载配置成功")
+			}
 		}
-	}()
+	}
+}
 
-	select {
-	case sig := <-signChan:
-		logging.Info("MediaWarp 正在退出，信号：", sig)
-	case err := <-errChan:
-		logging.Error("MediaWarp 运行出错：", err)
+// 优雅退出
+//
+// 停止接收新连接并等待活动请求（包括代理中的媒体流和 WebSocket 会话）完成，
+// 超时后强制断开；随后依次关闭缓存池、Alist 客户端和日志文件
+func shutdown(srv *server.Server, cancelBase context.CancelFunc) {
+	timeout := config.ShutdownTimeout()
+	logging.Infof("停止接收新连接，等待 %d 个活动请求完成（最长等待 %s）", router.ActiveRequests(), timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if err == nil {
+		err = router.WaitIdle(ctx)
+	}
+	if err != nil {
+		logging.Warningf("等待超时，强制断开 %d 个活动请求", router.ActiveRequests())
+		cancelBase()
+		srv.Close()
+		forceCtx, forceCancel := context.WithTimeout(context.Background(), time.Second)
+		router.WaitIdle(forceCtx)
+		forceCancel()
+	} else {
+		logging.Info("所有活动请求已完成")
+	}
+
+	logging.Info("停止 Strm 定时同步")
+	strm.StopScheduler()
+	logging.Info("关闭缓存")
+	cache.CloseAll()
+	logging.Info("关闭 Alist 客户端")
+	service.CloseAlistClients()
+	utils.CloseIdleConnections()
+	logging.Info("MediaWarp 已退出")
+	logging.Close()
+}
+
+// 重新加载配置
+//
+// 使用新配置创建媒体服务器处理器和路由引擎，全部创建成功后才替换配置，否则保留原配置；
+// Alist 节点组在替换配置前按新配置创建，替换后的请求不会使用按原配置创建的节点组；
+// 正在处理的请求继续使用原路由引擎，新的请求使用新的路由引擎
+func reload() error {
+	setting, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	mediaServerHandler, err := handler.New(setting)
+	if err != nil {
+		return fmt.Errorf("媒体服务器处理器初始化失败: %w", err)
+	}
+	engine, err := router.InitRouter(setting, mediaServerHandler)
+	if err != nil {
+		return fmt.Errorf("路由初始化失败: %w", err)
+	}
+
+	service.InitAlistClient(setting)
+	oldSetting := config.Swap(setting)
+	if setting.Port != oldSetting.Port || !reflect.DeepEqual(setting.ListenList, oldSetting.ListenList) {
+		logging.Warning("监听地址已修改，需要重启 MediaWarp 后生效")
+	}
+
+	logging.Init()
+	handler.SetMediaServer(mediaServerHandler)
+	router.SetEngine(engine)
+	strm.InitScheduler()
+	return nil
+}
+
+// 运行 Strm 同步任务，返回退出码
+//
+// names 为空时运行配置文件中的所有任务，收到 SIGINT、SIGTERM 时停止同步
+func runStrmSync(names []string) int {
+	if err := config.Init(configPath); err != nil {
+		fmt.Println("配置初始化失败:", err)
+		return 1
+	}
+	logging.Init()
+	defer logging.Close()
+	if len(config.Get().StrmSync.Tasks) == 0 {
+		fmt.Println("配置文件中没有 Strm 同步任务（strm_sync.tasks）")
+		return 1
+	}
+	service.InitAlistClient(config.Get())
+	defer service.CloseAlistClients()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	results, err := strm.Sync(ctx, names)
+	for _, result := range results {
+		fmt.Println(result.String())
+	}
+	if err != nil {
+		fmt.Println("Strm 同步失败:", err)
+		return 1
 	}
+	return 0
 }
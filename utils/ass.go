@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// ASS 字幕中使用的字体
+type ASSFont struct {
+	Name   string // 字体名称（小写，去除竖排前缀 @）
+	Bold   bool   // 是否粗体
+	Italic bool   // 是否斜体
+}
+
+// ASS 样式中与字体有关的字段
+type assStyle struct {
+	font   string
+	bold   bool
+	italic bool
+}
+
+// 判断字幕是否为 ASS / SSA 格式
+func IsASS(content []byte) bool {
+	return bytes.Contains(content, []byte("[Script Info]")) && bytes.Contains(content, []byte("[Events]"))
+}
+
+// 统计 ASS 字幕中每个字体使用到的字符
+//
+// 会解析样式表以及对话中的 \fn、\b、\i、\r 覆盖标签，忽略绘图模式（\p）中的内容
+func CollectASSFontGlyphs(content []byte) map[ASSFont]SetInterface[rune] {
+	var (
+		section      string
+		styleFormat  []string
+		eventFormat  []string
+		styles       = make(map[string]assStyle)
+		defaultStyle *assStyle
+		result       = make(map[ASSFont]SetInterface[rune])
+	)
+
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")) // 去除 UTF-8 BOM
+	for _, rawLine := range strings.Split(string(content), "\n") {
+		line := strings.TrimSpace(rawLine)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(line)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch section {
+		case "[v4+ styles]", "[v4 styles]":
+			switch key {
+			case "format":
+				styleFormat = splitASSFields(value, -1)
+			case "style":
+				fields := splitASSFields(value, len(styleFormat))
+				name, style := parseASSStyle(styleFormat, fields)
+				styles[name] = style
+				if defaultStyle == nil || strings.EqualFold(name, "Default") {
+					defaultStyle = &style
+				}
+			}
+
+		case "[events]":
+			switch key {
+			case "format":
+				eventFormat = splitASSFields(value, -1)
+			case "dialogue":
+				fields := splitASSFields(value, len(eventFormat))
+				styleIndex := FindStringIndex(eventFormat, "Style", true, true)
+				textIndex := FindStringIndex(eventFormat, "Text", true, true)
+				if textIndex < 0 || textIndex >= len(fields) {
+					continue
+				}
+				var style assStyle
+				if styleIndex >= 0 && styleIndex < len(fields) {
+					if s, ok := styles[strings.TrimPrefix(fields[styleIndex], "*")]; ok {
+						style = s
+					} else if defaultStyle != nil {
+						style = *defaultStyle
+					}
+				} else if defaultStyle != nil {
+					style = *defaultStyle
+				}
+				collectASSText(fields[textIndex], style, styles, result)
+			}
+		}
+	}
+	return result
+}
+
+// 按逗号分割 ASS 字段
+//
+// n 为字段数量，最后一个字段保留其中的逗号；n < 0 时不限制数量
+func splitASSFields(value string, n int) []string {
+	var fields []string
+	if n <= 0 {
+		fields = strings.Split(value, ",")
+	} else {
+		fields = strings.SplitN(value, ",", n)
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+// 解析 ASS 样式行
+func parseASSStyle(format []string, fields []string) (string, assStyle) {
+	var (
+		name  string
+		style assStyle
+	)
+	for i, field := range format {
+		if i >= len(fields) {
+			break
+		}
+		switch strings.ToLower(field) {
+		case "name":
+			name = strings.TrimPrefix(fields[i], "*")
+		case "fontname":
+			style.font = fields[i]
+		case "bold":
+			style.bold = parseASSBool(fields[i])
+		case "italic":
+			style.italic = parseASSBool(fields[i])
+		}
+	}
+	return name, style
+}
+
+// 解析 ASS 中的布尔值 / 字重
+//
+// 样式中 -1 表示真；覆盖标签中 1 或者 >= 700 的字重表示粗体
+func parseASSBool(value string) bool {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+	return n == -1 || n == 1 || n >= 700
+}
+
+// 统计一行对话文本中每个字体使用到的字符
+func collectASSText(text string, style assStyle, styles map[string]assStyle, result map[ASSFont]SetInterface[rune]) {
+	var (
+		current = style
+		drawing = false
+		runes   = []rune(text)
+	)
+
+	add := func(r rune) {
+		if drawing || current.font == "" {
+			return
+		}
+		font := ASSFont{
+			Name:   strings.ToLower(strings.TrimPrefix(current.font, "@")),
+			Bold:   current.bold,
+			Italic: current.italic,
+		}
+		if _, ok := result[font]; !ok {
+			result[font] = NewSet[rune]()
+		}
+		result[font].Add(r)
+	}
+
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '{': // 覆盖标签块
+			end := i + 1
+			for end < len(runes) && runes[end] != '}' {
+				end++
+			}
+			for _, tag := range strings.Split(string(runes[i+1:min(end, len(runes))]), `\`) {
+				tag = strings.TrimSpace(tag)
+				switch {
+				case strings.HasPrefix(tag, "fn"):
+					if name := strings.TrimSpace(tag[2:]); name != "" {
+						current.font = name
+					} else {
+						current.font = style.font
+					}
+				case strings.HasPrefix(tag, "r"):
+					if s, ok := styles[strings.TrimSpace(tag[1:])]; ok {
+						current = s
+					} else {
+						current = style
+					}
+				case strings.HasPrefix(tag, "blur"), strings.HasPrefix(tag, "be"), strings.HasPrefix(tag, "bord"):
+				case strings.HasPrefix(tag, "b"):
+					current.bold = parseASSBool(tag[1:])
+				case strings.HasPrefix(tag, "iclip"):
+				case strings.HasPrefix(tag, "i"):
+					current.italic = parseASSBool(tag[1:])
+				case strings.HasPrefix(tag, "pos"), strings.HasPrefix(tag, "pbo"):
+				case strings.HasPrefix(tag, "p"):
+					n, _ := strconv.Atoi(strings.TrimSpace(tag[1:]))
+					drawing = n > 0
+				}
+			}
+			i = end
+
+		case '\\': // 转义字符
+			if i+1 < len(runes) {
+				switch runes[i+1] {
+				case 'N', 'n':
+					i++
+					continue
+				case 'h':
+					add(' ')
+					i++
+					continue
+				}
+			}
+			add(r)
+
+		default:
+			add(r)
+		}
+	}
+}
+
+// 对字体文件进行 ASS 的 UUEncode 编码
+//
+// 每 3 个字节编码为 4 个字符（每 6 位加上 33），每行 80 个字符
+func ASSUUEncode(data []byte) string {
+	var (
+		encoded strings.Builder
+		line    = 0
+	)
+	encoded.Grow(len(data)*4/3 + len(data)/60 + 4)
+
+	write := func(c byte) {
+		encoded.WriteByte(c + 33)
+		line++
+		if line == 80 {
+			encoded.WriteByte('\n')
+			line = 0
+		}
+	}
+
+	for i := 0; i < len(data); i += 3 {
+		var chunk [3]byte
+		n := copy(chunk[:], data[i:])
+		write(chunk[0] >> 2)
+		write((chunk[0]&0x3)<<4 | chunk[1]>>4)
+		if n > 1 {
+			write((chunk[1]&0xf)<<2 | chunk[2]>>6)
+		}
+		if n > 2 {
+			write(chunk[2] & 0x3f)
+		}
+	}
+	return strings.TrimSuffix(encoded.String(), "\n")
+}
+
+// 将字体嵌入 ASS 字幕的 [Fonts] 部分
+//
+// fonts: 字体文件名 -> 字体文件内容
+func EmbedASSFonts(content []byte, fonts map[string][]byte) []byte {
+	if len(fonts) == 0 {
+		return content
+	}
+
+	names := make([]string, 0, len(fonts))
+	for name := range fonts {
+		names = append(names, name)
+	}
+	sortSlice(names)
+
+	var section bytes.Buffer
+	for _, name := range names {
+		section.WriteString("fontname: " + name + "\n")
+		section.WriteString(ASSUUEncode(fonts[name]))
+		section.WriteString("\n")
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		if strings.EqualFold(strings.TrimSpace(line), "[Fonts]") { // 已存在 [Fonts] 部分，追加到该部分开头
+			return []byte(strings.Join(lines[:i+1], "\n") + "\n" + section.String() + strings.Join(lines[i+1:], "\n"))
+		}
+	}
+	for i, line := range lines {
+		if strings.EqualFold(strings.TrimSpace(line), "[Events]") { // 在 [Events] 部分之前插入
+			return []byte(strings.Join(lines[:i], "\n") + "\n[Fonts]\n" + section.String() + "\n" + strings.Join(lines[i:], "\n"))
+		}
+	}
+	return []byte(string(content) + "\n[Fonts]\n" + section.String())
+}
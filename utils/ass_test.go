@@ -0,0 +1,97 @@
+package utils_test
+
+import (
+	"MediaWarp/utils"
+	"strings"
+	"testing"
+)
+
+var assSubtitle = `[Script Info]
+ScriptType: v4.00+
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Default,方正准圆_GBK,20,&H00FFFFFF,&H00FFFFFF,&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,1,0,2,10,10,10,1
+Style: Title,@Source Han Sans,20,&H00FFFFFF,&H00FFFFFF,&H00000000,&H00000000,-1,0,0,0,100,100,0,0,1,1,0,2,10,10,10,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,你好\N世界
+Dialogue: 0,0:00:02.00,0:00:03.00,Title,,0,0,0,,{\fad(200,200)}AB{\i1}C
+Dialogue: 0,0:00:03.00,0:00:04.00,Default,,0,0,0,,{\fnArial\b1}x,y{\r}好{\p1}m 0 0 l 10 10{\p0}
+`
+
+func TestCollectASSFontGlyphs(t *testing.T) {
+	type TestCase struct {
+		Font  utils.ASSFont
+		Runes string
+	}
+	testCases := map[string]TestCase{
+		"样式字体": {
+			utils.ASSFont{Name: "方正准圆_gbk"},
+			"你好世界",
+		},
+		"竖排粗体字体": {
+			utils.ASSFont{Name: "source han sans", Bold: true},
+			"AB",
+		},
+		"斜体覆盖标签": {
+			utils.ASSFont{Name: "source han sans", Bold: true, Italic: true},
+			"C",
+		},
+		"字体覆盖标签": {
+			utils.ASSFont{Name: "arial", Bold: true},
+			"x,y",
+		},
+	}
+
+	result := utils.CollectASSFontGlyphs([]byte(assSubtitle))
+	if len(result) != len(testCases) {
+		t.Errorf("字体数量错误。期望: %d, 实际: %d", len(testCases), len(result))
+	}
+	for caseName, testCase := range testCases {
+		t.Run(caseName, func(t *testing.T) {
+			glyphs, ok := result[testCase.Font]
+			if !ok {
+				t.Fatalf("%s 未找到字体：%+v", caseName, testCase.Font)
+			}
+			expected := utils.NewSet[rune]()
+			expected.Adds([]rune(testCase.Runes)...)
+			if !glyphs.Equal(expected) {
+				t.Errorf("%s 字符错误。期望: %q, 实际: %q", caseName, expected.Values(), glyphs.Values())
+			}
+		})
+	}
+}
+
+func TestASSUUEncode(t *testing.T) {
+	testCases := map[string][2]string{
+		"3 字节": {"\x00\x00\x00", "!!!!"},
+		"2 字节": {"\xff\xff", "``]"},
+		"1 字节": {"A", "11"},
+		"空字节串": {"", ""},
+	}
+	for caseName, testCase := range testCases {
+		t.Run(caseName, func(t *testing.T) {
+			if result := utils.ASSUUEncode([]byte(testCase[0])); result != testCase[1] {
+				t.Errorf("%s 编码错误。期望: %q, 实际: %q", caseName, testCase[1], result)
+			}
+		})
+	}
+
+	encoded := utils.ASSUUEncode(make([]byte, 120))
+	for _, line := range strings.Split(encoded, "\n") {
+		if len(line) > 80 {
+			t.Errorf("编码后每行长度不能超过 80 个字符，实际: %d", len(line))
+		}
+	}
+}
+
+func TestEmbedASSFonts(t *testing.T) {
+	result := string(utils.EmbedASSFonts([]byte(assSubtitle), map[string][]byte{"arial_0.ttf": []byte("\x00\x00\x00")}))
+	fontsIndex := strings.Index(result, "[Fonts]\nfontname: arial_0.ttf\n!!!!\n")
+	eventsIndex := strings.Index(result, "[Events]")
+	if fontsIndex < 0 || fontsIndex > eventsIndex {
+		t.Errorf("[Fonts] 部分应位于 [Events] 之前：\n%s", result)
+	}
+}
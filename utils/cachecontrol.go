@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 根据响应头计算响应的新鲜期
+//
+// 依次使用 Cache-Control 的 no-cache、s-maxage、max-age 指令和 Expires 响应头，
+// 响应头中没有相关信息时返回 false
+func GetFreshnessLifetime(header http.Header, now time.Time) (time.Duration, bool) {
+	var maxAge, sMaxAge string
+	for _, value := range header.Values("Cache-Control") {
+		for directive := range strings.SplitSeq(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			switch strings.ToLower(name) {
+			case "no-cache":
+				return 0, true
+			case "s-maxage":
+				sMaxAge = strings.Trim(arg, `"`)
+			case "max-age":
+				maxAge = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	for _, value := range []string{sMaxAge, maxAge} {
+		if value == "" {
+			continue
+		}
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds < 0 {
+			return 0, true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	expires := header.Get("Expires")
+	if expires == "" {
+		return 0, false
+	}
+	expiresAt, err := http.ParseTime(expires)
+	if err != nil { // 无效的 Expires 视为已过期
+		return 0, true
+	}
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		date = now
+	}
+	return max(expiresAt.Sub(date), 0), true
+}
@@ -0,0 +1,40 @@
+package utils_test
+
+import (
+	"MediaWarp/utils"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetFreshnessLifetime(t *testing.T) {
+	type TestCase struct {
+		Header   map[string]string
+		Lifetime time.Duration
+		OK       bool
+	}
+	testCases := map[string]TestCase{
+		"max-age":         {map[string]string{"Cache-Control": "public, max-age=3600"}, time.Hour, true},
+		"s-maxage 优先":     {map[string]string{"Cache-Control": "max-age=3600, s-maxage=60"}, time.Minute, true},
+		"no-cache":        {map[string]string{"Cache-Control": "no-cache, max-age=3600"}, 0, true},
+		"无效 max-age":      {map[string]string{"Cache-Control": "max-age=abc"}, 0, true},
+		"expires":         {map[string]string{"Date": "Mon, 02 Jan 2006 15:04:05 GMT", "Expires": "Mon, 02 Jan 2006 16:04:05 GMT"}, time.Hour, true},
+		"max-age 优先":      {map[string]string{"Cache-Control": "max-age=60", "Expires": "Mon, 02 Jan 2006 16:04:05 GMT"}, time.Minute, true},
+		"无效 expires":      {map[string]string{"Expires": "0"}, 0, true},
+		"expires 早于 date": {map[string]string{"Date": "Mon, 02 Jan 2006 15:04:05 GMT", "Expires": "Mon, 02 Jan 2006 14:04:05 GMT"}, 0, true},
+		"none":            {map[string]string{"Cache-Control": "public"}, 0, false},
+	}
+
+	for caseName, testCase := range testCases {
+		t.Run(caseName, func(t *testing.T) {
+			header := make(http.Header)
+			for key, value := range testCase.Header {
+				header.Set(key, value)
+			}
+			lifetime, ok := utils.GetFreshnessLifetime(header, time.Now())
+			if lifetime != testCase.Lifetime || ok != testCase.OK {
+				t.Errorf("%s 计算新鲜期错误。期望: %s %t, 实际: %s %t", caseName, testCase.Lifetime, testCase.OK, lifetime, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// 网段匹配器
+//
+// 列表中的每一项为网段或单个 IP，以 ! 开头表示排除该网段；
+// 排除的网段优先，未设置包含的网段时匹配除排除网段以外的所有地址
+type CIDRMatcher struct {
+	includeList []netip.Prefix
+	excludeList []netip.Prefix
+}
+
+// 创建网段匹配器
+func NewCIDRMatcher(cidrList []string) (*CIDRMatcher, error) {
+	var matcher CIDRMatcher
+	for _, cidr := range cidrList {
+		exclude := strings.HasPrefix(cidr, "!")
+		prefix, err := ParsePrefix(strings.TrimPrefix(cidr, "!"))
+		if err != nil {
+			return nil, fmt.Errorf("网段 %s 错误: %w", cidr, err)
+		}
+		if exclude {
+			matcher.excludeList = append(matcher.excludeList, prefix)
+		} else {
+			matcher.includeList = append(matcher.includeList, prefix)
+		}
+	}
+	return &matcher, nil
+}
+
+// 是否未设置任何网段（匹配所有地址）
+func (matcher *CIDRMatcher) Empty() bool {
+	return len(matcher.includeList) == 0 && len(matcher.excludeList) == 0
+}
+
+// 判断 IP 是否匹配
+func (matcher *CIDRMatcher) Match(ip string) bool {
+	if matcher.Empty() {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range matcher.excludeList {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if len(matcher.includeList) == 0 {
+		return true
+	}
+	for _, prefix := range matcher.includeList {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析网段，单个 IP 视为只包含该 IP 的网段
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
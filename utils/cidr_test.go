@@ -0,0 +1,37 @@
+package utils_test
+
+import (
+	"MediaWarp/utils"
+	"testing"
+)
+
+func TestCIDRMatcher(t *testing.T) {
+	type TestCase struct {
+		CIDRList []string
+		IP       string
+		Result   bool
+	}
+	testCases := map[string]TestCase{
+		"empty":         {nil, "8.8.8.8", true},
+		"include":       {[]string{"192.168.0.0/16"}, "192.168.1.10", true},
+		"not include":   {[]string{"192.168.0.0/16"}, "10.0.0.1", false},
+		"single ip":     {[]string{"10.0.0.1"}, "10.0.0.1", true},
+		"exclude":       {[]string{"!192.168.0.0/16"}, "192.168.1.10", false},
+		"exclude other": {[]string{"!192.168.0.0/16"}, "8.8.8.8", true},
+		"exclude first": {[]string{"10.0.0.0/8", "!10.0.0.1"}, "10.0.0.1", false},
+		"ipv4 mapped":   {[]string{"127.0.0.1"}, "::ffff:127.0.0.1", true},
+		"invalid ip":    {[]string{"127.0.0.1"}, "", false},
+	}
+
+	for caseName, testCase := range testCases {
+		t.Run(caseName, func(t *testing.T) {
+			matcher, err := utils.NewCIDRMatcher(testCase.CIDRList)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result := matcher.Match(testCase.IP); result != testCase.Result {
+				t.Errorf("%s 匹配错误。期望: %t, 实际: %t", caseName, testCase.Result, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// MediaBrowser 认证头中的键值对，如 MediaBrowser Client="Emby Web", Device="Chrome"
+var embyAuthorizationPattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// 获取客户端认证信息
+//
+// 依次从请求头 header、MediaBrowser 认证头（X-Emby-Authorization、Authorization）中的 authKey
+// 以及查询参数 queryKeys（忽略大小写）中获取
+func GetEmbyAuthValue(req *http.Request, header string, authKey string, queryKeys ...string) string {
+	if value := req.Header.Get(header); value != "" {
+		return value
+	}
+	if authKey != "" {
+		for _, authHeader := range []string{"X-Emby-Authorization", "Authorization"} {
+			for _, matches := range embyAuthorizationPattern.FindAllStringSubmatch(req.Header.Get(authHeader), -1) {
+				if matches[1] == authKey && matches[2] != "" {
+					return matches[2]
+				}
+			}
+		}
+	}
+	if len(queryKeys) > 0 {
+		for key, values := range req.URL.Query() {
+			for _, queryKey := range queryKeys {
+				if strings.EqualFold(key, queryKey) && len(values) > 0 && values[0] != "" {
+					return values[0]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// 获取请求中的访问令牌（Emby、Jellyfin 的 X-Emby-Token / api_key，Plex 的 X-Plex-Token）
+func GetClientToken(req *http.Request) string {
+	if token := GetEmbyAuthValue(req, "X-Emby-Token", "Token", "X-Emby-Token", "api_key"); token != "" {
+		return token
+	}
+	if token := req.Header.Get("X-MediaBrowser-Token"); token != "" {
+		return token
+	}
+	return GetEmbyAuthValue(req, "X-Plex-Token", "", "X-Plex-Token")
+}
+
+// 获取请求中的设备 ID
+func GetClientDeviceID(req *http.Request) string {
+	if deviceID := GetEmbyAuthValue(req, "X-Emby-Device-Id", "DeviceId", "X-Emby-Device-Id", "DeviceId"); deviceID != "" {
+		return deviceID
+	}
+	return GetEmbyAuthValue(req, "X-Plex-Client-Identifier", "", "X-Plex-Client-Identifier")
+}
+
+// 获取客户端名称和设备名称
+func GetClientInfo(req *http.Request) (string, string) {
+	return GetEmbyAuthValue(req, "X-Emby-Client", "Client", "X-Emby-Client"),
+		GetEmbyAuthValue(req, "X-Emby-Device-Name", "Device", "X-Emby-Device-Name")
+}
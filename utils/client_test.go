@@ -0,0 +1,35 @@
+package utils_test
+
+import (
+	"MediaWarp/utils"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetClientToken(t *testing.T) {
+	type TestCase struct {
+		URI    string
+		Header map[string]string
+		Result string
+	}
+	testCases := map[string]TestCase{
+		"header":    {"/emby/Items", map[string]string{"X-Emby-Token": "abc"}, "abc"},
+		"auth":      {"/emby/Items", map[string]string{"X-Emby-Authorization": `MediaBrowser Client="Emby Web", Device="Chrome", DeviceId="1", Version="4.8", Token="abc"`}, "abc"},
+		"query":     {"/emby/Items?api_KEY=abc", nil, "abc"},
+		"plex":      {"/library/sections?X-Plex-Token=abc", nil, "abc"},
+		"header 优先": {"/emby/Items?api_key=def", map[string]string{"X-Emby-Token": "abc"}, "abc"},
+		"none":      {"/emby/Items", map[string]string{"Authorization": `MediaBrowser Client="Emby Web"`}, ""},
+	}
+
+	for caseName, testCase := range testCases {
+		t.Run(caseName, func(t *testing.T) {
+			req := httptest.NewRequest("GET", testCase.URI, nil)
+			for key, value := range testCase.Header {
+				req.Header.Set(key, value)
+			}
+			if result := utils.GetClientToken(req); result != testCase.Result {
+				t.Errorf("%s 获取访问令牌错误。期望: %s, 实际: %s", caseName, testCase.Result, result)
+			}
+		})
+	}
+}
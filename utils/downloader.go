@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var ErrUnexpectedRangeResponse = errors.New("上游未按 Range 请求返回分块内容")
+
+// 多连接分块下载器
+//
+// 将一个较大的 Range 请求拆分为多个分块并发下载，并按顺序写入客户端，
+// 用于突破网盘对单连接的限速
+type RangeDownloader struct {
+	client      *http.Client
+	connections int   // 并发连接数
+	chunkSize   int64 // 分块大小
+	maxPending  int   // 最多缓存的分块数量（预读缓冲区大小 / 分块大小）
+	maxRetries  int   // 分块下载失败时的重试次数
+	bufferPool  sync.Pool
+}
+
+// 创建多连接分块下载器
+//
+// bufferSize 为预读缓冲区大小，至少可以容纳 connections 个分块
+func NewRangeDownloader(client *http.Client, connections int, chunkSize int64, bufferSize int64, maxRetries int) *RangeDownloader {
+	downloader := RangeDownloader{
+		client:      client,
+		connections: max(connections, 1),
+		chunkSize:   max(chunkSize, 1),
+		maxRetries:  max(maxRetries, 0),
+	}
+	downloader.maxPending = max(int(bufferSize/downloader.chunkSize), downloader.connections)
+	downloader.bufferPool.New = func() any { return make([]byte, downloader.chunkSize) }
+	return &downloader
+}
+
+// 分块大小
+func (downloader *RangeDownloader) ChunkSize() int64 {
+	return downloader.chunkSize
+}
+
+// 下载分块
+type rangeChunk struct {
+	start, end int64
+	buf        []byte
+	err        error
+	done       chan struct{}
+}
+
+// 按顺序将 target 中 [start, end] 范围的内容写入 w
+//
+// first 为已经建立的、从 start 开始的响应体（可以为 nil），会直接转发其中的第一个分块，
+// 同时并发下载后续分块；header 为每个分块请求携带的请求头
+func (downloader *RangeDownloader) Copy(ctx context.Context, target *url.URL, header http.Header, first io.Reader, start int64, end int64, w io.Writer) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		written int64
+		pos     = start
+	)
+	if first != nil {
+		n, err := io.CopyN(w, first, min(downloader.chunkSize, end-start+1))
+		written += n
+		if err != nil {
+			return written, err
+		}
+		pos += n
+	}
+	if pos > end {
+		return written, nil
+	}
+
+	var (
+		jobs    = make(chan *rangeChunk)
+		pending = make(chan *rangeChunk, downloader.maxPending)
+	)
+	go func() { // 按顺序生成分块，pending 满时阻塞以限制内存占用
+		defer close(jobs)
+		defer close(pending)
+		for chunkStart := pos; chunkStart <= end; chunkStart += downloader.chunkSize {
+			chunk := &rangeChunk{
+				start: chunkStart,
+				end:   min(chunkStart+downloader.chunkSize-1, end),
+				done:  make(chan struct{}),
+			}
+			select {
+			case pending <- chunk:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for range downloader.connections {
+		go func() {
+			for chunk := range jobs {
+				chunk.buf = downloader.bufferPool.Get().([]byte)[:chunk.end-chunk.start+1]
+				chunk.err = downloader.fetchWithRetry(ctx, target, header, chunk)
+				close(chunk.done)
+			}
+		}()
+	}
+
+	for chunk := range pending {
+		select {
+		case <-chunk.done:
+		case <-ctx.Done():
+			return written, ctx.Err()
+		}
+		if chunk.err != nil {
+			return written, chunk.err
+		}
+		n, err := w.Write(chunk.buf)
+		written += int64(n)
+		downloader.bufferPool.Put(chunk.buf[:cap(chunk.buf)])
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, ctx.Err()
+}
+
+// 下载分块，失败时重试
+func (downloader *RangeDownloader) fetchWithRetry(ctx context.Context, target *url.URL, header http.Header, chunk *rangeChunk) error {
+	var err error
+	for attempt := 0; attempt <= downloader.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * 500 * time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err = downloader.fetch(ctx, target, header, chunk); err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("分块 %d-%d 下载失败（已重试 %d 次）: %w", chunk.start, chunk.end, downloader.maxRetries, err)
+}
+
+// 下载分块
+func (downloader *RangeDownloader) fetch(ctx context.Context, target *url.URL, header http.Header, chunk *rangeChunk) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header = header.Clone()
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", chunk.start, chunk.end))
+
+	resp, err := downloader.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("%w: %s", ErrUnexpectedRangeResponse, resp.Status)
+	}
+	_, err = io.ReadFull(resp.Body, chunk.buf)
+	return err
+}
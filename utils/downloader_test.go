@@ -0,0 +1,81 @@
+package utils_test
+
+import (
+	"MediaWarp/utils"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRangeDownloaderCopy(t *testing.T) {
+	content := make([]byte, 100_003)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	var requests, failures atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 3 { // 模拟分块下载失败
+			failures.Add(1)
+			http.Error(w, "error", http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, "video.mkv", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+
+	testCases := map[string]struct {
+		start, end int64
+		first      bool
+	}{
+		"all":          {0, int64(len(content)) - 1, false},
+		"range":        {12_345, 87_654, false},
+		"with first":   {1_000, int64(len(content)) - 1, true},
+		"single chunk": {10, 20, true},
+	}
+
+	for caseName, testCase := range testCases {
+		t.Run(caseName, func(t *testing.T) {
+			downloader := utils.NewRangeDownloader(http.DefaultClient, 4, 4096, 16384, 2)
+			var (
+				out   bytes.Buffer
+				first io.Reader
+			)
+			if testCase.first { // 模拟已经建立的响应
+				first = bytes.NewReader(content[testCase.start:])
+			}
+			n, err := downloader.Copy(context.Background(), target, http.Header{}, first, testCase.start, testCase.end, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != testCase.end-testCase.start+1 || !bytes.Equal(out.Bytes(), content[testCase.start:testCase.end+1]) {
+				t.Errorf("内容不一致，写入 %d 字节", n)
+			}
+		})
+	}
+	if failures.Load() == 0 {
+		t.Error("未触发分块重试")
+	}
+}
+
+func TestRangeDownloaderCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	downloader := utils.NewRangeDownloader(http.DefaultClient, 2, 1024, 0, 3)
+	if _, err := downloader.Copy(ctx, target, http.Header{}, nil, 0, 10_000, &bytes.Buffer{}); err == nil {
+		t.Error("取消后应当返回错误")
+	}
+}
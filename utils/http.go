@@ -56,3 +56,35 @@ var httpClient *http.Client = createOptimizedClient() // 全局客户端单例
 func GetHTTPClient() *http.Client {
 	return httpClient
 }
+
+var streamHTTPClient = &http.Client{Transport: httpClient.Transport} // 媒体流客户端，与全局客户端共用连接池，不限制整个请求的时间
+
+// 获取媒体流 HTTP 客户端
+//
+// 代理视频等长时间传输的内容时使用，请求生命周期由 Context 控制
+func GetStreamHTTPClient() *http.Client {
+	return streamHTTPClient
+}
+
+var rangeHTTPClient = createRangeClient() // 分块下载客户端
+
+// 创建分块下载客户端
+//
+// 复用全局客户端的传输配置，但禁用 HTTP/2，确保每个分块使用独立的 TCP 连接（HTTP/2 会复用同一个连接）
+func createRangeClient() *http.Client {
+	transport := httpClient.Transport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	return &http.Client{Transport: transport}
+}
+
+// 获取分块下载 HTTP 客户端
+func GetRangeHTTPClient() *http.Client {
+	return rangeHTTPClient
+}
+
+// 关闭所有全局 HTTP 客户端的空闲连接
+func CloseIdleConnections() {
+	httpClient.CloseIdleConnections() // 媒体流客户端与全局客户端共用连接池
+	rangeHTTPClient.CloseIdleConnections()
+}
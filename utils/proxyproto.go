@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidProxyHeader = errors.New("无效的 PROXY protocol 头部")
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n") // PROXY protocol v2 签名
+
+const proxyV1MaxLength = 107 // PROXY protocol v1 头部最大长度（包括 \r\n）
+
+// 解析 PROXY protocol 的监听器
+//
+// 每个连接开头必须带有 PROXY protocol（v1 或 v2）头部，连接的 RemoteAddr、LocalAddr 为头部中记录的地址；
+// 头部在第一次读取或者获取地址时解析，不会阻塞 Accept
+type proxyProtocolListener struct {
+	net.Listener
+	timeout time.Duration // 读取头部的超时时间
+}
+
+// 创建解析 PROXY protocol 的监听器
+//
+// 用于 HAProxy 等四层代理之后获取真实的客户端地址
+func NewProxyProtocolListener(listener net.Listener, timeout time.Duration) net.Listener {
+	return &proxyProtocolListener{Listener: listener, timeout: timeout}
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtocolConn{Conn: conn, timeout: l.timeout}, nil
+}
+
+// 带有 PROXY protocol 头部的连接
+type proxyProtocolConn struct {
+	net.Conn
+	timeout    time.Duration
+	reader     *bufio.Reader
+	once       sync.Once
+	remoteAddr net.Addr
+	localAddr  net.Addr
+	err        error
+}
+
+// 读取并解析头部
+func (c *proxyProtocolConn) readHeader() {
+	c.once.Do(func() {
+		if c.timeout > 0 {
+			c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+			defer c.Conn.SetReadDeadline(time.Time{})
+		}
+		c.reader = bufio.NewReader(c.Conn)
+		c.remoteAddr, c.localAddr, c.err = ReadProxyHeader(c.reader)
+		if c.err != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtocolConn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// 读取 PROXY protocol 头部
+//
+// 返回头部中记录的客户端地址和服务端地址；头部为 LOCAL 命令、UNKNOWN 协议等不包含地址的情况时返回 nil
+func ReadProxyHeader(reader *bufio.Reader) (net.Addr, net.Addr, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch first[0] {
+	case 'P':
+		return readProxyHeaderV1(reader)
+	case '\r':
+		return readProxyHeaderV2(reader)
+	default:
+		return nil, nil, ErrInvalidProxyHeader
+	}
+}
+
+// 读取 PROXY protocol v1 头部，如 PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func readProxyHeaderV1(reader *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, fmt.Errorf("%w: 头部过长或缺少 CRLF", ErrInvalidProxyHeader)
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, nil, ErrInvalidProxyHeader
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil, nil
+	case "TCP4", "TCP6":
+		if len(fields) != 6 {
+			return nil, nil, fmt.Errorf("%w: 字段数量错误", ErrInvalidProxyHeader)
+		}
+		src, err := parseProxyAddrV1(fields[2], fields[4])
+		if err != nil {
+			return nil, nil, err
+		}
+		dst, err := parseProxyAddrV1(fields[3], fields[5])
+		if err != nil {
+			return nil, nil, err
+		}
+		return src, dst, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: 不支持的协议 %s", ErrInvalidProxyHeader, fields[1])
+	}
+}
+
+func parseProxyAddrV1(ip string, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("%w: 地址 %s 错误", ErrInvalidProxyHeader, ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 端口 %s 错误", ErrInvalidProxyHeader, port)
+	}
+	return &net.TCPAddr{IP: addr, Port: int(p)}, nil
+}
+
+// 读取 PROXY protocol v2 头部
+func readProxyHeaderV2(reader *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(header[:12], proxyV2Signature) {
+		return nil, nil, ErrInvalidProxyHeader
+	}
+	if header[12]>>4 != 2 {
+		return nil, nil, fmt.Errorf("%w: 不支持的版本 %d", ErrInvalidProxyHeader, header[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, nil, err
+	}
+
+	switch header[12] & 0x0F {
+	case 0x0: // LOCAL：代理自身的连接（如健康检查），使用连接的真实地址
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, fmt.Errorf("%w: 不支持的命令 %d", ErrInvalidProxyHeader, header[12]&0x0F)
+	}
+
+	var ipLen int
+	switch header[13] >> 4 {
+	case 0x1: // IPv4
+		ipLen = net.IPv4len
+	case 0x2: // IPv6
+		ipLen = net.IPv6len
+	default: // UNSPEC、UNIX
+		return nil, nil, nil
+	}
+	if len(payload) < ipLen*2+4 {
+		return nil, nil, fmt.Errorf("%w: 地址长度错误", ErrInvalidProxyHeader)
+	}
+	src := &net.TCPAddr{
+		IP:   net.IP(bytes.Clone(payload[:ipLen])),
+		Port: int(binary.BigEndian.Uint16(payload[ipLen*2:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(bytes.Clone(payload[ipLen : ipLen*2])),
+		Port: int(binary.BigEndian.Uint16(payload[ipLen*2+2:])),
+	}
+	return src, dst, nil
+}
@@ -0,0 +1,81 @@
+package utils_test
+
+import (
+	"MediaWarp/utils"
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadProxyHeader(t *testing.T) {
+	type TestCase struct {
+		Header string
+		Remote string // 为空表示头部中不包含地址
+		Err    error
+	}
+	v2IPv4 := "\r\n\r\n\x00\r\nQUIT\n" + "\x21\x11\x00\x0C" + "\xC0\xA8\x00\x01" + "\xC0\xA8\x00\x0B" + "\xDC\x04" + "\x01\xBB"
+	testCases := map[string]TestCase{
+		"v1 tcp4":    {"PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n", "192.168.0.1:56324", nil},
+		"v1 tcp6":    {"PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "[2001:db8::1]:56324", nil},
+		"v1 unknown": {"PROXY UNKNOWN\r\n", "", nil},
+		"v1 no crlf": {"PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\n", "", utils.ErrInvalidProxyHeader},
+		"v1 bad ip":  {"PROXY TCP4 192.168.0 192.168.0.11 56324 443\r\n", "", utils.ErrInvalidProxyHeader},
+		"v2 ipv4":    {v2IPv4, "192.168.0.1:56324", nil},
+		"v2 local":   {"\r\n\r\n\x00\r\nQUIT\n" + "\x20\x00\x00\x00", "", nil},
+		"http":       {"GET / HTTP/1.1\r\n", "", utils.ErrInvalidProxyHeader},
+	}
+
+	for caseName, testCase := range testCases {
+		t.Run(caseName, func(t *testing.T) {
+			remote, _, err := utils.ReadProxyHeader(bufio.NewReader(strings.NewReader(testCase.Header + "GET / HTTP/1.1\r\n")))
+			if !errors.Is(err, testCase.Err) {
+				t.Fatalf("%s 解析错误。期望错误: %v, 实际错误: %v", caseName, testCase.Err, err)
+			}
+			if err != nil {
+				return
+			}
+			var result string
+			if remote != nil {
+				result = remote.String()
+			}
+			if result != testCase.Remote {
+				t.Errorf("%s 解析错误。期望: %s, 实际: %s", caseName, testCase.Remote, result)
+			}
+		})
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	rawListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := utils.NewProxyProtocolListener(rawListener, time.Second)
+	defer listener.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", rawListener.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("PROXY TCP4 203.0.113.7 127.0.0.1 40000 9000\r\nhello"))
+	}()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if remote := conn.RemoteAddr().String(); remote != "203.0.113.7:40000" {
+		t.Errorf("客户端地址错误: %s", remote)
+	}
+	data, err := io.ReadAll(conn)
+	if err != nil || string(data) != "hello" {
+		t.Errorf("读取内容错误: %q, %v", data, err)
+	}
+}
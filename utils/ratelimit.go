@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const rateLimiterSweepInterval = time.Minute // 清理已补满的令牌桶的间隔
+
+// 令牌桶
+type tokenBucket struct {
+	tokens float64   // 剩余令牌数
+	last   time.Time // 上次更新时间
+}
+
+// 令牌桶限流器
+//
+// 每个 key 对应一个令牌桶，令牌以 rate 个/秒的速度补充，最多 burst 个；
+// 已补满的令牌桶会被定期清理，不会无限占用内存
+type RateLimiter struct {
+	rate      float64
+	burst     float64
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// 创建令牌桶限流器
+//
+// burst 小于 1 时取 max(1, rate)
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	limiter := RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+	if limiter.burst < 1 {
+		limiter.burst = max(1, math.Ceil(rate))
+	}
+	return &limiter
+}
+
+// 尝试消耗一个令牌
+//
+// 令牌不足时返回 false 以及需要等待的时间
+func (limiter *RateLimiter) Allow(key string) (bool, time.Duration) {
+	return limiter.AllowAt(key, time.Now())
+}
+
+// 尝试在 now 时刻消耗一个令牌
+func (limiter *RateLimiter) AllowAt(key string, now time.Time) (bool, time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	if now.Sub(limiter.lastSweep) >= rateLimiterSweepInterval {
+		limiter.sweep(now)
+	}
+
+	bucket, ok := limiter.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: limiter.burst, last: now}
+		limiter.buckets[key] = bucket
+	} else {
+		bucket.tokens = limiter.refill(bucket, now)
+		bucket.last = now
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	if limiter.rate <= 0 {
+		return false, rateLimiterSweepInterval
+	}
+	return false, time.Duration((1 - bucket.tokens) / limiter.rate * float64(time.Second))
+}
+
+// 计算 now 时刻令牌桶中的令牌数
+func (limiter *RateLimiter) refill(bucket *tokenBucket, now time.Time) float64 {
+	elapsed := now.Sub(bucket.last).Seconds()
+	if elapsed <= 0 {
+		return bucket.tokens
+	}
+	return min(limiter.burst, bucket.tokens+elapsed*limiter.rate)
+}
+
+// 清理已补满的令牌桶
+func (limiter *RateLimiter) sweep(now time.Time) {
+	limiter.lastSweep = now
+	for key, bucket := range limiter.buckets {
+		if limiter.refill(bucket, now) >= limiter.burst {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+// 正在限流的 key 数量
+func (limiter *RateLimiter) Len() int {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	return len(limiter.buckets)
+}
@@ -0,0 +1,42 @@
+package utils_test
+
+import (
+	"MediaWarp/utils"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	var (
+		limiter = utils.NewRateLimiter(2, 3) // 每秒 2 个，突发 3 个
+		now     = time.Now()
+	)
+
+	for i := range 3 {
+		if allowed, _ := limiter.AllowAt("user", now); !allowed {
+			t.Fatalf("第 %d 个请求应当放行", i+1)
+		}
+	}
+	allowed, retryAfter := limiter.AllowAt("user", now)
+	if allowed {
+		t.Fatal("超过突发数量的请求应当被限流")
+	}
+	if retryAfter != 500*time.Millisecond {
+		t.Errorf("等待时间错误。期望: %s, 实际: %s", 500*time.Millisecond, retryAfter)
+	}
+
+	if allowed, _ := limiter.AllowAt("other", now); !allowed {
+		t.Error("不同 key 之间不应当互相影响")
+	}
+	if allowed, _ := limiter.AllowAt("user", now.Add(500*time.Millisecond)); !allowed {
+		t.Error("补充令牌后应当放行")
+	}
+	if allowed, _ := limiter.AllowAt("user", now.Add(500*time.Millisecond)); allowed {
+		t.Error("令牌已用完，应当被限流")
+	}
+
+	limiter.AllowAt("user", now.Add(2*time.Minute)) // 触发清理
+	if n := limiter.Len(); n != 1 {
+		t.Errorf("已补满的令牌桶应当被清理，剩余 %d 个", n)
+	}
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrSingleFlightPanic = errors.New("合并执行的函数发生 panic")
+
+type singleFlightCall[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// 合并相同 key 的并发调用
+//
+// 同一时间相同 key 只有一个调用会执行，其余调用等待并共享其结果；零值即可使用
+type SingleFlight[T any] struct {
+	mutex sync.Mutex
+	calls map[string]*singleFlightCall[T]
+}
+
+// 执行 fn 并返回结果
+//
+// 相同 key 的调用正在执行时等待其完成并返回相同的结果，此时 fn 不会被调用；
+// fn 发生 panic 时等待中的调用返回 ErrSingleFlightPanic
+func (group *SingleFlight[T]) Do(key string, fn func() (T, error)) (T, error) {
+	group.mutex.Lock()
+	if group.calls == nil {
+		group.calls = make(map[string]*singleFlightCall[T])
+	}
+	if call, ok := group.calls[key]; ok {
+		group.mutex.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	call := &singleFlightCall[T]{done: make(chan struct{}), err: ErrSingleFlightPanic}
+	group.calls[key] = call
+	group.mutex.Unlock()
+
+	defer func() {
+		group.mutex.Lock()
+		delete(group.calls, key)
+		group.mutex.Unlock()
+		close(call.done)
+	}()
+	call.value, call.err = fn()
+	return call.value, call.err
+}
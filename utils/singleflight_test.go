@@ -0,0 +1,75 @@
+package utils_test
+
+import (
+	"MediaWarp/utils"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleFlight(t *testing.T) {
+	var (
+		group utils.SingleFlight[int]
+		calls atomic.Int32
+		start = make(chan struct{})
+		wg    sync.WaitGroup
+	)
+	results := make([]int, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			results[i], _ = group.Do("key", func() (int, error) {
+				calls.Add(1)
+				time.Sleep(50 * time.Millisecond)
+				return 42, nil
+			})
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("合并调用失败。期望执行次数: 1, 实际: %d", calls.Load())
+	}
+	for i, result := range results {
+		if result != 42 {
+			t.Errorf("第 %d 个调用结果错误。期望: 42, 实际: %d", i, result)
+		}
+	}
+
+	value, err := group.Do("key", func() (int, error) { return 0, errors.New("failed") })
+	if err == nil || value != 0 {
+		t.Errorf("调用完成后应重新执行。实际结果: %d, 错误: %v", value, err)
+	}
+}
+
+func TestSingleFlightPanic(t *testing.T) {
+	var (
+		group   utils.SingleFlight[int]
+		started = make(chan struct{})
+		release = make(chan struct{})
+		result  = make(chan error)
+	)
+	go func() {
+		defer func() { recover() }()
+		group.Do("key", func() (int, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+	go func() {
+		_, err := group.Do("key", func() (int, error) { return 1, nil })
+		result <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if err := <-result; !errors.Is(err, utils.ErrSingleFlightPanic) {
+		t.Errorf("panic 时等待中的调用应返回 ErrSingleFlightPanic，实际: %v", err)
+	}
+}
@@ -142,3 +142,18 @@ func FindStringIndex(slice []string, target string, caseInsensitive bool, trim b
 	}
 	return -1
 }
+
+// 去除路径前缀
+//
+// 仅当前缀是完整的目录时才匹配（/mnt/cd2 不匹配 /mnt/cd22/a.mkv）
+func TrimPathPrefix(p string, prefix string) (string, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" || !strings.HasPrefix(p, prefix) {
+		return "", false
+	}
+	rest := p[len(prefix):]
+	if rest != "" && !strings.HasPrefix(rest, "/") {
+		return "", false
+	}
+	return rest, true
+}
@@ -133,3 +133,29 @@ func BenchmarkMethod2(b *testing.B) {
 		buf.Write(newLine)
 	}
 }
+
+func TestTrimPathPrefix(t *testing.T) {
+	type TestCase struct {
+		Path   string
+		Prefix string
+		Rest   string
+		OK     bool
+	}
+	testCases := map[string]TestCase{
+		"目录":     {"/mnt/cd2/a.mkv", "/mnt/cd2", "/a.mkv", true},
+		"末尾斜杠":   {"/mnt/cd2/a.mkv", "/mnt/cd2/", "/a.mkv", true},
+		"完全相同":   {"/mnt/cd2", "/mnt/cd2", "", true},
+		"不完整的目录": {"/mnt/cd22/a.mkv", "/mnt/cd2", "", false},
+		"不匹配":    {"/media/a.mkv", "/mnt", "", false},
+		"空前缀":    {"/mnt/a.mkv", "", "", false},
+	}
+
+	for caseName, testCase := range testCases {
+		t.Run(caseName, func(t *testing.T) {
+			rest, ok := utils.TrimPathPrefix(testCase.Path, testCase.Prefix)
+			if rest != testCase.Rest || ok != testCase.OK {
+				t.Errorf("%s 去除路径前缀错误。期望: %q %t, 实际: %q %t", caseName, testCase.Rest, testCase.OK, rest, ok)
+			}
+		})
+	}
+}
@@ -45,6 +45,7 @@ func SRT2ASS(srtText []byte, style []string) []byte {
 	// 预定义常量
 	var (
 		newLine        = []byte("\n")
+		literalNewLine = []byte(`\n`)
 		dialogueStart  = []byte("Dialogue: 0,")
 		dialogueSuffix = []byte(",Default,,0,0,0,,")
 	)
@@ -83,8 +84,8 @@ func SRT2ASS(srtText []byte, style []string) []byte {
 			subtitleBuffer.Write(bytes.ReplaceAll(line, []byte("-0"), []byte("0"))) // 替换时间中的负号
 			subtitleBuffer.Write(dialogueSuffix)
 		} else {
-			if currentSubtitleContent == 0 {
-				subtitleBuffer.Write(newLine) // 同一时间多行字幕需要在一行中使用字面量 \n 表示换行
+			if currentSubtitleContent > 0 {
+				subtitleBuffer.Write(literalNewLine) // 同一时间多行字幕需要在一行中使用字面量 \n 表示换行
 			}
 			subtitleBuffer.Write(line)
 			currentSubtitleContent += 1
@@ -2610,3 +2610,40 @@ Dialogue: 0,0:23:36.41,0:23:39.95,Default,,0,0,0,,(下集 魔法劍)
 		}
 	}
 }
+
+func TestSRT2ASSMultiLine(t *testing.T) {
+	type MultiLineTestCase struct {
+		SRT      string
+		Dialogue []string
+	}
+	testCases := map[string]MultiLineTestCase{
+		"单行字幕": {
+			"1\n00:00:01,000 --> 00:00:02,000\n第一行\n",
+			[]string{`Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,第一行`},
+		},
+		"两行字幕": {
+			"1\n00:00:01,000 --> 00:00:02,000\n第一行\n第二行\n\n2\n00:00:03,000 --> 00:00:04,000\n下一句\n",
+			[]string{
+				`Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,第一行\n第二行`,
+				`Dialogue: 0,0:00:03.00,0:00:04.00,Default,,0,0,0,,下一句`,
+			},
+		},
+		"三行字幕（CRLF）": {
+			"1\r\n00:00:01,000 --> 00:00:02,000\r\n一\r\n二\r\n三\r\n",
+			[]string{`Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,一\n二\n三`},
+		},
+	}
+	for caseName, testCase := range testCases {
+		t.Run(caseName, func(t *testing.T) {
+			var dialogue []string
+			for _, line := range strings.Split(string(utils.SRT2ASS([]byte(testCase.SRT), []string{})), "\n") {
+				if strings.HasPrefix(line, "Dialogue:") {
+					dialogue = append(dialogue, line)
+				}
+			}
+			if strings.Join(dialogue, "\n") != strings.Join(testCase.Dialogue, "\n") {
+				t.Errorf("%s 转换错误。\n期望：%q\n实际：%q", caseName, testCase.Dialogue, dialogue)
+			}
+		})
+	}
+}
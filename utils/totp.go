@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	totpPeriod = 30 // 时间步长（秒）
+	totpDigits = 6  // 验证码位数
+)
+
+// 解析 Base32 编码的 TOTP 密钥
+//
+// 忽略空格、短横线和大小写，可以省略末尾的填充字符
+func ParseTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(secret))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return nil, fmt.Errorf("TOTP 密钥不是有效的 Base32 编码: %w", err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("TOTP 密钥为空")
+	}
+	return key, nil
+}
+
+// 生成 TOTP 验证码（RFC 6238，HMAC-SHA1，30 秒，6 位）
+func GenerateTOTP(secret string, t time.Time) (string, error) {
+	key, err := ParseTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/totpPeriod))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%1000000), nil
+}
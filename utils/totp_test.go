@@ -0,0 +1,41 @@
+package utils_test
+
+import (
+	"MediaWarp/utils"
+	"testing"
+	"time"
+)
+
+func TestGenerateTOTP(t *testing.T) {
+	type TestCase struct {
+		Secret string
+		Time   int64
+		Result string
+	}
+	// RFC 6238 附录 B 的测试向量（取后 6 位），密钥为 ASCII "12345678901234567890"
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	testCases := map[string]TestCase{
+		"59":         {secret, 59, "287082"},
+		"1111111109": {secret, 1111111109, "081804"},
+		"1111111111": {secret, 1111111111, "050471"},
+		"1234567890": {secret, 1234567890, "005924"},
+		"2000000000": {secret, 2000000000, "279037"},
+		"小写和空格":      {"gezd gnbv gy3t qojq gezd gnbv gy3t qojq", 59, "287082"},
+	}
+
+	for caseName, testCase := range testCases {
+		t.Run(caseName, func(t *testing.T) {
+			result, err := utils.GenerateTOTP(testCase.Secret, time.Unix(testCase.Time, 0))
+			if err != nil {
+				t.Fatalf("%s 生成验证码失败: %v", caseName, err)
+			}
+			if result != testCase.Result {
+				t.Errorf("%s 生成验证码错误。期望: %s, 实际: %s", caseName, testCase.Result, result)
+			}
+		})
+	}
+
+	if _, err := utils.GenerateTOTP("not-base32!", time.Now()); err == nil {
+		t.Error("无效的密钥应返回错误")
+	}
+}